@@ -0,0 +1,687 @@
+package DragonBlood
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+)
+
+// BoostingLoss is a loss minimized by GradientBoostingRegressor.
+type BoostingLoss interface {
+	// Loss returns the loss of prediction for a unit whose target
+	// is target.
+	Loss(target, prediction float64) float64
+
+	// NegativeGradient returns the negative gradient of Loss with
+	// respect to prediction.  Each tree is fit to these
+	// pseudo-residuals.
+	NegativeGradient(target, prediction float64) float64
+
+	// Minimizer returns the constant c minimizing the weighted sum
+	// of Loss(r, c) over residuals.  It gives the initial prediction
+	// (the residuals are the targets) and the value of each leaf
+	// (the residuals are the targets less the current predictions).
+	Minimizer(residuals, weights []float64) float64
+}
+
+// SquaredLoss is half the squared error.
+type SquaredLoss struct{}
+
+func (SquaredLoss) Loss(target, prediction float64) float64 {
+	r := target - prediction
+	return 0.5 * r * r
+}
+
+func (SquaredLoss) NegativeGradient(target, prediction float64) float64 {
+	return target - prediction
+}
+
+func (SquaredLoss) Minimizer(residuals, weights []float64) float64 {
+	return MSECriterion{}.LeafMetric(residuals, weights).prediction
+}
+
+// AbsoluteLoss is the absolute error.
+type AbsoluteLoss struct{}
+
+func (AbsoluteLoss) Loss(target, prediction float64) float64 {
+	return math.Abs(target - prediction)
+}
+
+func (AbsoluteLoss) NegativeGradient(target, prediction float64) float64 {
+	switch {
+	case target > prediction:
+		return 1.0
+	case target < prediction:
+		return -1.0
+	}
+	return 0.0
+}
+
+func (AbsoluteLoss) Minimizer(residuals, weights []float64) float64 {
+	return weightedMedian(residuals, weights)
+}
+
+// HuberLoss is quadratic for errors smaller than Delta and linear
+// beyond it.  Delta must be positive.
+type HuberLoss struct {
+	Delta float64
+}
+
+func (h HuberLoss) Loss(target, prediction float64) float64 {
+	r := math.Abs(target - prediction)
+	if r > h.Delta {
+		return h.Delta * (r - 0.5*h.Delta)
+	}
+	return 0.5 * r * r
+}
+
+func (h HuberLoss) NegativeGradient(target, prediction float64) float64 {
+	return math.Max(-h.Delta, math.Min(h.Delta, target-prediction))
+}
+
+// Minimizer is the one-step Huber M-estimate used by HuberCriterion.
+func (h HuberLoss) Minimizer(residuals, weights []float64) float64 {
+	return HuberCriterion{h.Delta}.location(residuals, weights)
+}
+
+// QuantileLoss is the pinball loss, whose minimizer is the Alpha
+// quantile.  Alpha must be in (0, 1).
+type QuantileLoss struct {
+	Alpha float64
+}
+
+func (q QuantileLoss) Loss(target, prediction float64) float64 {
+	r := target - prediction
+	if r >= 0 {
+		return q.Alpha * r
+	}
+	return (q.Alpha - 1.0) * r
+}
+
+func (q QuantileLoss) NegativeGradient(target, prediction float64) float64 {
+	if target > prediction {
+		return q.Alpha
+	}
+	return q.Alpha - 1.0
+}
+
+func (q QuantileLoss) Minimizer(residuals, weights []float64) float64 {
+	return weightedQuantile(residuals, weights, q.Alpha)
+}
+
+// boostingOptions holds the options of gradient boosted models.
+type boostingOptions struct {
+	LearningRate float64
+
+	// Subsample is the fraction of the training units sampled
+	// (without replacement) for each iteration.
+	Subsample float64
+
+	// ValidationFraction is the fraction of the units held out to
+	// decide when to stop early.  Training stops once the validation
+	// loss has failed to improve by Tolerance for Patience
+	// iterations.  Early stopping is disabled if Patience is zero.
+	ValidationFraction float64
+	Patience           int
+	Tolerance          float64
+
+	Loss BoostingLoss
+}
+
+// WithLearningRate sets the factor by which the trees of a gradient
+// boosted model are shrunk (default 0.1).
+func WithLearningRate(rate float64) Option {
+	return func(dtg *decisionTreeGrower) { dtg.boosting.LearningRate = rate }
+}
+
+// WithSubsample grows each tree of a gradient boosted model on a
+// random fraction of the training units (default 1).  Column
+// subsampling is configured by WithMaxFeatures.
+func WithSubsample(fraction float64) Option {
+	return func(dtg *decisionTreeGrower) { dtg.boosting.Subsample = fraction }
+}
+
+// WithEarlyStopping holds out validationFraction of the units of a
+// gradient boosted model and stops training once the loss on those
+// units has failed to improve by at least tolerance for patience
+// iterations.  The model keeps the iterations up to the one with the
+// smallest validation loss.
+func WithEarlyStopping(validationFraction float64, patience int, tolerance float64) Option {
+	return func(dtg *decisionTreeGrower) {
+		dtg.boosting.ValidationFraction = validationFraction
+		dtg.boosting.Patience = patience
+		dtg.boosting.Tolerance = tolerance
+	}
+}
+
+// WithLoss selects the loss minimized by a GradientBoostingRegressor
+// (default SquaredLoss).
+func WithLoss(loss BoostingLoss) Option {
+	return func(dtg *decisionTreeGrower) { dtg.boosting.Loss = loss }
+}
+
+// newBoostingGrower returns a grower for shallow trees fit to
+// pseudo-residuals, configured by options.
+func newBoostingGrower(options []Option) *decisionTreeGrower {
+	defaults := []Option{
+		WithCriterion(FriedmanMSECriterion{}),
+		WithMaxDepth(3),
+		WithMaxFeatures(0),
+		WithLearningRate(0.1),
+		WithSubsample(1.0),
+	}
+	return newDecisionTreeGrower(FriedmanMSECriterion{}, append(defaults, options...))
+}
+
+// boostingObjective adapts a loss to the scores of units.  Each unit
+// has outputs() scores, which are updated by one tree apiece in each
+// iteration.
+type boostingObjective interface {
+	outputs() int
+
+	// initial returns the initial scores given the training units.
+	initial(units []int, weights []float64) []float64
+
+	// negativeGradient returns the pseudo-residual of score k of
+	// unit i, whose scores are scores.
+	negativeGradient(i, k int, scores []float64) float64
+
+	// leafValue returns the value of a leaf of a tree for score k
+	// that contains units.
+	leafValue(k int, units []int, scores [][]float64, weights []float64) float64
+
+	// loss returns the loss of unit i.
+	loss(i int, scores []float64) float64
+}
+
+// gradientBoosting holds the trees shared by the gradient boosting
+// regressor and classifier.
+type gradientBoosting struct {
+	nIterations int
+	grower      *decisionTreeGrower
+	nFeatures   int
+	featureSchema
+	seed int64
+
+	initial []float64
+
+	// trees[m][k] is the tree of iteration m for score k.
+	trees [][]*DecisionTreeNode
+
+	trainingLoss, validationLoss []float64
+}
+
+func newGradientBoosting(nIterations int, grower *decisionTreeGrower) gradientBoosting {
+	return gradientBoosting{nIterations: nIterations, grower: grower}
+}
+
+// fit runs up to nIterations iterations of gradient boosting.
+func (gb *gradientBoosting) fit(features []OrderedFeature, objective boostingObjective, weights []float64) {
+	gb.nFeatures = len(features)
+	gb.featureSchema = newFeatureSchema(features)
+
+	features = gb.grower.prepare(features)
+
+	n := features[0].Len()
+	if weights == nil {
+		weights = unitWeights(make([]float64, n), nil)
+	} else if len(weights) != n {
+		panic(fmt.Sprintf("Argument mismatch: features have length %d, but len(weights)=%d", n, len(weights)))
+	}
+
+	options := gb.grower.boosting
+	gb.seed = gb.grower.seed()
+	rng := rand.New(rand.NewSource(gb.seed))
+
+	units := rng.Perm(n)
+	nValidation := 0
+	if options.Patience > 0 {
+		nValidation = int(options.ValidationFraction*float64(n) + 0.5)
+	}
+	validation, training := units[:nValidation], units[nValidation:]
+
+	nOutputs := objective.outputs()
+	gb.initial = objective.initial(training, weights)
+	scores := gb.initialScores(n)
+
+	meanLoss := func(units []int) float64 {
+		loss, total := 0.0, 0.0
+		for _, i := range units {
+			loss += weights[i] * objective.loss(i, scores[i])
+			total += weights[i]
+		}
+		return loss / total
+	}
+
+	gb.trees = nil
+	gb.trainingLoss, gb.validationLoss = nil, nil
+	bestLoss, bestIteration := math.Inf(1), 0
+
+	residuals := make([]float64, n)
+	leaves := make([][]*DecisionTreeNode, nOutputs)
+	for m := 0; m < gb.nIterations; m++ {
+		bag := gb.sample(n, training, rng)
+
+		iterationTrees := make([]*DecisionTreeNode, nOutputs)
+		for k := range iterationTrees {
+			for i := range residuals {
+				residuals[i] = objective.negativeGradient(i, k, scores[i])
+			}
+
+			leaves[k] = make([]*DecisionTreeNode, n)
+			visit := func(i int, leaf *DecisionTreeNode) { leaves[k][i] = leaf }
+			iterationTrees[k] = gb.grower.grow(features, NewNumericFeature(residuals), NewWeightedBag(bag, weights), rng, m*nOutputs+k, visit)
+
+			// Replace the mean pseudo-residual of each leaf with
+			// the value that minimizes the loss.  Under monotonic
+			// constraints, the values are clipped to the bounds of
+			// the leaves.
+			leafUnits := make(map[*DecisionTreeNode][]int)
+			for i, leaf := range leaves[k] {
+				if bag.Count(i) > 0 {
+					leafUnits[leaf] = append(leafUnits[leaf], i)
+				}
+			}
+			for leaf, units := range leafUnits {
+				leaf.prediction = objective.leafValue(k, units, scores, weights)
+				if gb.grower.MonotonicConstraints != nil {
+					leaf.prediction = clip(leaf.prediction, leaf.lower, leaf.upper)
+				}
+			}
+		}
+
+		for k := range iterationTrees {
+			for i, leaf := range leaves[k] {
+				scores[i][k] += options.LearningRate * leaf.prediction
+			}
+		}
+		gb.trees = append(gb.trees, iterationTrees)
+		gb.trainingLoss = append(gb.trainingLoss, meanLoss(training))
+
+		if len(validation) > 0 {
+			loss := meanLoss(validation)
+			gb.validationLoss = append(gb.validationLoss, loss)
+			if loss < bestLoss-options.Tolerance {
+				bestLoss, bestIteration = loss, m+1
+			} else if m+1-bestIteration >= options.Patience {
+				break
+			}
+		}
+	}
+
+	// Discard the iterations after the best one, with their losses,
+	// so that the losses correspond to the iterations of the model.
+	if len(validation) > 0 && bestIteration < len(gb.trees) {
+		gb.trees = gb.trees[:bestIteration]
+		gb.trainingLoss = gb.trainingLoss[:bestIteration]
+		gb.validationLoss = gb.validationLoss[:bestIteration]
+	}
+}
+
+// sample returns a Bag containing a random Subsample of the training
+// units drawn without replacement (all of them if Subsample >= 1).
+func (gb *gradientBoosting) sample(n int, training []int, rng *rand.Rand) bag {
+	result := bag(make([]int, n))
+	size := len(training)
+	if fraction := gb.grower.boosting.Subsample; fraction > 0 && fraction < 1 {
+		size = int(fraction*float64(size) + 0.5)
+	}
+	if size < len(training) {
+		for _, j := range rng.Perm(len(training))[:size] {
+			result[training[j]] = 1
+		}
+	} else {
+		for _, i := range training {
+			result[i] = 1
+		}
+	}
+	return result
+}
+
+// initialScores returns the initial scores of n units.
+func (gb *gradientBoosting) initialScores(n int) [][]float64 {
+	scores := make([][]float64, n)
+	for i := range scores {
+		scores[i] = make([]float64, len(gb.initial))
+		copy(scores[i], gb.initial)
+	}
+	return scores
+}
+
+// update adds the contribution of the trees of one iteration to the
+// scores of the units of features.
+func (gb *gradientBoosting) update(features []Feature, scores [][]float64, iterationTrees []*DecisionTreeNode) {
+	rate := gb.grower.boosting.LearningRate
+	for k, tree := range iterationTrees {
+		for i := range scores {
+			scores[i][k] += rate * tree.leaf(features, i).prediction
+		}
+	}
+}
+
+// staged calls visit with the scores of the units of features after
+// each iteration.  visit must not retain scores.
+func (gb *gradientBoosting) staged(features []Feature, visit func(m int, scores [][]float64)) {
+	scores := gb.initialScores(features[0].Len())
+	for m, iterationTrees := range gb.trees {
+		gb.update(features, scores, iterationTrees)
+		visit(m, scores)
+	}
+}
+
+// scores returns the final scores of the units of features.
+func (gb *gradientBoosting) scores(features []Feature) [][]float64 {
+	scores := gb.initialScores(features[0].Len())
+	for _, iterationTrees := range gb.trees {
+		gb.update(features, scores, iterationTrees)
+	}
+	return scores
+}
+
+// NumIterations returns the number of iterations in the model, which
+// is less than requested if training stopped early.
+func (gb *gradientBoosting) NumIterations() int { return len(gb.trees) }
+
+// TrainingLoss returns the mean loss of the training units after each
+// iteration of the model.  After an early stop it omits the iterations
+// that were discarded, so its length is NumIterations().
+func (gb *gradientBoosting) TrainingLoss() []float64 { return gb.trainingLoss }
+
+// ValidationLoss returns the mean loss of the validation units after
+// each iteration of the model, like TrainingLoss, or nil if early
+// stopping is disabled.
+func (gb *gradientBoosting) ValidationLoss() []float64 { return gb.validationLoss }
+
+// Seed returns the seed with which the model was trained.
+func (gb *gradientBoosting) Seed() int64 { return gb.seed }
+
+// Importances returns the mean importance of each feature over the
+// trees.
+func (gb *gradientBoosting) Importances() []float64 {
+	importances := make([]float64, gb.nFeatures)
+	treeImportances := make([]float64, gb.nFeatures)
+
+	count := 0
+	for _, iterationTrees := range gb.trees {
+		for _, tree := range iterationTrees {
+			for j := range treeImportances {
+				treeImportances[j] = 0.0
+			}
+			tree.Importances(treeImportances)
+
+			count += 1
+			for j, imp := range treeImportances {
+				importances[j] += (imp - importances[j]) / float64(count)
+			}
+		}
+	}
+	return importances
+}
+
+// regressionObjective is the boostingObjective of a
+// GradientBoostingRegressor, which has a single score per unit.
+type regressionObjective struct {
+	boostingLoss BoostingLoss
+	target       Feature
+}
+
+func (o regressionObjective) outputs() int { return 1 }
+
+func (o regressionObjective) initial(units []int, weights []float64) []float64 {
+	targets := make([]float64, len(units))
+	unitWeights := make([]float64, len(units))
+	for j, i := range units {
+		targets[j] = o.target.NumericValue(i)
+		unitWeights[j] = weights[i]
+	}
+	return []float64{o.boostingLoss.Minimizer(targets, unitWeights)}
+}
+
+func (o regressionObjective) negativeGradient(i, k int, scores []float64) float64 {
+	return o.boostingLoss.NegativeGradient(o.target.NumericValue(i), scores[0])
+}
+
+func (o regressionObjective) leafValue(k int, units []int, scores [][]float64, weights []float64) float64 {
+	residuals := make([]float64, len(units))
+	unitWeights := make([]float64, len(units))
+	for j, i := range units {
+		residuals[j] = o.target.NumericValue(i) - scores[i][0]
+		unitWeights[j] = weights[i]
+	}
+	return o.boostingLoss.Minimizer(residuals, unitWeights)
+}
+
+func (o regressionObjective) loss(i int, scores []float64) float64 {
+	return o.boostingLoss.Loss(o.target.NumericValue(i), scores[0])
+}
+
+// GradientBoostingRegressor is a sequence of shallow regression trees,
+// each fit to the pseudo-residuals of the trees before it (Friedman
+// 2001).
+type GradientBoostingRegressor struct {
+	gradientBoosting
+}
+
+// NewGradientBoostingRegressor returns a gradient boosted regressor
+// of at most nIterations trees.  Unless configured otherwise, it
+// minimizes SquaredLoss with trees of depth 3 that consider all
+// features (FriedmanMSECriterion) and a learning rate of 0.1.
+func NewGradientBoostingRegressor(nIterations int, options ...Option) *GradientBoostingRegressor {
+	return &GradientBoostingRegressor{newGradientBoosting(nIterations, newBoostingGrower(options))}
+}
+
+func (gb *GradientBoostingRegressor) Fit(features []OrderedFeature, target Feature) {
+	gb.FitWeighted(features, target, nil)
+}
+
+// FitWeighted trains the model with each unit i weighted by
+// weights[i].  A nil weights is equivalent to unit weights.
+func (gb *GradientBoostingRegressor) FitWeighted(features []OrderedFeature, target Feature, weights []float64) {
+	loss := gb.grower.boosting.Loss
+	if loss == nil {
+		loss = SquaredLoss{}
+	}
+	gb.fit(features, regressionObjective{loss, target}, weights)
+}
+
+func (gb *GradientBoostingRegressor) Predict(features []Feature) []float64 {
+	result := make([]float64, features[0].Len())
+	for i, s := range gb.scores(features) {
+		result[i] = s[0]
+	}
+	return result
+}
+
+// StagedPredict returns the predictions after each iteration.
+// StagedPredict(features)[m] are the predictions of the first m+1
+// trees.
+func (gb *GradientBoostingRegressor) StagedPredict(features []Feature) [][]float64 {
+	result := make([][]float64, 0, len(gb.trees))
+	gb.staged(features, func(m int, scores [][]float64) {
+		predictions := make([]float64, len(scores))
+		for i, s := range scores {
+			predictions[i] = s[0]
+		}
+		result = append(result, predictions)
+	})
+	return result
+}
+
+// logisticObjective is the boostingObjective of a
+// GradientBoostingClassifier.  For two classes, units have a single
+// score, the log odds of class 1.  Otherwise, units have a score for
+// each class and the class probabilities are their softmax.
+type logisticObjective struct {
+	nClasses int
+	target   Feature
+}
+
+func (o logisticObjective) outputs() int {
+	if o.nClasses <= 2 {
+		return 1
+	}
+	return o.nClasses
+}
+
+// probabilities returns the class probabilities given the scores of a unit.
+func (o logisticObjective) probabilities(scores []float64) []float64 {
+	result := make([]float64, o.nClasses)
+	if len(scores) == 1 {
+		p := 1.0 / (1.0 + math.Exp(-scores[0]))
+		result[0] = 1.0 - p
+		if len(result) > 1 {
+			result[1] = p
+		}
+		return result
+	}
+
+	max := math.Inf(-1)
+	for _, s := range scores {
+		max = math.Max(max, s)
+	}
+	total := 0.0
+	for k, s := range scores {
+		result[k] = math.Exp(s - max)
+		total += result[k]
+	}
+	for k := range result {
+		result[k] /= total
+	}
+	return result
+}
+
+// indicator returns 1 if unit i is in the class of score k.
+func (o logisticObjective) indicator(i, k int) float64 {
+	class := int(o.target.NumericValue(i))
+	if o.outputs() == 1 {
+		class -= 1
+	}
+	if class == k {
+		return 1.0
+	}
+	return 0.0
+}
+
+// initial returns the log odds of class 1 for two classes or the log
+// prior of each class otherwise.
+func (o logisticObjective) initial(units []int, weights []float64) []float64 {
+	const epsilon = 1e-12
+
+	prior := make([]float64, o.nClasses)
+	total := 0.0
+	for _, i := range units {
+		prior[int(o.target.NumericValue(i))] += weights[i]
+		total += weights[i]
+	}
+	for k := range prior {
+		prior[k] = math.Max(epsilon, math.Min(1.0-epsilon, prior[k]/total))
+	}
+
+	if o.outputs() == 1 {
+		p := prior[len(prior)-1]
+		return []float64{math.Log(p / (1.0 - p))}
+	}
+	result := make([]float64, o.nClasses)
+	for k, p := range prior {
+		result[k] = math.Log(p)
+	}
+	return result
+}
+
+func (o logisticObjective) negativeGradient(i, k int, scores []float64) float64 {
+	p := o.probabilities(scores)
+	return o.indicator(i, k) - p[len(p)-o.outputs()+k]
+}
+
+// leafValue is a single Newton-Raphson step (Friedman 2001, algorithm 6).
+func (o logisticObjective) leafValue(k int, units []int, scores [][]float64, weights []float64) float64 {
+	numerator, denominator := 0.0, 0.0
+	for _, i := range units {
+		r := o.negativeGradient(i, k, scores[i])
+		numerator += weights[i] * r
+		denominator += weights[i] * math.Abs(r) * (1.0 - math.Abs(r))
+	}
+	if nOutputs := o.outputs(); nOutputs > 1 {
+		numerator *= float64(nOutputs-1) / float64(nOutputs)
+	}
+	if denominator < 1e-150 {
+		return 0.0
+	}
+	return numerator / denominator
+}
+
+// loss is the negative log likelihood.
+func (o logisticObjective) loss(i int, scores []float64) float64 {
+	p := o.probabilities(scores)[int(o.target.NumericValue(i))]
+	return -math.Log(math.Max(p, 1e-300))
+}
+
+// GradientBoostingClassifier is a gradient boosted model of the class
+// probabilities that minimizes the logistic loss (the multinomial
+// deviance for more than two classes, which grows a tree per class in
+// each iteration).
+type GradientBoostingClassifier struct {
+	gradientBoosting
+	classes  StringTable
+	nClasses int
+}
+
+// NewGradientBoostingClassifier returns a gradient boosted classifier
+// of at most nIterations iterations.  The defaults are as for
+// NewGradientBoostingRegressor.  WithLoss has no effect.
+func NewGradientBoostingClassifier(nIterations int, options ...Option) *GradientBoostingClassifier {
+	return &GradientBoostingClassifier{
+		newGradientBoosting(nIterations, newBoostingGrower(options)),
+		nil,
+		0,
+	}
+}
+
+func (gb *GradientBoostingClassifier) Fit(features []OrderedFeature, target *CategoricalFeature) {
+	gb.FitWeighted(features, target, nil)
+}
+
+// FitWeighted trains the model with each unit i weighted by
+// weights[i].  A nil weights is equivalent to unit weights.
+func (gb *GradientBoostingClassifier) FitWeighted(features []OrderedFeature, target *CategoricalFeature, weights []float64) {
+	gb.classes = target.stringTable
+	gb.nClasses = target.Categories()
+	gb.fit(features, gb.objective(target), weights)
+}
+
+func (gb *GradientBoostingClassifier) objective(target Feature) logisticObjective {
+	return logisticObjective{gb.nClasses, target}
+}
+
+// PredictProba returns, for each unit, a vector of class
+// probabilities indexed by class code.
+func (gb *GradientBoostingClassifier) PredictProba(features []Feature) [][]float64 {
+	objective := gb.objective(nil)
+	scores := gb.scores(features)
+	result := make([][]float64, len(scores))
+	for i, s := range scores {
+		result[i] = objective.probabilities(s)
+	}
+	return result
+}
+
+// StagedPredictProba returns the class probabilities after each
+// iteration.  StagedPredictProba(features)[m] are the probabilities
+// after m+1 iterations.
+func (gb *GradientBoostingClassifier) StagedPredictProba(features []Feature) [][][]float64 {
+	objective := gb.objective(nil)
+	result := make([][][]float64, 0, len(gb.trees))
+	gb.staged(features, func(m int, scores [][]float64) {
+		probabilities := make([][]float64, len(scores))
+		for i, s := range scores {
+			probabilities[i] = objective.probabilities(s)
+		}
+		result = append(result, probabilities)
+	})
+	return result
+}
+
+// Predict returns the label of the most probable class for each unit.
+func (gb *GradientBoostingClassifier) Predict(features []Feature) []string {
+	return decodeClasses(gb.PredictProba(features), gb.classes)
+}
@@ -0,0 +1,107 @@
+package DragonBlood_test
+
+import (
+	"math"
+	"testing"
+
+	db "github.com/mawicks/DragonBlood"
+)
+
+func TestGradientBoostingRegressor(test *testing.T) {
+	x := db.NewNumericFeature(nil)
+	t := db.NewNumericFeature(nil)
+	for i := 0; i < 20; i++ {
+		x.Add(i)
+		t.Add(float64(i/5) * 10)
+	}
+
+	losses := []db.BoostingLoss{
+		db.SquaredLoss{},
+		db.AbsoluteLoss{},
+		db.HuberLoss{Delta: 1.0},
+		db.QuantileLoss{Alpha: 0.5},
+	}
+	for _, loss := range losses {
+		gb := db.NewGradientBoostingRegressor(100, db.WithLoss(loss), db.WithLearningRate(0.5), db.WithSeed(1))
+		gb.Fit([]db.OrderedFeature{x}, t)
+
+		trainingLoss := gb.TrainingLoss()
+		if len(trainingLoss) != 100 || trainingLoss[99] >= trainingLoss[0] {
+			test.Errorf("%T: training loss didn't decrease: %v", loss, trainingLoss)
+		}
+
+		predictions := gb.Predict([]db.Feature{x})
+		for i, p := range predictions {
+			if math.Abs(p-t.Value(i).(float64)) > 0.5 {
+				test.Errorf("%T: row %d: predicted %v; actual %v", loss, i, p, t.Value(i))
+			}
+		}
+
+		staged := gb.StagedPredict([]db.Feature{x})
+		if len(staged) != gb.NumIterations() {
+			test.Errorf("%T: StagedPredict() returned %d stages; expected %d", loss, len(staged), gb.NumIterations())
+		}
+		for i, p := range staged[len(staged)-1] {
+			if p != predictions[i] {
+				test.Errorf("%T: row %d: last stage predicted %v; Predict() returned %v", loss, i, p, predictions[i])
+			}
+		}
+	}
+}
+
+func TestGradientBoostingEarlyStopping(test *testing.T) {
+	x := db.NewNumericFeature(nil)
+	t := db.NewNumericFeature(nil)
+	for i := 0; i < 100; i++ {
+		x.Add(i)
+		t.Add(float64(i%7) - 3.0) // Noise as far as a few splits can tell
+	}
+
+	gb := db.NewGradientBoostingRegressor(500, db.WithEarlyStopping(0.2, 5, 0.0), db.WithMaxDepth(1), db.WithSeed(3))
+	gb.Fit([]db.OrderedFeature{x}, t)
+
+	if gb.NumIterations() >= 500 {
+		test.Errorf("Training didn't stop early")
+	}
+	if len(gb.TrainingLoss()) != gb.NumIterations() || len(gb.ValidationLoss()) != gb.NumIterations() {
+		test.Errorf("TrainingLoss() and ValidationLoss() have %d and %d iterations; expected %d", len(gb.TrainingLoss()), len(gb.ValidationLoss()), gb.NumIterations())
+	}
+}
+
+func TestGradientBoostingClassifier(test *testing.T) {
+	x := db.NewNumericFeature(nil)
+	for i := 0; i < 12; i++ {
+		x.Add(i)
+	}
+
+	for _, labels := range [][]string{
+		{"a", "a", "a", "a", "a", "a", "b", "b", "b", "b", "b", "b"},
+		{"a", "a", "a", "a", "b", "b", "b", "b", "c", "c", "c", "c"},
+	} {
+		t := db.NewCategoricalFeature(db.NewStringTable())
+		t.AddFromString(labels...)
+
+		gb := db.NewGradientBoostingClassifier(50, db.WithSeed(1))
+		gb.Fit([]db.OrderedFeature{x}, t)
+
+		for i, p := range gb.Predict([]db.Feature{x}) {
+			if p != labels[i] {
+				test.Errorf("Row %d: predicted %v; actual %v", i, p, labels[i])
+			}
+		}
+
+		for i, p := range gb.PredictProba([]db.Feature{x}) {
+			sum := 0.0
+			for _, pk := range p {
+				sum += pk
+			}
+			if len(p) != t.Categories() || math.Abs(sum-1.0) > 1e-9 {
+				test.Errorf("Row %d: probabilities %v don't sum to 1", i, p)
+			}
+		}
+
+		if staged := gb.StagedPredictProba([]db.Feature{x}); len(staged) != 50 {
+			test.Errorf("StagedPredictProba() returned %d stages; expected 50", len(staged))
+		}
+	}
+}
@@ -0,0 +1,167 @@
+package DragonBlood
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// CategorySetSplitter is an implementation of Splitter for unordered
+// categorical features.  It sends the categories in the set (sorted
+// category codes) to the left and all other categories, including
+// categories not seen during training, to the right.
+type CategorySetSplitter []int
+
+func (s CategorySetSplitter) Split(x float64) bool {
+	code := int(x)
+	i := sort.SearchInts(s, code)
+	return i < len(s) && s[i] == code
+}
+
+func (s CategorySetSplitter) String() string {
+	codes := make([]string, len(s))
+	for i, code := range s {
+		codes[i] = fmt.Sprint(code)
+	}
+	return "in {" + strings.Join(codes, ",") + "}"
+}
+
+// categoryStatistics tallies the target values of the units of one
+// category within one node.
+type categoryStatistics struct {
+	count  int
+	weight float64
+	sum    float64
+
+	// classCounts holds the weight of each class, indexed by class
+	// code (classification only).
+	classCounts []float64
+}
+
+// dtOptimalCategorySplit computes an optimal subset split of the
+// categories of f for each splittable node.  Arguments are as for
+// dtOptimalSplit().
+//
+// The categories present in a node are ordered by their mean target
+// value and the resulting sequence is scanned as if it were an
+// ordered feature.  For regression and for binary classification
+// (where the mean class code is the proportion of class 1) this
+// finds the optimal subset (Fisher 1958; Breiman et al. 1984).  For
+// multiclass targets, the categories are ordered by the proportion of
+// each class in turn and the best of those scans is selected.
+func dtOptimalCategorySplit(
+	f *CategoricalFeature,
+	target Feature,
+	nodeMembership []int,
+	nodeCount int,
+	bag Bag,
+	criterion SplitCriterion,
+	minSize float64) []*SplitInfo {
+
+	_, classification := criterion.(Impurity)
+
+	// Group the units of each node by category
+	nCategories := f.Categories()
+	units := make([][][]int, nodeCount)
+	tallies := make([][]categoryStatistics, nodeCount)
+	for i := range units {
+		units[i] = make([][]int, nCategories)
+		tallies[i] = make([]categoryStatistics, nCategories)
+	}
+
+	nClasses := 0
+	for i, nm := range nodeMembership {
+		if nm >= 0 && bag.Count(i) > 0 {
+			category := f.values[i]
+			units[nm][category] = append(units[nm][category], i)
+
+			t := target.NumericValue(i)
+			tally := &tallies[nm][category]
+			weight := float64(bag.Count(i)) * bag.Weight(i)
+			tally.count += bag.Count(i)
+			tally.weight += weight
+			tally.sum += weight * t
+			if classification {
+				k := int(t)
+				for len(tally.classCounts) <= k {
+					tally.classCounts = append(tally.classCounts, 0.0)
+				}
+				tally.classCounts[k] += weight
+				if k >= nClasses {
+					nClasses = k + 1
+				}
+			}
+		}
+	}
+
+	// Each ordering is a function giving the score by which the
+	// categories of a node are ordered.
+	orderings := []func(categoryStatistics) float64{
+		func(cs categoryStatistics) float64 { return cs.sum / cs.weight },
+	}
+	if classification && nClasses > 2 {
+		orderings = orderings[:0]
+		for k := 0; k < nClasses; k++ {
+			k := k
+			orderings = append(orderings, func(cs categoryStatistics) float64 {
+				if k < len(cs.classCounts) {
+					return cs.classCounts[k] / cs.weight
+				}
+				return 0.0
+			})
+		}
+	}
+
+	result := make([]*SplitInfo, nodeCount)
+	for nm := range result {
+		present := make([]int, 0, nCategories)
+		for category, tally := range tallies[nm] {
+			if tally.count > 0 {
+				present = append(present, category)
+			}
+		}
+		if len(present) < 2 {
+			continue
+		}
+
+		for _, score := range orderings {
+			sort.SliceStable(present, func(a, b int) bool {
+				return score(tallies[nm][present[a]]) < score(tallies[nm][present[b]])
+			})
+
+			// Scan the categories in order of their score using the
+			// position in that order as the feature value.
+			accumulator := criterion.NewAccumulator(minSize)
+			for rank := len(present) - 1; rank >= 0; rank-- {
+				categoryUnits := units[nm][present[rank]]
+				for u := len(categoryUnits) - 1; u >= 0; u-- {
+					for j := 0; j < bag.Count(categoryUnits[u]); j++ {
+						accumulator.Add(target.NumericValue(categoryUnits[u]), bag.Weight(categoryUnits[u]))
+					}
+				}
+			}
+			for rank, category := range present {
+				for _, i := range units[nm][category] {
+					for j := 0; j < bag.Count(i); j++ {
+						accumulator.Move(float64(rank), target.NumericValue(i), bag.Weight(i))
+					}
+				}
+			}
+
+			if split := accumulator.BestSplit(); split != nil && (result[nm] == nil || split.reduction > result[nm].reduction) {
+				threshold := float64(split.splitter.(NumericSplitter))
+				left := CategorySetSplitter{}
+				for rank, category := range present {
+					if float64(rank) < threshold {
+						left = append(left, category)
+					}
+				}
+				sort.Ints(left)
+				split.splitter = left
+				result[nm] = split
+			}
+		}
+	}
+
+	return result
+}
@@ -0,0 +1,63 @@
+package DragonBlood_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	db "github.com/mawicks/DragonBlood"
+)
+
+func TestCategorySetSplitter(test *testing.T) {
+	s := db.CategorySetSplitter{1, 3}
+	for code, expected := range []bool{false, true, false, true, false} {
+		if s.Split(float64(code)) != expected {
+			test.Errorf("Split(%d) returned %v; expected %v", code, !expected, expected)
+		}
+	}
+	if s.String() != "in {1,3}" {
+		test.Errorf("String() returned %q", s.String())
+	}
+}
+
+func TestCategorySplit(test *testing.T) {
+	// Codes alternate between low and high targets, so no ordered
+	// split of the codes separates them, but one subset split does.
+	c := db.NewCategoricalFeature(db.NewStringTable())
+	c.AddFromString("a", "b", "c", "d", "a", "b", "c", "d")
+
+	t := db.NewNumericFeature(nil)
+	t.Add(0, 10, 0, 10, 0, 10, 0, 10)
+
+	dt := db.NewDecisionTreeRegressor()
+	dt.Fit([]db.OrderedFeature{c}, t)
+
+	for i, te := range dt.Predict([]db.Feature{c}) {
+		if te != t.Value(i) {
+			test.Errorf("Row %d: predicted %v; actual %v", i, te, t.Value(i))
+		}
+	}
+
+	var dump bytes.Buffer
+	dt.Dump(&dump)
+	if strings.Count(dump.String(), "(LEAF)") != 2 || !strings.Contains(dump.String(), "in {") {
+		test.Errorf("Expected a single subset split; got\n%s", dump.String())
+	}
+}
+
+func TestMulticlassCategorySplit(test *testing.T) {
+	c := db.NewCategoricalFeature(db.NewStringTable())
+	c.AddFromString("a", "b", "c", "d", "e", "f", "a", "b", "c", "d", "e", "f")
+
+	t := db.NewCategoricalFeature(db.NewStringTable())
+	t.AddFromString("x", "y", "z", "x", "y", "z", "x", "y", "z", "x", "y", "z")
+
+	dt := db.NewDecisionTreeClassifier(db.Gini)
+	dt.Fit([]db.OrderedFeature{c}, t)
+
+	for i, label := range dt.Predict([]db.Feature{c}) {
+		if label != t.Value(i) {
+			test.Errorf("Row %d: predicted %v; actual %v", i, label, t.Value(i))
+		}
+	}
+}
@@ -0,0 +1,171 @@
+package DragonBlood
+
+import "math"
+
+// probabilities returns the class probabilities of a classification
+// node as a vector of length nClasses.
+func (m *Metric) probabilities(nClasses int) []float64 {
+	result := make([]float64, nClasses)
+	total := 0.0
+	for _, c := range m.distribution {
+		total += c
+	}
+	if total > 0 {
+		for k, c := range m.distribution {
+			if k < nClasses {
+				result[k] = c / total
+			}
+		}
+	}
+	return result
+}
+
+// DecisionTreeClassifier is a decision tree for a categorical target.
+// Leaves record the class counts of the training units they contain.
+type DecisionTreeClassifier struct {
+	DecisionTree
+	classes  StringTable
+	nClasses int
+}
+
+func NewDecisionTreeClassifier(impurity Impurity, options ...Option) *DecisionTreeClassifier {
+	return &DecisionTreeClassifier{
+		DecisionTree{
+			0,
+			nil,
+			newDecisionTreeGrower(impurity, options),
+			featureSchema{},
+			0,
+		},
+		nil,
+		0,
+	}
+}
+
+func (dtc *DecisionTreeClassifier) Fit(features []OrderedFeature, target *CategoricalFeature) {
+	dtc.FitWeighted(features, target, nil)
+}
+
+// FitWeighted trains the tree with each unit i weighted by
+// weights[i].  Leaves record the weight of each class rather than its
+// count.  A nil weights is equivalent to unit weights.
+func (dtc *DecisionTreeClassifier) FitWeighted(features []OrderedFeature, target *CategoricalFeature, weights []float64) {
+	dtc.classes = target.stringTable
+	dtc.nClasses = target.Categories()
+	dtc.DecisionTree.FitWeighted(features, target, weights)
+}
+
+// PredictProba returns, for each unit, a vector of class
+// probabilities indexed by class code.
+func (dtc *DecisionTreeClassifier) PredictProba(features []Feature) [][]float64 {
+	var result [][]float64
+	if dtc.root != nil && len(features) > 0 {
+		result = make([][]float64, features[0].Len())
+		for i := range result {
+			result[i] = dtc.root.leaf(features, i).probabilities(dtc.nClasses)
+		}
+	}
+	return result
+}
+
+// Predict returns the label of the most probable class for each unit.
+func (dtc *DecisionTreeClassifier) Predict(features []Feature) []string {
+	return decodeClasses(dtc.PredictProba(features), dtc.classes)
+}
+
+// RandomForestClassifier is a random forest of classification trees.
+// Class probabilities are the average of the class probabilities of
+// the individual trees.
+type RandomForestClassifier struct {
+	randomForest
+	classes  StringTable
+	nClasses int
+}
+
+func NewRandomForestClassifier(nTrees int, impurity Impurity, options ...Option) *RandomForestClassifier {
+	return &RandomForestClassifier{
+		newRandomForest(nTrees, newDecisionTreeGrower(impurity, options)),
+		nil,
+		0,
+	}
+}
+
+// Fit trains the forest, replacing the trees of any earlier call, and
+// returns the out-of-bag class probabilities for each unit.  Units
+// that were never out of bag have NaN probabilities.
+func (rf *RandomForestClassifier) Fit(features []OrderedFeature, target *CategoricalFeature) [][]float64 {
+	return rf.FitWeighted(features, target, nil)
+}
+
+// FitWeighted is like Fit but weights unit i by weights[i] when
+// growing the trees.  A nil weights is equivalent to unit weights.
+func (rf *RandomForestClassifier) FitWeighted(features []OrderedFeature, target *CategoricalFeature, weights []float64) [][]float64 {
+	rf.classes = target.stringTable
+	rf.nClasses = target.Categories()
+
+	oobProbability := make([][]float64, features[0].Len())
+	oobCount := make([]int, len(oobProbability))
+	for i := range oobProbability {
+		oobProbability[i] = make([]float64, rf.nClasses)
+	}
+
+	rf.fit(features, target, weights, func(i int, leaf *DecisionTreeNode) {
+		oobCount[i] += 1
+		for k, p := range leaf.probabilities(rf.nClasses) {
+			oobProbability[i][k] += (p - oobProbability[i][k]) / float64(oobCount[i])
+		}
+	})
+
+	for i, count := range oobCount {
+		if count == 0 {
+			for k := range oobProbability[i] {
+				oobProbability[i][k] = math.NaN()
+			}
+		}
+	}
+
+	return oobProbability
+}
+
+// PredictProba returns, for each unit, a vector of class
+// probabilities indexed by class code.
+func (rf *RandomForestClassifier) PredictProba(features []Feature) [][]float64 {
+	result := make([][]float64, features[0].Len())
+	for i := range result {
+		result[i] = make([]float64, rf.nClasses)
+	}
+
+	rf.parallelRange(len(result), func(start, end int) {
+		for t, tree := range rf.trees {
+			if tree != nil {
+				for i := start; i < end; i++ {
+					for k, p := range tree.leaf(features, i).probabilities(rf.nClasses) {
+						result[i][k] += (p - result[i][k]) / float64(t+1)
+					}
+				}
+			}
+		}
+	})
+
+	return result
+}
+
+// Predict returns the label of the most probable class for each unit.
+func (rf *RandomForestClassifier) Predict(features []Feature) []string {
+	return decodeClasses(rf.PredictProba(features), rf.classes)
+}
+
+// decodeClasses maps each probability vector to the label of its most
+// probable class.
+func decodeClasses(probabilities [][]float64, classes StringTable) []string {
+	var result []string
+	if probabilities != nil {
+		result = make([]string, len(probabilities))
+		for i, p := range probabilities {
+			if k := argmax(p); k >= 0 {
+				result[i] = classes.Decode(k)
+			}
+		}
+	}
+	return result
+}
@@ -0,0 +1,102 @@
+package DragonBlood_test
+
+import (
+	"math"
+	"testing"
+
+	db "github.com/mawicks/DragonBlood"
+)
+
+func classifierData() ([]*db.NumericFeature, *db.CategoricalFeature) {
+	x := db.NewNumericFeature(nil)
+	x.Add(0, 1, 2, 3, 4, 5, 6, 7)
+
+	y := db.NewNumericFeature(nil)
+	y.Add(1, 2, 1, 2, 1, 2, 1, 2)
+
+	t := db.NewCategoricalFeature(db.NewStringTable())
+	t.AddFromString("low", "low", "low", "mid", "mid", "high", "high", "high")
+
+	return []*db.NumericFeature{x, y}, t
+}
+
+func TestDecisionTreeClassifier(test *testing.T) {
+	for _, impurity := range []db.Impurity{db.Gini, db.Entropy} {
+		x, t := classifierData()
+
+		dtFeatures := []db.OrderedFeature{}
+		features := []db.Feature{}
+		for _, f := range x {
+			dtFeatures = append(dtFeatures, f)
+			features = append(features, f)
+		}
+
+		dt := db.NewDecisionTreeClassifier(impurity)
+		dt.Fit(dtFeatures, t)
+
+		for i, p := range dt.PredictProba(features) {
+			if len(p) != t.Categories() {
+				test.Errorf("%v: row %d: probability vector has length %d; expected %d", impurity, i, len(p), t.Categories())
+			}
+			sum := 0.0
+			for _, pk := range p {
+				sum += pk
+			}
+			if math.Abs(sum-1.0) > 1e-12 {
+				test.Errorf("%v: row %d: probabilities sum to %v", impurity, i, sum)
+			}
+		}
+
+		for i, label := range dt.Predict(features) {
+			if label != t.Value(i) {
+				test.Errorf("%v: row %d: predicted %v; actual %v", impurity, i, label, t.Value(i))
+			}
+		}
+	}
+}
+
+func TestRandomForestClassifier(test *testing.T) {
+	x, t := classifierData()
+
+	rfFeatures := []db.OrderedFeature{}
+	features := []db.Feature{}
+	for _, f := range x {
+		rfFeatures = append(rfFeatures, f)
+		features = append(features, f)
+	}
+
+	rf := db.NewRandomForestClassifier(10, db.Gini)
+	oob := rf.Fit(rfFeatures, t)
+
+	if len(oob) != t.Len() {
+		test.Errorf("rf.Fit() returned %d OOB rows; expected %d", len(oob), t.Len())
+	}
+
+	labels := rf.Predict(features)
+	if len(labels) != t.Len() {
+		test.Errorf("rf.Predict() returned result of length: %d; expected %d", len(labels), t.Len())
+	}
+
+	for i, p := range rf.PredictProba(features) {
+		sum := 0.0
+		for _, pk := range p {
+			sum += pk
+		}
+		if math.Abs(sum-1.0) > 1e-12 {
+			test.Errorf("Row %d: probabilities sum to %v", i, sum)
+		}
+	}
+}
+
+func TestInvalidClassCode(test *testing.T) {
+	for _, code := range []float64{-1, math.NaN(), 0.5} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					test.Errorf("Class code %v didn't panic", code)
+				}
+			}()
+			db.Gini.LeafMetric([]float64{0, code}, nil)
+		}()
+	}
+}
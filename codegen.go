@@ -0,0 +1,550 @@
+package DragonBlood
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// goGenerator writes the Go source of a model.
+type goGenerator struct {
+	flatten bool
+
+	// nClasses is the length of the probability vector of each leaf
+	// of a classification tree and 0 for regression trees.
+	nClasses int
+
+	// body receives the declarations following the imports.
+	body bytes.Buffer
+
+	// sets holds the category sets of the categorical splits
+	// generated so far.
+	sets []CategorySetSplitter
+
+	usesMath bool
+}
+
+// float returns a Go expression for x.
+func (g *goGenerator) float(x float64) string {
+	switch {
+	case math.IsNaN(x):
+		g.usesMath = true
+		return "math.NaN()"
+	case math.IsInf(x, 1):
+		g.usesMath = true
+		return "math.Inf(1)"
+	case math.IsInf(x, -1):
+		g.usesMath = true
+		return "math.Inf(-1)"
+	}
+	s := strconv.FormatFloat(x, 'g', -1, 64)
+	if !strings.ContainsAny(s, ".eE") {
+		s += ".0"
+	}
+	return s
+}
+
+// floats returns a Go expression for a []float64 holding x.
+func (g *goGenerator) floats(x []float64) string {
+	elements := make([]string, len(x))
+	for i, v := range x {
+		elements[i] = g.float(v)
+	}
+	return "[]float64{" + strings.Join(elements, ", ") + "}"
+}
+
+// set returns the name of the variable holding the category set s.
+func (g *goGenerator) set(s CategorySetSplitter) string {
+	g.sets = append(g.sets, s)
+	return fmt.Sprintf("set%d", len(g.sets)-1)
+}
+
+// leafValue returns a Go expression for the value of leaf n.
+func (g *goGenerator) leafValue(n *DecisionTreeNode) string {
+	if g.nClasses > 0 {
+		return g.floats(n.probabilities(g.nClasses))
+	}
+	return g.float(n.prediction)
+}
+
+// valueType is the Go type of the value of a tree.
+func (g *goGenerator) valueType() string {
+	if g.nClasses > 0 {
+		return "[]float64"
+	}
+	return "float64"
+}
+
+// test returns a Go expression that is true if splitter sends the
+// value of feature left (reversed if reverse is true).
+func (g *goGenerator) test(feature int, splitter Splitter, reverse bool) (string, error) {
+	var test string
+	switch s := splitter.(type) {
+	case NumericSplitter:
+		test = fmt.Sprintf("x[%d] < %s", feature, g.float(float64(s)))
+	case CategorySetSplitter:
+		test = fmt.Sprintf("contains(%s, x[%d])", g.set(s), feature)
+	default:
+		return "", fmt.Errorf("cannot generate Go for splitter type %T", splitter)
+	}
+	if reverse {
+		test = "!(" + test + ")"
+	}
+	return test, nil
+}
+
+// condition returns a Go expression that is true if unit x goes to
+// the left child of n, including units routed by surrogates.
+func (g *goGenerator) condition(n *DecisionTreeNode) (string, error) {
+	missing := strconv.FormatBool(n.missingLeft)
+	for s := len(n.surrogates) - 1; s >= 0; s-- {
+		surrogate := n.surrogates[s]
+		test, err := g.test(surrogate.feature, surrogate.splitter, surrogate.reverse)
+		if err != nil {
+			return "", err
+		}
+		missing = fmt.Sprintf("route(x[%d], %s, %s)", surrogate.feature, test, missing)
+	}
+	test, err := g.test(n.feature, n.splitter, false)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("route(x[%d], %s, %s)", n.feature, test, missing), nil
+}
+
+// writeNested writes tree t as a function of nested if statements.
+func (g *goGenerator) writeNested(t int, root *DecisionTreeNode) error {
+	fmt.Fprintf(&g.body, "func tree%d(x []float64) %s {\n", t, g.valueType())
+	var write func(n *DecisionTreeNode) error
+	write = func(n *DecisionTreeNode) error {
+		if n.feature < 0 {
+			fmt.Fprintf(&g.body, "return %s\n", g.leafValue(n))
+			return nil
+		}
+		condition, err := g.condition(n)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(&g.body, "if %s {\n", condition)
+		if err := write(n.Left); err != nil {
+			return err
+		}
+		fmt.Fprintf(&g.body, "}\n")
+		return write(n.Right)
+	}
+	if err := write(root); err != nil {
+		return err
+	}
+	fmt.Fprintf(&g.body, "}\n\n")
+	return nil
+}
+
+// split returns a Go composite literal of type split for splitter.
+func (g *goGenerator) split(feature int, splitter Splitter, reverse bool) (string, error) {
+	switch s := splitter.(type) {
+	case NumericSplitter:
+		return fmt.Sprintf("split{%d, %s, nil, %t}", feature, g.float(float64(s)), reverse), nil
+	case CategorySetSplitter:
+		return fmt.Sprintf("split{%d, 0, %s, %t}", feature, g.set(s), reverse), nil
+	}
+	return "", fmt.Errorf("cannot generate Go for splitter type %T", splitter)
+}
+
+// writeFlat writes the nodes of trees as a table.
+func (g *goGenerator) writeFlat(trees []*DecisionTreeNode) error {
+	var nodes []string
+	roots := make([]string, len(trees))
+
+	// add appends n and the nodes below it to nodes and returns
+	// the index of n.
+	var add func(n *DecisionTreeNode) (int, error)
+	add = func(n *DecisionTreeNode) (int, error) {
+		index := len(nodes)
+		nodes = append(nodes, "")
+		if n.feature < 0 {
+			nodes[index] = fmt.Sprintf("{split{-1, 0, nil, false}, false, nil, 0, 0, %s}", g.leafValue(n))
+			return index, nil
+		}
+
+		primary, err := g.split(n.feature, n.splitter, false)
+		if err != nil {
+			return 0, err
+		}
+		surrogates := "nil"
+		if len(n.surrogates) > 0 {
+			splits := make([]string, len(n.surrogates))
+			for s, surrogate := range n.surrogates {
+				if splits[s], err = g.split(surrogate.feature, surrogate.splitter, surrogate.reverse); err != nil {
+					return 0, err
+				}
+			}
+			surrogates = "[]split{" + strings.Join(splits, ", ") + "}"
+		}
+		left, err := add(n.Left)
+		if err != nil {
+			return 0, err
+		}
+		right, err := add(n.Right)
+		if err != nil {
+			return 0, err
+		}
+		var zero string
+		if g.nClasses > 0 {
+			zero = "nil"
+		} else {
+			zero = "0"
+		}
+		nodes[index] = fmt.Sprintf("{%s, %t, %s, %d, %d, %s}", primary, n.missingLeft, surrogates, left, right, zero)
+		return index, nil
+	}
+
+	for t, tree := range trees {
+		root, err := add(tree)
+		if err != nil {
+			return err
+		}
+		roots[t] = strconv.Itoa(root)
+	}
+
+	fmt.Fprintf(&g.body, `// split sends a unit left if the value of its feature is less than
+// threshold (numeric splits) or is in set (categorical splits),
+// unless reverse is true.
+type split struct {
+	feature   int
+	threshold float64
+	set       []int
+	reverse   bool
+}
+
+func (s *split) goesLeft(x []float64) bool {
+	if s.set != nil {
+		return contains(s.set, x[s.feature]) != s.reverse
+	}
+	return (x[s.feature] < s.threshold) != s.reverse
+}
+
+// node is a node of a tree.  The feature of a leaf is -1.  Units whose
+// feature value is missing are routed by the first surrogate whose
+// feature is present or, failing that, by missingLeft.
+type node struct {
+	split
+	missingLeft bool
+	surrogates  []split
+	left, right int
+	value       %s
+}
+
+func tree(t int, x []float64) %s {
+	n := &nodes[roots[t]]
+	for n.feature >= 0 {
+		left := n.missingLeft
+		if v := x[n.feature]; v == v {
+			left = n.goesLeft(x)
+		} else {
+			for s := range n.surrogates {
+				if v := x[n.surrogates[s].feature]; v == v {
+					left = n.surrogates[s].goesLeft(x)
+					break
+				}
+			}
+		}
+		if left {
+			n = &nodes[n.left]
+		} else {
+			n = &nodes[n.right]
+		}
+	}
+	return n.value
+}
+
+var roots = []int{%s}
+
+var nodes = []node{
+%s,
+}
+
+`, g.valueType(), g.valueType(), strings.Join(roots, ", "), strings.Join(nodes, ",\n"))
+	return nil
+}
+
+// writeTrees writes the constant nTrees and the function tree(t, x),
+// which returns the value of the leaf of tree t reached by x.
+func (g *goGenerator) writeTrees(trees []*DecisionTreeNode) error {
+	fmt.Fprintf(&g.body, "// nTrees is the number of trees of the model.\nconst nTrees = %d\n\n", len(trees))
+	if g.flatten {
+		return g.writeFlat(trees)
+	}
+
+	for t, tree := range trees {
+		if err := g.writeNested(t, tree); err != nil {
+			return err
+		}
+	}
+	names := make([]string, len(trees))
+	for t := range names {
+		names[t] = fmt.Sprintf("tree%d", t)
+	}
+	fmt.Fprintf(&g.body, `var trees = []func([]float64) %s{%s}
+
+func tree(t int, x []float64) %s { return trees[t](x) }
+
+// route returns left unless v is missing, in which case it returns
+// missing.
+func route(v float64, left, missing bool) bool {
+	if v != v {
+		return missing
+	}
+	return left
+}
+
+`, g.valueType(), strings.Join(names, ", "), g.valueType())
+	return nil
+}
+
+// writeGo writes the generated source of a model to w.  description
+// describes the model in the package comment and predict holds the
+// declarations of the exported prediction functions.
+func (g *goGenerator) writeGo(w io.Writer, pkg, description string, schema featureSchema, classes []string, trees []*DecisionTreeNode, predict string) error {
+	if err := g.writeTrees(trees); err != nil {
+		return err
+	}
+	g.body.WriteString(predict)
+
+	var source bytes.Buffer
+	fmt.Fprintf(&source, "// Code generated by DragonBlood. DO NOT EDIT.\n\n")
+	fmt.Fprintf(&source, "// Package %s predicts with %s.\n", pkg, description)
+	fmt.Fprintf(&source, "package %s\n\n", pkg)
+	if g.usesMath {
+		fmt.Fprintf(&source, "import \"math\"\n\n")
+	}
+
+	fmt.Fprintf(&source, "// FeatureNames are the names of the features in the order in which\n")
+	fmt.Fprintf(&source, "// Predict expects their values.\n")
+	fmt.Fprintf(&source, "var FeatureNames = %#v\n\n", schema.names)
+
+	categories := make([]string, len(schema.names))
+	for j := range categories {
+		categories[j] = "nil"
+		if j < len(schema.tables) && schema.tables[j] != nil {
+			categories[j] = fmt.Sprintf("%#v", stringTableStrings(schema.tables[j], -1))
+		}
+	}
+	fmt.Fprintf(&source, "// Categories holds the categories of each categorical feature in\n")
+	fmt.Fprintf(&source, "// code order (nil for numeric features).\n")
+	fmt.Fprintf(&source, "var Categories = [][]string{%s}\n\n", strings.Join(categories, ", "))
+
+	if classes != nil {
+		fmt.Fprintf(&source, "// Classes holds the class labels in code order.\n")
+		fmt.Fprintf(&source, "var Classes = %#v\n\n", classes)
+	}
+
+	source.Write(g.body.Bytes())
+
+	for s, set := range g.sets {
+		fmt.Fprintf(&source, "var set%d = %#v\n", s, []int(set))
+	}
+	fmt.Fprintf(&source, `
+// contains returns true if the category code v is in set.
+func contains(set []int, v float64) bool {
+	for _, code := range set {
+		if float64(code) == v {
+			return true
+		}
+	}
+	return false
+}
+`)
+
+	formatted, err := format.Source(source.Bytes())
+	if err != nil {
+		return fmt.Errorf("generated invalid Go: %v", err)
+	}
+	_, err = w.Write(formatted)
+	return err
+}
+
+// stringTableStrings returns the first n strings of table in code
+// order, or all of them if n is negative.
+func stringTableStrings(table StringTable, n int) []string {
+	if n < 0 {
+		n = table.Len()
+	}
+	result := make([]string, n)
+	for i := range result {
+		result[i] = table.Decode(i)
+	}
+	return result
+}
+
+// meanRegression declares Predict as the mean value of the trees.
+const meanRegression = `
+// Predict returns the prediction for the feature values x.
+func Predict(x []float64) float64 {
+	result := 0.0
+	for t := 0; t < nTrees; t++ {
+		result += (tree(t, x) - result) / float64(t+1)
+	}
+	return result
+}
+`
+
+// meanClassification declares PredictProba as the mean probabilities
+// of the trees.
+const meanClassification = `
+// PredictProba returns the class probabilities for the feature
+// values x, indexed by class code.
+func PredictProba(x []float64) []float64 {
+	result := make([]float64, len(Classes))
+	for t := 0; t < nTrees; t++ {
+		for k, p := range tree(t, x) {
+			result[k] += (p - result[k]) / float64(t+1)
+		}
+	}
+	return result
+}
+` + predictClass
+
+// predictClass declares Predict in terms of PredictProba.
+const predictClass = `
+// Predict returns the most probable class for the feature values x.
+func Predict(x []float64) string {
+	p := PredictProba(x)
+	best := 0
+	for k := range p {
+		if p[k] > p[best] {
+			best = k
+		}
+	}
+	return Classes[best]
+}
+`
+
+// WriteGo writes standalone Go source for package pkg that predicts
+// with the tree.  The generated package depends only on the standard
+// library and exports
+//
+//	FeatureNames  the names of the features, in the order in which
+//	              Predict expects their values
+//	Categories    the categories of each categorical feature in code
+//	              order (nil for numeric features)
+//	Predict       for regressors, func(x []float64) float64
+//
+// and, for classifiers,
+//
+//	Classes       the class labels in code order
+//	PredictProba  func(x []float64) []float64, the class probabilities
+//	              indexed by class code
+//	Predict       func(x []float64) string, the most probable class
+//
+// x[j] is the value of feature j: the code of its category (see
+// Categories) for categorical features, or NaN if the value is
+// missing.  Predictions are identical to those of the model.
+//
+// Each tree is generated as a function of nested if statements
+// unless flatten is true, in which case the nodes of all the trees
+// are generated as a single table evaluated by a loop, which compiles
+// much faster for large forests.
+func (dtr *DecisionTree) WriteGo(w io.Writer, pkg string, flatten bool) error {
+	g := &goGenerator{flatten: flatten}
+	return g.writeGo(w, pkg, fmt.Sprintf("a regression tree trained with seed %d", dtr.seed), dtr.featureSchema, nil, []*DecisionTreeNode{dtr.root}, meanRegression)
+}
+
+// WriteGo writes standalone Go source for package pkg that predicts
+// with the tree.  See DecisionTree.WriteGo.
+func (dtc *DecisionTreeClassifier) WriteGo(w io.Writer, pkg string, flatten bool) error {
+	g := &goGenerator{flatten: flatten, nClasses: dtc.nClasses}
+	return g.writeGo(w, pkg, fmt.Sprintf("a classification tree trained with seed %d", dtc.seed), dtc.featureSchema, stringTableStrings(dtc.classes, dtc.nClasses), []*DecisionTreeNode{dtc.root}, meanClassification)
+}
+
+// WriteGo writes standalone Go source for package pkg that predicts
+// with the forest.  See DecisionTree.WriteGo.
+func (rf *RandomForestRegressor) WriteGo(w io.Writer, pkg string, flatten bool) error {
+	g := &goGenerator{flatten: flatten}
+	return g.writeGo(w, pkg, fmt.Sprintf("a forest of %d regression trees trained with seed %d", len(rf.trees), rf.seed), rf.featureSchema, nil, rf.trees, meanRegression)
+}
+
+// WriteGo writes standalone Go source for package pkg that predicts
+// with the forest.  See DecisionTree.WriteGo.
+func (rf *RandomForestClassifier) WriteGo(w io.Writer, pkg string, flatten bool) error {
+	g := &goGenerator{flatten: flatten, nClasses: rf.nClasses}
+	return g.writeGo(w, pkg, fmt.Sprintf("a forest of %d classification trees trained with seed %d", len(rf.trees), rf.seed), rf.featureSchema, stringTableStrings(rf.classes, rf.nClasses), rf.trees, meanClassification)
+}
+
+// boostedScores declares scores, which returns the scores of a
+// boosted model, in terms of initial, rate, and outputs.
+func (gb *gradientBoosting) boostedScores(g *goGenerator) string {
+	return fmt.Sprintf(`
+const rate = %s
+
+// scores returns the scores of x.  Tree t adds to score t %% %d.
+func scores(x []float64) []float64 {
+	result := %s
+	for t := 0; t < nTrees; t++ {
+		result[t%%%d] += rate * tree(t, x)
+	}
+	return result
+}
+`, g.float(gb.grower.boosting.LearningRate), len(gb.initial), g.floats(gb.initial), len(gb.initial))
+}
+
+// flatTrees returns the trees of the model in the order in which they
+// were grown.
+func (gb *gradientBoosting) flatTrees() []*DecisionTreeNode {
+	var trees []*DecisionTreeNode
+	for _, iterationTrees := range gb.trees {
+		trees = append(trees, iterationTrees...)
+	}
+	return trees
+}
+
+// WriteGo writes standalone Go source for package pkg that predicts
+// with the model.  See DecisionTree.WriteGo.
+func (gb *GradientBoostingRegressor) WriteGo(w io.Writer, pkg string, flatten bool) error {
+	g := &goGenerator{flatten: flatten}
+	predict := gb.boostedScores(g) + `
+// Predict returns the prediction for the feature values x.
+func Predict(x []float64) float64 { return scores(x)[0] }
+`
+	return g.writeGo(w, pkg, fmt.Sprintf("a gradient boosted regressor of %d iterations trained with seed %d", len(gb.trees), gb.seed), gb.featureSchema, nil, gb.flatTrees(), predict)
+}
+
+// WriteGo writes standalone Go source for package pkg that predicts
+// with the model.  See DecisionTree.WriteGo.
+func (gb *GradientBoostingClassifier) WriteGo(w io.Writer, pkg string, flatten bool) error {
+	g := &goGenerator{flatten: flatten, usesMath: true}
+	predict := gb.boostedScores(g) + `
+// PredictProba returns the class probabilities for the feature
+// values x, indexed by class code.
+func PredictProba(x []float64) []float64 {
+	s := scores(x)
+	result := make([]float64, len(Classes))
+	if len(s) == 1 {
+		p := 1.0 / (1.0 + math.Exp(-s[0]))
+		result[0] = 1.0 - p
+		if len(result) > 1 {
+			result[1] = p
+		}
+		return result
+	}
+
+	max := math.Inf(-1)
+	for _, v := range s {
+		max = math.Max(max, v)
+	}
+	total := 0.0
+	for k, v := range s {
+		result[k] = math.Exp(v - max)
+		total += result[k]
+	}
+	for k := range result {
+		result[k] /= total
+	}
+	return result
+}
+` + predictClass
+	return g.writeGo(w, pkg, fmt.Sprintf("a gradient boosted classifier of %d iterations trained with seed %d", len(gb.trees), gb.seed), gb.featureSchema, stringTableStrings(gb.classes, gb.nClasses), gb.flatTrees(), predict)
+}
@@ -0,0 +1,147 @@
+package DragonBlood_test
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math"
+	"math/rand"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	db "github.com/mawicks/DragonBlood"
+)
+
+func TestWriteGo(test *testing.T) {
+	if testing.Short() {
+		test.Skip("skipping compilation of generated code in short mode")
+	}
+	goTool, err := exec.LookPath("go")
+	if err != nil {
+		test.Skip("go tool not found")
+	}
+
+	rng := rand.New(rand.NewSource(13))
+	x := db.NewNumericFeature(nil)
+	y := db.NewNumericFeature(nil)
+	c := db.NewCategoricalFeature(db.NewStringTable())
+	t := db.NewNumericFeature(nil)
+	class := db.NewCategoricalFeature(db.NewStringTable())
+	for i := 0; i < 80; i++ {
+		xi, yi := rng.Float64(), rng.Float64()
+		ci := []string{"a", "b", "c", "d"}[rng.Intn(4)]
+		ti := xi + yi + rng.NormFloat64()/10
+		if ci == "a" || ci == "c" {
+			ti += 1
+		}
+		if rng.Intn(8) == 0 {
+			xi = math.NaN()
+		}
+		x.Add(xi)
+		y.Add(yi)
+		c.AddFromString(ci)
+		t.Add(ti)
+		class.AddFromString([]string{"low", "mid", "high"}[int(math.Min(ti, 2.9))])
+	}
+	features := []db.OrderedFeature{x, c, y}
+	unordered := []db.Feature{x, c, y}
+
+	dt := db.NewDecisionTreeRegressor(db.WithSurrogates(2), db.WithSeed(1))
+	dt.Fit(features, t)
+	dtc := db.NewDecisionTreeClassifier(db.Gini, db.WithSurrogates(1), db.WithSeed(1))
+	dtc.Fit(features, class)
+	rf := db.NewRandomForestRegressor(5, db.WithSeed(1))
+	rf.Fit(features, t)
+	rfc := db.NewRandomForestClassifier(5, db.Entropy, db.WithSeed(1))
+	rfc.Fit(features, class)
+	gb := db.NewGradientBoostingRegressor(10, db.WithSeed(1))
+	gb.Fit(features, t)
+	gbc := db.NewGradientBoostingClassifier(10, db.WithSeed(1))
+	gbc.Fit(features, class)
+
+	type regressor interface {
+		WriteGo(io.Writer, string, bool) error
+		Predict([]db.Feature) []float64
+	}
+	type classifier interface {
+		WriteGo(io.Writer, string, bool) error
+		PredictProba([]db.Feature) [][]float64
+		Predict([]db.Feature) []string
+	}
+
+	// Each model is generated as a package that prints its
+	// predictions for the training units, which must match those of
+	// the model.
+	dir := test.TempDir()
+	var imports, calls, expected bytes.Buffer
+	write := func(name string, model interface {
+		WriteGo(io.Writer, string, bool) error
+	}, flatten bool) {
+		pkg := fmt.Sprintf("%s%t", name, flatten)
+		var source bytes.Buffer
+		if err := model.WriteGo(&source, pkg, flatten); err != nil {
+			test.Fatalf("%s: WriteGo returned %v", pkg, err)
+		}
+		if err := os.MkdirAll(filepath.Join(dir, pkg), 0o755); err != nil {
+			test.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, pkg, "model.go"), source.Bytes(), 0o644); err != nil {
+			test.Fatal(err)
+		}
+		fmt.Fprintf(&imports, "\t%q\n", "generated/"+pkg)
+
+		switch m := model.(type) {
+		case regressor:
+			fmt.Fprintf(&calls, "\tfor _, x := range inputs { fmt.Println(%s.Predict(x)) }\n", pkg)
+			for _, p := range m.Predict(unordered) {
+				fmt.Fprintln(&expected, p)
+			}
+		case classifier:
+			fmt.Fprintf(&calls, "\tfor _, x := range inputs { fmt.Println(%s.PredictProba(x), %s.Predict(x)) }\n", pkg, pkg)
+			labels := m.Predict(unordered)
+			for i, p := range m.PredictProba(unordered) {
+				fmt.Fprintln(&expected, p, labels[i])
+			}
+		}
+	}
+	for _, flatten := range []bool{false, true} {
+		write("dt", dt, flatten)
+		write("dtc", dtc, flatten)
+		write("rf", rf, flatten)
+		write("rfc", rfc, flatten)
+		write("gb", gb, flatten)
+		write("gbc", gbc, flatten)
+	}
+
+	var inputs bytes.Buffer
+	for i := 0; i < t.Len(); i++ {
+		fmt.Fprintf(&inputs, "\t{math.Float64frombits(%d), %v, %v},\n", math.Float64bits(x.NumericValue(i)), c.NumericValue(i), y.NumericValue(i))
+	}
+	main := fmt.Sprintf("package main\n\nimport (\n\t\"fmt\"\n\t\"math\"\n\n%s)\n\nvar inputs = [][]float64{\n%s}\n\nfunc main() {\n%s}\n", imports.String(), inputs.String(), calls.String())
+	for name, content := range map[string]string{"main.go": main, "go.mod": "module generated\n"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			test.Fatal(err)
+		}
+	}
+
+	cmd := exec.Command(goTool, "run", ".")
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), "GO111MODULE=on", "GOFLAGS=", "GOPROXY=off")
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		test.Fatalf("go run failed: %v\n%s", err, output)
+	}
+
+	got, want := strings.Split(string(output), "\n"), strings.Split(expected.String(), "\n")
+	if len(got) != len(want) {
+		test.Fatalf("Generated code printed %d lines; expected %d", len(got), len(want))
+	}
+	for i := range got {
+		if got[i] != want[i] {
+			test.Errorf("Line %d: generated code printed %q; model predicted %q", i, got[i], want[i])
+		}
+	}
+}
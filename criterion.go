@@ -0,0 +1,307 @@
+package DragonBlood
+
+import (
+	"math"
+
+	"github.com/mawicks/DragonBlood/stats"
+)
+
+// SplitAccumulator evaluates candidate splits of a single node.  All
+// target values in the node are passed to Add() in the reverse of
+// feature order, then passed again to Move() in feature order, each
+// with the weight of its unit.  BestSplit() returns the best split
+// seen or nil if no split satisfies the accumulator's constraints.
+type SplitAccumulator interface {
+	Add(targetValue, weight float64)
+	Move(featureValue, targetValue, weight float64)
+	BestSplit() *SplitInfo
+}
+
+// SplitCriterion defines the loss minimized by a decision tree.  It
+// creates the accumulators used to search for splits and computes the
+// value assigned to a node.
+type SplitCriterion interface {
+	// NewAccumulator returns an accumulator for evaluating the splits
+	// of one node.  minLeafSize is the minimum weight of a leaf.
+	NewAccumulator(minLeafSize float64) SplitAccumulator
+
+	// LeafMetric returns the size, weight, and prediction of a node
+	// containing targets with the corresponding weights.  A nil
+	// weights is equivalent to unit weights.
+	LeafMetric(targets, weights []float64) Metric
+}
+
+// impurityCriterion is implemented by the SplitCriterions that report
+// the impurity of a node, which the cost-complexity path of a tree
+// requires.
+type impurityCriterion interface {
+	// impurity returns the size-weighted impurity of a node
+	// containing targets with the corresponding weights, in the
+	// units of the reductions of the criterion's splits.
+	impurity(targets, weights []float64) float64
+}
+
+// NodeStatistics are sufficient statistics for the target values in a
+// node that can be updated as values enter and leave the node.  A new
+// impurity measure can be implemented as NodeStatistics and evaluated
+// with NewScanAccumulator().
+type NodeStatistics interface {
+	Add(targetValue, weight float64)
+	Subtract(targetValue, weight float64)
+	Count() int
+	Weight() float64
+
+	// Impurity is the impurity of the node weighted by its weight, so
+	// that impurities of sibling nodes may be summed.  It may be
+	// offset by any amount that depends only on the union of the
+	// siblings.
+	Impurity() float64
+
+	// Metric returns the size and prediction for the node.
+	Metric() Metric
+}
+
+// scanAccumulator is a SplitAccumulator that evaluates each split as
+// the sum of the impurities of the left and right NodeStatistics.
+type scanAccumulator struct {
+	minLeafSize          float64
+	previousFeatureValue float64
+	left, right          NodeStatistics
+
+	bestMetric     float64
+	bestSplitValue float64
+
+	bestLeft  Metric
+	bestRight Metric
+
+	initialMetric float64
+}
+
+// NewScanAccumulator returns a SplitAccumulator that selects the split
+// minimizing the sum of the impurities of left and right, which must
+// be empty NodeStatistics of the same type.
+func NewScanAccumulator(minLeafSize float64, left, right NodeStatistics) SplitAccumulator {
+	return &scanAccumulator{
+		minLeafSize:          minLeafSize,
+		previousFeatureValue: math.Inf(-1),
+		left:                 left,
+		right:                right,
+		bestMetric:           math.Inf(1),
+	}
+}
+
+func (a *scanAccumulator) Add(targetValue, weight float64) {
+	a.right.Add(targetValue, weight)
+}
+
+func (a *scanAccumulator) Move(featureValue, targetValue, weight float64) {
+	if a.left.Count() == 0 {
+		a.initialMetric = a.right.Impurity()
+		a.bestMetric = a.initialMetric
+	}
+	if featureValue != a.previousFeatureValue { // End of a run of identical values
+		metric := a.left.Impurity() + a.right.Impurity()
+		if metric < a.bestMetric && a.left.Count() > 0 && a.right.Count() > 0 && a.left.Weight() >= a.minLeafSize && a.right.Weight() >= a.minLeafSize {
+			a.bestMetric = metric
+			a.bestSplitValue = splitThreshold(a.previousFeatureValue, featureValue)
+			a.bestLeft = a.left.Metric()
+			a.bestRight = a.right.Metric()
+		}
+		a.previousFeatureValue = featureValue
+	}
+
+	a.right.Subtract(targetValue, weight)
+	a.left.Add(targetValue, weight)
+}
+
+func (a *scanAccumulator) BestSplit() *SplitInfo {
+	var result *SplitInfo
+
+	if a.right.Count() != 0 {
+		panic("BestSplit() called prematurely (fewer Move() calls than Add() calls)")
+	}
+
+	if a.bestLeft.size != 0 && a.bestRight.size != 0 {
+		result = &SplitInfo{
+			splitter:  NumericSplitter(a.bestSplitValue),
+			reduction: a.initialMetric - a.bestMetric,
+			left:      a.bestLeft,
+			right:     a.bestRight,
+		}
+	}
+	return result
+}
+
+// MSECriterion grows regression trees that minimize squared error.
+// Leaves predict the mean of their targets.
+type MSECriterion struct{}
+
+func (MSECriterion) NewAccumulator(minLeafSize float64) SplitAccumulator {
+	return NewMSEAccumulator(minLeafSize)
+}
+
+func (MSECriterion) LeafMetric(targets, weights []float64) Metric {
+	weights = unitWeights(targets, weights)
+	acc := stats.NewWeightedMeanAccumulator()
+	for i, t := range targets {
+		acc.Add(t, weights[i])
+	}
+	return Metric{size: acc.Count(), weight: acc.Weight(), prediction: acc.Mean()}
+}
+
+// impurity is the weighted sum of squared errors about the mean.
+func (MSECriterion) impurity(targets, weights []float64) float64 {
+	weights = unitWeights(targets, weights)
+	acc := stats.NewWeightedVarianceAccumulator()
+	for i, t := range targets {
+		acc.Add(t, weights[i])
+	}
+	return acc.Value()
+}
+
+// unitWeights returns weights or, if weights is nil, a slice of ones
+// the length of targets.
+func unitWeights(targets, weights []float64) []float64 {
+	if weights == nil {
+		weights = make([]float64, len(targets))
+		for i := range weights {
+			weights[i] = 1.0
+		}
+	}
+	return weights
+}
+
+// FriedmanMSECriterion grows regression trees that minimize squared
+// error, scoring splits with Friedman's improvement
+//
+//	wL*wR/(wL+wR) * (meanL - meanR)^2
+//
+// which is computed from sums alone and so avoids the roundoff that
+// removing points accrues in the squared error.
+type FriedmanMSECriterion struct{}
+
+func (FriedmanMSECriterion) NewAccumulator(minLeafSize float64) SplitAccumulator {
+	return NewScanAccumulator(minLeafSize, &sumStatistics{}, &sumStatistics{})
+}
+
+func (FriedmanMSECriterion) LeafMetric(targets, weights []float64) Metric {
+	return MSECriterion{}.LeafMetric(targets, weights)
+}
+
+// impurity is the squared error, which Friedman's improvement reduces
+// by the same amount as the squared error criterion.
+func (FriedmanMSECriterion) impurity(targets, weights []float64) float64 {
+	return MSECriterion{}.impurity(targets, weights)
+}
+
+// sumStatistics implements NodeStatistics for FriedmanMSECriterion.
+// Its impurity is the squared error less the node's sum of squared
+// targets, which cancels in the comparison of sibling splits.
+type sumStatistics struct {
+	count  int
+	weight float64
+	sum    float64
+}
+
+func (s *sumStatistics) Add(targetValue, weight float64) {
+	s.count += 1
+	s.weight += weight
+	s.sum += weight * targetValue
+}
+
+func (s *sumStatistics) Subtract(targetValue, weight float64) {
+	if s.count == 0 {
+		panic("Subtract() called more than Add()")
+	} else if s.count > 1 {
+		s.count -= 1
+		s.weight -= weight
+		s.sum -= weight * targetValue
+	} else {
+		*s = sumStatistics{}
+	}
+}
+
+func (s *sumStatistics) Count() int { return s.count }
+
+func (s *sumStatistics) Weight() float64 { return s.weight }
+
+func (s *sumStatistics) Impurity() float64 {
+	if s.weight <= 0 {
+		return 0.0
+	}
+	return -s.sum * s.sum / s.weight
+}
+
+func (s *sumStatistics) Metric() Metric {
+	return Metric{size: s.count, weight: s.weight, prediction: s.sum / s.weight}
+}
+
+// PoissonCriterion grows regression trees for non-negative targets
+// such as counts or frequencies that minimize the half Poisson
+// deviance.  Leaves predict the mean of their targets.  Splits that
+// produce a node whose targets are all zero are never selected
+// because such a node predicts a zero rate.
+type PoissonCriterion struct{}
+
+func (PoissonCriterion) NewAccumulator(minLeafSize float64) SplitAccumulator {
+	return NewScanAccumulator(minLeafSize, &poissonStatistics{}, &poissonStatistics{})
+}
+
+func (PoissonCriterion) LeafMetric(targets, weights []float64) Metric {
+	return MSECriterion{}.LeafMetric(targets, weights)
+}
+
+// impurity is the half Poisson deviance of the node, which is zero
+// if its targets are all zero.
+func (PoissonCriterion) impurity(targets, weights []float64) float64 {
+	weights = unitWeights(targets, weights)
+	p := &poissonStatistics{}
+	for i, t := range targets {
+		p.Add(t, weights[i])
+	}
+	if p.sum <= 0 {
+		return 0.0
+	}
+	return p.Impurity()
+}
+
+// poissonStatistics implements NodeStatistics for PoissonCriterion.
+type poissonStatistics struct {
+	sumStatistics
+	sumYLogY float64
+}
+
+func yLogY(y float64) float64 {
+	if y > 0 {
+		return y * math.Log(y)
+	}
+	return 0.0
+}
+
+func (p *poissonStatistics) Add(targetValue, weight float64) {
+	if targetValue < 0 {
+		panic("PoissonCriterion requires non-negative targets")
+	}
+	p.sumStatistics.Add(targetValue, weight)
+	p.sumYLogY += weight * yLogY(targetValue)
+}
+
+func (p *poissonStatistics) Subtract(targetValue, weight float64) {
+	p.sumStatistics.Subtract(targetValue, weight)
+	if p.count == 0 {
+		p.sumYLogY = 0.0
+	} else {
+		p.sumYLogY -= weight * yLogY(targetValue)
+	}
+}
+
+// Impurity is the half Poisson deviance sum(y*log(y/mean)) of the node.
+func (p *poissonStatistics) Impurity() float64 {
+	if p.weight <= 0 {
+		return 0.0
+	}
+	if p.sum <= 0 {
+		return math.Inf(1)
+	}
+	return math.Max(p.sumYLogY-p.sum*math.Log(p.sum/p.weight), 0.0)
+}
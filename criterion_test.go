@@ -0,0 +1,57 @@
+package DragonBlood_test
+
+import (
+	"testing"
+
+	db "github.com/mawicks/DragonBlood"
+)
+
+func TestSplitCriteria(test *testing.T) {
+	x := db.NewNumericFeature(nil)
+	x.Add(0, 1, 2, 3, 4, 5, 6, 7)
+
+	y := db.NewNumericFeature(nil)
+	y.Add(1, 2, 1, 2, 1, 2, 1, 2)
+
+	t := db.NewNumericFeature(nil)
+	t.Add(3, 4, 3, 1, 7, 6, 5, 2)
+
+	criteria := []db.SplitCriterion{
+		db.MSECriterion{},
+		db.FriedmanMSECriterion{},
+		db.MAECriterion{},
+		db.HuberCriterion{Delta: 1.0},
+		db.PoissonCriterion{},
+	}
+
+	for _, criterion := range criteria {
+		dt := db.NewDecisionTreeRegressor(db.WithCriterion(criterion))
+		dt.Fit([]db.OrderedFeature{x, y}, t)
+
+		for i, te := range dt.Predict([]db.Feature{x, y}) {
+			if te != t.Value(i) {
+				test.Errorf("%T: row %d: predicted %v; actual %v", criterion, i, te, t.Value(i))
+			}
+		}
+	}
+}
+
+func TestRobustLeafMetrics(test *testing.T) {
+	// A single outlier shouldn't move the median
+	leaf := db.MAECriterion{}.LeafMetric([]float64{1, 1, 100, 1}, nil)
+	if leaf.Prediction() != 1.0 || leaf.Size() != 4 {
+		test.Errorf("MAE LeafMetric() returned prediction %v size %d; expected 1 and 4", leaf.Prediction(), leaf.Size())
+	}
+
+	// Median is 2; clipped residuals are -1, 0, 1, 1, 0
+	leaf = db.HuberCriterion{Delta: 1.0}.LeafMetric([]float64{1, 2, 3, 100, 2}, nil)
+	if expected := 2.2; leaf.Prediction() != expected {
+		test.Errorf("Huber LeafMetric() returned prediction %v; expected %v", leaf.Prediction(), expected)
+	}
+
+	// A heavy outlier moves the weighted median
+	leaf = db.MAECriterion{}.LeafMetric([]float64{1, 1, 100, 1}, []float64{1, 1, 4, 1})
+	if leaf.Prediction() != 100.0 || leaf.Weight() != 7.0 {
+		test.Errorf("weighted MAE LeafMetric() returned prediction %v weight %v; expected 100 and 7", leaf.Prediction(), leaf.Weight())
+	}
+}
@@ -0,0 +1,175 @@
+package DragonBlood
+
+import (
+	"fmt"
+	"math"
+)
+
+// nodeIDs numbers the nodes below n in preorder (a node, then the
+// nodes below its left child, then those below its right child),
+// starting with 0 at n.  These are the node ids written by ExportDOT.
+func (n *DecisionTreeNode) nodeIDs() map[*DecisionTreeNode]int {
+	ids := make(map[*DecisionTreeNode]int)
+	var number func(n *DecisionTreeNode)
+	number = func(n *DecisionTreeNode) {
+		ids[n] = len(ids)
+		if n.feature >= 0 {
+			number(n.Left)
+			number(n.Right)
+		}
+	}
+	number(n)
+	return ids
+}
+
+// Apply returns, for each unit of features, the id of the leaf of the
+// tree below n that it reaches.  Nodes are numbered in preorder from
+// 0 at n, as in ExportDOT.
+func (n *DecisionTreeNode) Apply(features []Feature) []int {
+	ids := n.nodeIDs()
+	result := make([]int, features[0].Len())
+	for i := range result {
+		result[i] = ids[n.leaf(features, i)]
+	}
+	return result
+}
+
+// applyTrees returns, for each unit of features, the id of the leaf
+// it reaches in each of trees, or -1 for nil trees.
+func applyTrees(trees []*DecisionTreeNode, features []Feature) [][]int {
+	result := make([][]int, features[0].Len())
+	for i := range result {
+		result[i] = make([]int, len(trees))
+	}
+	for t, tree := range trees {
+		if tree == nil {
+			for i := range result {
+				result[i][t] = -1
+			}
+			continue
+		}
+		for i, id := range tree.Apply(features) {
+			result[i][t] = id
+		}
+	}
+	return result
+}
+
+// Apply returns, for each unit of features, the id of the leaf it
+// reaches.  See DecisionTreeNode.Apply.
+func (dtr *DecisionTree) Apply(features []Feature) []int {
+	return dtr.root.Apply(features)
+}
+
+// Apply returns, for each unit of features, the id of the leaf it
+// reaches in each tree of the forest, indexed by unit and then by
+// tree, for use as a leaf embedding.  See DecisionTreeNode.Apply.
+func (rf *randomForest) Apply(features []Feature) [][]int {
+	return applyTrees(rf.trees, features)
+}
+
+// Apply returns, for each unit of features, the id of the leaf it
+// reaches in each tree of the model, indexed by unit and then by tree
+// in the order in which they were grown (for models with several
+// outputs, the trees of each iteration in order of output).  The
+// leaves reached are the usual features for stacking a linear model
+// on a boosted model.  See DecisionTreeNode.Apply.
+func (gb *gradientBoosting) Apply(features []Feature) [][]int {
+	return applyTrees(gb.flatTrees(), features)
+}
+
+// DecisionStep describes a node on the path of a unit through a tree.
+type DecisionStep struct {
+	// Node is the id of the node (see DecisionTreeNode.Apply).
+	Node int
+
+	// Prediction is the prediction of the node: the value of a
+	// regression node or the code of the majority class of a
+	// classification node.
+	Prediction float64
+
+	// Size is the number of training units that reached the node.
+	Size int
+
+	// Feature is the index of the feature split by the node, or -1 if
+	// the node is a leaf, in which case the remaining fields are unset.
+	Feature int
+
+	// FeatureName is the name of the feature split by the node.
+	FeatureName string
+
+	// Threshold is the threshold of a numeric split and NaN for other
+	// splits.
+	Threshold float64
+
+	// Value is the unit's value of the feature (NaN if missing).
+	Value float64
+
+	// Left is true if the unit went to the left child.
+	Left bool
+
+	// Condition describes the split as satisfied by the unit, e.g.,
+	// "age >= 40" if the unit went right from a split of age < 40, or
+	// "age is missing".
+	Condition string
+
+	// Surrogate describes the surrogate split that routed the unit if
+	// its value was missing.  It is empty if the direction learned for
+	// missing values routed the unit, or if the value was present.
+	Surrogate string
+}
+
+// decisionPath returns the path of unit i of features through the tree
+// below root.
+func (e *treeExporter) decisionPath(root *DecisionTreeNode, features []Feature, i int) []DecisionStep {
+	ids := root.nodeIDs()
+	var path []DecisionStep
+	for n := root; ; {
+		step := DecisionStep{Node: ids[n], Prediction: n.prediction, Size: n.size, Feature: n.feature}
+		if n.feature < 0 {
+			return append(path, step)
+		}
+
+		step.FeatureName = e.feature(n.feature)
+		step.Threshold = math.NaN()
+		if s, ok := n.splitter.(NumericSplitter); ok {
+			step.Threshold = float64(s)
+		}
+		step.Value = features[n.feature].NumericValue(i)
+		step.Left = n.splitLeft(features, i)
+		step.Condition = e.condition(n.feature, n.splitter, !step.Left)
+		if math.IsNaN(step.Value) {
+			step.Condition = step.FeatureName + " is missing"
+			for _, s := range n.surrogates {
+				if !math.IsNaN(features[s.feature].NumericValue(i)) {
+					step.Surrogate = e.condition(s.feature, s.splitter, s.reverse != !step.Left)
+					break
+				}
+			}
+		}
+		path = append(path, step)
+
+		if step.Left {
+			n = n.Left
+		} else {
+			n = n.Right
+		}
+	}
+}
+
+// DecisionPath returns the nodes visited by unit i of features, from
+// the root to the leaf, along with the splits that sent the unit on.
+// Features are named as in the training features.
+func (dtr *DecisionTree) DecisionPath(features []Feature, i int) []DecisionStep {
+	return newTreeExporter(dtr.featureSchema, nil, nil, 0).decisionPath(dtr.root, features, i)
+}
+
+// DecisionPath returns the nodes of tree t of the forest visited by
+// unit i of features.  See DecisionTree.DecisionPath.
+func (rf *randomForest) DecisionPath(features []Feature, i, t int) []DecisionStep {
+	tree := rf.tree(t)
+	if tree == nil {
+		panic(fmt.Sprintf("tree %d of the forest was not grown", t))
+	}
+	return newTreeExporter(rf.featureSchema, nil, nil, 0).decisionPath(tree, features, i)
+}
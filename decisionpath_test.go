@@ -0,0 +1,72 @@
+package DragonBlood_test
+
+import (
+	"math"
+	"testing"
+
+	db "github.com/mawicks/DragonBlood"
+)
+
+func TestApplyAndDecisionPath(test *testing.T) {
+	x := db.NewNumericFeature(nil)
+	x.Add(0, 1, 2, 3, 4, 5, 6, 7)
+	c := db.NewCategoricalFeature(db.NewStringTable())
+	c.AddFromString("red", "blue", "red", "blue", "red", "blue", "red", "blue")
+	t := db.NewNumericFeature(nil)
+	t.Add(0, 10, 0, 10, 20, 30, 20, 30)
+	features := []db.Feature{x, c}
+
+	dt := db.NewDecisionTreeRegressor(db.WithMaxDepth(2))
+	dt.Fit([]db.OrderedFeature{x, c}, t)
+
+	leaves := dt.Apply(features)
+	predictions := dt.Predict(features)
+	for i := range leaves {
+		for k := range leaves {
+			if (leaves[i] == leaves[k]) != (predictions[i] == predictions[k]) {
+				test.Errorf("Units %d and %d reach leaves %d and %d with predictions %v and %v", i, k, leaves[i], leaves[k], predictions[i], predictions[k])
+			}
+		}
+	}
+
+	path := dt.DecisionPath(features, 5)
+	if len(path) != 3 {
+		test.Fatalf("Path has %d steps; expected 3: %+v", len(path), path)
+	}
+	if path[0].Node != 0 || path[0].FeatureName != "feature_0" || path[0].Threshold != 3.5 || path[0].Left || path[0].Condition != "feature_0 >= 3.5" {
+		test.Errorf("First step is %+v; expected a right turn at feature_0 >= 3.5", path[0])
+	}
+	if path[1].FeatureName != "feature_1" || !math.IsNaN(path[1].Threshold) || path[1].Value != c.NumericValue(5) {
+		test.Errorf("Second step is %+v; expected a split of feature_1", path[1])
+	}
+	if last := path[2]; last.Feature != -1 || last.Node != leaves[5] || last.Prediction != 30 {
+		test.Errorf("Last step is %+v; expected leaf %d with prediction 30", last, leaves[5])
+	}
+
+	missing := db.NewNumericFeature(nil)
+	missing.Add(math.NaN())
+	blue := db.NewCategoricalFeature(dt.FeatureStringTable(1))
+	blue.AddFromString("blue")
+	if path := dt.DecisionPath([]db.Feature{missing, blue}, 0); path[0].Condition != "feature_0 is missing" || path[0].Surrogate != "" {
+		test.Errorf("First step for a missing value is %+v", path[0])
+	}
+
+	rf := db.NewRandomForestRegressor(4, db.WithSeed(2))
+	rf.Fit([]db.OrderedFeature{x, c}, t)
+	embedding := rf.Apply(features)
+	if len(embedding) != x.Len() || len(embedding[0]) != 4 {
+		test.Fatalf("Apply returned %d by %d ids; expected %d by 4", len(embedding), len(embedding[0]), x.Len())
+	}
+	for tree := 0; tree < 4; tree++ {
+		path := rf.DecisionPath(features, 3, tree)
+		if leaf := path[len(path)-1]; leaf.Node != embedding[3][tree] {
+			test.Errorf("Tree %d: path ends at node %d; Apply returned %d", tree, leaf.Node, embedding[3][tree])
+		}
+	}
+
+	gb := db.NewGradientBoostingRegressor(3, db.WithSeed(2))
+	gb.Fit([]db.OrderedFeature{x, c}, t)
+	if embedding := gb.Apply(features); len(embedding) != x.Len() || len(embedding[0]) != 3 {
+		test.Errorf("Apply returned %d by %d ids for a boosted model; expected %d by 3", len(embedding), len(embedding[0]), x.Len())
+	}
+}
@@ -3,10 +3,8 @@ package DragonBlood
 import (
 	"fmt"
 	"io"
-	"log"
 	"math"
 	"math/rand"
-	"os"
 
 	"github.com/mawicks/DragonBlood/stats"
 )
@@ -25,11 +23,46 @@ type NumericSplitter float64
 func (s NumericSplitter) Split(x float64) bool { return x < float64(s) }
 func (s NumericSplitter) String() string       { return fmt.Sprintf("< %g", float64(s)) }
 
+// splitThreshold returns a threshold that separates lower from upper,
+// which is greater: their midpoint, unless rounding makes it equal to
+// lower, as it can for adjacent floating point values, in which case
+// it is upper.  Missing values are scanned as -Inf or +Inf, and the
+// infinite midpoint of a split between missing and present values
+// sends every present value the same way.
+func splitThreshold(lower, upper float64) float64 {
+	mid := 0.5 * (lower + upper)
+	if mid > lower || math.IsInf(lower, 0) || math.IsInf(upper, 0) {
+		return mid
+	}
+	return upper
+}
+
 type Metric struct {
 	size       int
+	weight     float64
 	prediction float64
+
+	// distribution holds the per-class counts of a classification
+	// node, indexed by class code.  It is nil for regression nodes.
+	distribution []float64
+}
+
+// NewMetric returns the Metric of a regression node containing size
+// units of unit weight whose prediction is prediction.
+func NewMetric(size int, prediction float64) Metric {
+	return Metric{size: size, weight: float64(size), prediction: prediction}
 }
 
+// NewWeightedMetric returns the Metric of a regression node containing
+// size units of total weight weight whose prediction is prediction.
+func NewWeightedMetric(size int, weight, prediction float64) Metric {
+	return Metric{size: size, weight: weight, prediction: prediction}
+}
+
+func (m Metric) Size() int           { return m.size }
+func (m Metric) Weight() float64     { return m.weight }
+func (m Metric) Prediction() float64 { return m.prediction }
+
 // DecisionTreeNodetype describes an arbitrary node in a decision tree.
 type DecisionTreeNode struct {
 	Metric
@@ -43,8 +76,29 @@ type DecisionTreeNode struct {
 	// Reduction metric achieved by this split.
 	reduction float64
 
+	// impurity is the size-weighted impurity of the node's training
+	// targets in the units of the reductions, or NaN if the
+	// criterion doesn't report impurities.
+	impurity float64
+
 	// Splitter to use on above feature if feature>= 0 else nil.
 	splitter Splitter
+
+	// missingLeft is true if units whose feature value is missing
+	// (and which no surrogate can route) go to the left child.
+	missingLeft bool
+
+	// surrogates route units whose feature value is missing, in
+	// order of preference.
+	surrogates []surrogateSplit
+
+	// targets and targetWeights hold the training targets that
+	// reached a leaf and their weights, if the grower retains them.
+	targets, targetWeights []float64
+
+	// lower and upper bound the values of the leaves below a node
+	// grown under monotonic constraints.
+	lower, upper float64
 }
 
 func (n *DecisionTreeNode) Importances(importances []float64) {
@@ -61,6 +115,22 @@ func (n *DecisionTreeNode) Dump(w io.Writer, level int, prefix string) {
 		fmt.Fprint(w, " ")
 	}
 	fmt.Fprintf(w, "%sprediction: %g feature: %d reduction: %g size: %d", prefix, n.prediction, n.feature, n.reduction, n.size)
+	if n.weight != float64(n.size) {
+		fmt.Fprintf(w, " weight: %g", n.weight)
+	}
+	if n.distribution != nil {
+		fmt.Fprintf(w, " distribution: %v", n.distribution)
+	}
+	if n.feature >= 0 {
+		if n.missingLeft {
+			fmt.Fprint(w, " missing: L")
+		} else {
+			fmt.Fprint(w, " missing: R")
+		}
+		for _, s := range n.surrogates {
+			fmt.Fprintf(w, " surrogate: %s", s)
+		}
+	}
 	if n.feature < 0 {
 		fmt.Fprint(w, " (LEAF)")
 	}
@@ -79,6 +149,15 @@ type SplitInfo struct {
 
 	left  Metric
 	right Metric
+
+	// missingLeft is true if units with a missing value belong on the left.
+	missingLeft bool
+}
+
+// NewSplitInfo returns a SplitInfo describing a split by splitter
+// that reduces the node's loss by reduction.
+func NewSplitInfo(splitter Splitter, reduction float64, left, right Metric) *SplitInfo {
+	return &SplitInfo{splitter: splitter, reduction: reduction, left: left, right: right}
 }
 
 type FeatureSplitInfo struct {
@@ -86,18 +165,19 @@ type FeatureSplitInfo struct {
 	*SplitInfo
 }
 
-func (fsi *FeatureSplitInfo) Dump() {
+// Dump prints a readable representation of a feature split
+func (fsi *FeatureSplitInfo) Dump(w io.Writer) {
 	if fsi != nil {
-		log.Printf("\tfeature %v: %+v\n", fsi.feature, fsi.SplitInfo)
+		fmt.Fprintf(w, "\tfeature %v: %+v\n", fsi.feature, fsi.SplitInfo)
 	} else {
-		log.Printf("\tnil\n")
+		fmt.Fprintf(w, "\tnil\n")
 	}
 }
 
 type MSEAccumulator struct {
-	minLeafSize          int
+	minLeafSize          float64
 	previousFeatureValue float64
-	left, right          *stats.VarianceAccumulator
+	left, right          *stats.WeightedVarianceAccumulator
 
 	count          int
 	bestMetric     float64
@@ -109,10 +189,12 @@ type MSEAccumulator struct {
 	initialMetric float64
 }
 
-func NewMSEAccumulator(minLeafSize int) *MSEAccumulator {
+// NewMSEAccumulator returns an accumulator for squared error.
+// minLeafSize is the minimum weight of a leaf.
+func NewMSEAccumulator(minLeafSize float64) *MSEAccumulator {
 	return &MSEAccumulator{
-		left:                 stats.NewVarianceAccumulator(),
-		right:                stats.NewVarianceAccumulator(),
+		left:                 stats.NewWeightedVarianceAccumulator(),
+		right:                stats.NewWeightedVarianceAccumulator(),
 		bestMetric:           math.Inf(1),
 		previousFeatureValue: math.Inf(-1),
 		count:                0,
@@ -121,15 +203,15 @@ func NewMSEAccumulator(minLeafSize int) *MSEAccumulator {
 }
 
 // Add target value to "right" tally
-func (a *MSEAccumulator) Add(targetValue float64) {
-	a.right.Add(targetValue)
+func (a *MSEAccumulator) Add(targetValue, weight float64) {
+	a.right.Add(targetValue, weight)
 	a.count += 1
 }
 
 // Evaluate the metric assuming a break to the immediate left of
 // featureValue (feature Value is in right set).  Then move the
 // attribute value from the right set to left set.
-func (a *MSEAccumulator) Move(featureValue, targetValue float64) {
+func (a *MSEAccumulator) Move(featureValue, targetValue, weight float64) {
 	// If left count is zero, the is the initial move and
 	// the current metric is the one to beat.
 	if a.left.Count() == 0 {
@@ -138,23 +220,25 @@ func (a *MSEAccumulator) Move(featureValue, targetValue float64) {
 	}
 	if featureValue != a.previousFeatureValue { // End of a run of identical values
 		metric := (a.left.Value() + a.right.Value())
-		if metric < a.bestMetric && a.left.Count() >= a.minLeafSize && a.right.Count() >= a.minLeafSize {
+		if metric < a.bestMetric && a.left.Count() > 0 && a.right.Count() > 0 && a.left.Weight() >= a.minLeafSize && a.right.Weight() >= a.minLeafSize {
 			a.bestMetric = metric
-			a.bestSplitValue = 0.5 * (featureValue + a.previousFeatureValue)
+			a.bestSplitValue = splitThreshold(a.previousFeatureValue, featureValue)
 
 			if a.bestLeft.size = a.left.Count(); a.bestLeft.size > 0 {
+				a.bestLeft.weight = a.left.Weight()
 				a.bestLeft.prediction = a.left.Mean()
 			}
 
 			if a.bestRight.size = a.right.Count(); a.bestRight.size > 0 {
+				a.bestRight.weight = a.right.Weight()
 				a.bestRight.prediction = a.right.Mean()
 			}
 		}
 		a.previousFeatureValue = featureValue
 	}
 
-	a.right.Subtract(targetValue)
-	a.left.Add(targetValue)
+	a.right.Subtract(targetValue, weight)
+	a.left.Add(targetValue, weight)
 }
 
 func (a *MSEAccumulator) BestSplit() *SplitInfo {
@@ -165,7 +249,6 @@ func (a *MSEAccumulator) BestSplit() *SplitInfo {
 	}
 
 	if a.bestLeft.size != 0 && a.bestRight.size != 0 {
-		log.Printf("initialMetric: %v; bestMetric: %v", a.initialMetric, a.bestMetric)
 		result = &SplitInfo{
 			splitter:  NumericSplitter(a.bestSplitValue),
 			reduction: a.initialMetric - a.bestMetric,
@@ -180,76 +263,263 @@ func (a *MSEAccumulator) BestSplit() *SplitInfo {
 // nodeMembership maps each training unit to the index of splittableNode to which it currently belongs.
 // nodeCount is the number of splittableNodes (one more than the max value of nodeMembership)
 // bag maps each unit to the number of times that unit occurs in the current bag.
-// minSize is the minimum size for a leaf node.
+// criterion provides the accumulators used to evaluate the splits.
+// minSize is the minimum weight for a leaf node.
+//
+// Units with a missing (NaN) value of f are first scanned as if they
+// were larger than every other value (i.e., sent right).  For nodes
+// containing such units, the scan is repeated with the missing units
+// sent left and the better direction is recorded in the SplitInfo.
 func dtOptimalSplit(
 	f OrderedFeature,
 	target Feature,
 	nodeMembership []int,
 	nodeCount int,
 	bag Bag,
-	minSize int) []*SplitInfo {
-
-	if minSize <= 0 {
-		minSize = 1
+	criterion SplitCriterion,
+	minSize float64) []*SplitInfo {
+
+	// Missing values sort last; firstMissing is the position of the first one.
+	n := len(nodeMembership)
+	firstMissing := n
+	for firstMissing > 0 && math.IsNaN(f.NumericValue(f.InOrder(firstMissing-1))) {
+		firstMissing--
 	}
 
-	accumulators := make([]*MSEAccumulator, nodeCount)
-	for i := range accumulators {
-		accumulators[i] = NewMSEAccumulator(minSize)
+	missingRight := make([]SplitAccumulator, nodeCount)
+	for i := range missingRight {
+		missingRight[i] = criterion.NewAccumulator(minSize)
 	}
 
 	// First pass - accumulate stats with all points to right of split
 	// Add points from right to left so they are removed in LIFO order
-	for i := len(nodeMembership) - 1; i >= 0; i-- {
-		iOrdered := f.InOrder(i)
-		if nm := nodeMembership[iOrdered]; nm >= 0 {
-			for j := 0; j < bag.Count(iOrdered); j++ {
-				accumulators[nm].Add(target.NumericValue(iOrdered))
-			}
-		}
-	}
+	dtAdd(missingRight, f, target, nodeMembership, bag, 0, n)
 
 	// Second pass - move points from right to left and evalute new metric
-	for i := range nodeMembership {
-		iOrdered := f.InOrder(i)
-		if nm := nodeMembership[iOrdered]; nm >= 0 {
-			for j := 0; j < bag.Count(iOrdered); j++ {
-				accumulators[nm].Move(f.NumericValue(iOrdered), target.NumericValue(iOrdered))
+	dtMove(missingRight, f, target, nodeMembership, bag, 0, firstMissing, false, 0.0)
+	dtMove(missingRight, f, target, nodeMembership, bag, firstMissing, n, true, math.Inf(1))
+
+	// Repeat with the missing units moved first for nodes having any
+	var missingLeft []SplitAccumulator
+	if firstMissing < n {
+		missingLeft = make([]SplitAccumulator, nodeCount)
+		for i := firstMissing; i < n; i++ {
+			iOrdered := f.InOrder(i)
+			if nm := nodeMembership[iOrdered]; nm >= 0 && bag.Count(iOrdered) > 0 && missingLeft[nm] == nil {
+				missingLeft[nm] = criterion.NewAccumulator(minSize)
 			}
 		}
+		dtAdd(missingLeft, f, target, nodeMembership, bag, 0, firstMissing)
+		dtAdd(missingLeft, f, target, nodeMembership, bag, firstMissing, n)
+		dtMove(missingLeft, f, target, nodeMembership, bag, firstMissing, n, true, math.Inf(-1))
+		dtMove(missingLeft, f, target, nodeMembership, bag, 0, firstMissing, false, 0.0)
 	}
 
 	// Collect results from accumulators
 	result := make([]*SplitInfo, nodeCount)
 	for i := range result {
-		if bestSplit := accumulators[i].BestSplit(); bestSplit != nil {
-			result[i] = bestSplit
-		} else {
-			result[i] = nil
+		result[i] = missingRight[i].BestSplit()
+		if missingLeft != nil && missingLeft[i] != nil {
+			if bestSplit := missingLeft[i].BestSplit(); bestSplit != nil && (result[i] == nil || bestSplit.reduction > result[i].reduction) {
+				bestSplit.missingLeft = true
+				result[i] = bestSplit
+			}
+		} else if result[i] != nil {
+			// No missing values were seen, so send any
+			// encountered later to the larger side.
+			result[i].missingLeft = result[i].left.weight > result[i].right.weight
 		}
 	}
 
 	return result
 }
 
+// dtAdd passes the units at positions start through end-1 in the
+// order of f to the Add() method of the accumulators for their nodes,
+// in reverse order.  Units of nodes with a nil accumulator are skipped.
+func dtAdd(accumulators []SplitAccumulator, f OrderedFeature, target Feature, nodeMembership []int, bag Bag, start, end int) {
+	for i := end - 1; i >= start; i-- {
+		iOrdered := f.InOrder(i)
+		if nm := nodeMembership[iOrdered]; nm >= 0 && accumulators[nm] != nil {
+			for j := 0; j < bag.Count(iOrdered); j++ {
+				accumulators[nm].Add(target.NumericValue(iOrdered), bag.Weight(iOrdered))
+			}
+		}
+	}
+}
+
+// dtMove passes the units at positions start through end-1 in the
+// order of f to the Move() method of the accumulators for their
+// nodes.  If override is true, value is passed as the feature value
+// of every unit.  Units of nodes with a nil accumulator are skipped.
+func dtMove(accumulators []SplitAccumulator, f OrderedFeature, target Feature, nodeMembership []int, bag Bag, start, end int, override bool, value float64) {
+	for i := start; i < end; i++ {
+		iOrdered := f.InOrder(i)
+		if nm := nodeMembership[iOrdered]; nm >= 0 && accumulators[nm] != nil {
+			featureValue := value
+			if !override {
+				featureValue = f.NumericValue(iOrdered)
+			}
+			for j := 0; j < bag.Count(iOrdered); j++ {
+				accumulators[nm].Move(featureValue, target.NumericValue(iOrdered), bag.Weight(iOrdered))
+			}
+		}
+	}
+}
+
 type decisionTreeGrower struct {
 	MaxFeatures int
-	MinLeafSize int
+
+	// MinLeafSize is the minimum weight of a leaf (the minimum number
+	// of units when units are not weighted).
+	MinLeafSize float64
+
+	// MaxDepth is the maximum depth of a leaf (the root has depth
+	// zero).  Zero means unlimited.
+	MaxDepth int
+
+	// MaxLeafNodes is the maximum number of leaves.  If it is
+	// non-zero, the tree is grown best first.
+	MaxLeafNodes int
+
+	// MinSamplesSplit is the minimum size of a node that may be split.
+	MinSamplesSplit int
+
+	// MinImpurityDecrease is the smallest reduction (in the units
+	// of the criterion's size-weighted impurity, e.g., the sum of
+	// squared errors) for which a node is split.
+	MinImpurityDecrease float64
+
+	// Surrogates is the maximum number of surrogate splits
+	// recorded for each split.
+	Surrogates int
+
+	// MaxBins is the maximum number of bins of each numeric
+	// feature.  Zero means numeric features aren't binned.
+	MaxBins int
+
+	// NumJobs is the number of trees a forest grows concurrently
+	// (and the number of workers used by its predictions).
+	NumJobs int
+
+	// Bootstrap is true if each tree of a forest is grown on a
+	// bootstrap sample rather than on every unit.
+	Bootstrap bool
+
+	// randomSplits is true if each node draws a random split of each
+	// feature rather than searching for the best one (extra trees).
+	randomSplits bool
+
+	// LeafTargets is true if each leaf retains the training targets
+	// that reached it.
+	LeafTargets bool
+
+	// MonotonicConstraints holds, for each feature, +1 if
+	// predictions must not decrease as the feature increases, -1 if
+	// they must not increase, and 0 if they are unconstrained.  A
+	// nil MonotonicConstraints constrains no feature.
+	MonotonicConstraints []int
+
+	// Seed seeds the random choices made in training if seeded is
+	// true.  Otherwise a seed is drawn from the global source.
+	Seed   int64
+	seeded bool
+
+	criterion SplitCriterion
+
+	// boosting holds the options of gradient boosted models.
+	boosting boostingOptions
+
+	// isolation holds the options of isolation forests.
+	isolation isolationOptions
+
+	// observer receives training events if it is not nil.
+	observer TrainingObserver
+}
+
+func newDecisionTreeGrower(criterion SplitCriterion, options []Option) *decisionTreeGrower {
+	dtg := &decisionTreeGrower{MaxFeatures: 10, MinLeafSize: 1, NumJobs: 1, Bootstrap: true, criterion: criterion}
+	for _, option := range options {
+		option(dtg)
+	}
+	return dtg
 }
 
-func dtInitialize(target Feature, bag Bag) ([]*DecisionTreeNode, []int) {
-	node := &DecisionTreeNode{feature: -1}
+// Option configures a decision tree or a forest at construction time.
+type Option func(*decisionTreeGrower)
+
+// WithSeed seeds the random choices made in training (bootstrap
+// samples and candidate features), so that two models trained with
+// the same seed, options, and data are identical.
+func WithSeed(seed int64) Option {
+	return func(dtg *decisionTreeGrower) { dtg.Seed, dtg.seeded = seed, true }
+}
+
+// seed returns the configured seed or, if none was configured, a
+// seed drawn from the global source.
+func (dtg *decisionTreeGrower) seed() int64 {
+	if dtg.seeded {
+		return dtg.Seed
+	}
+	return rand.Int63()
+}
+
+// WithCriterion selects the criterion used to choose splits and leaf values.
+func WithCriterion(criterion SplitCriterion) Option {
+	return func(dtg *decisionTreeGrower) { dtg.criterion = criterion }
+}
+
+// WithMaxFeatures sets the number of features randomly chosen as
+// candidates for each split (default 10).  Zero means all features.
+func WithMaxFeatures(n int) Option {
+	return func(dtg *decisionTreeGrower) { dtg.MaxFeatures = n }
+}
+
+// WithMinLeafSize sets the minimum weight of a leaf (default 1).  When
+// units are not weighted, this is the minimum number of units.
+func WithMinLeafSize(n float64) Option {
+	return func(dtg *decisionTreeGrower) { dtg.MinLeafSize = n }
+}
+
+// WithMaxDepth limits the depth of the tree.  A tree of depth d has at
+// most 2^d leaves.
+func WithMaxDepth(d int) Option {
+	return func(dtg *decisionTreeGrower) { dtg.MaxDepth = d }
+}
+
+// WithMaxLeafNodes limits the number of leaves.  The tree is grown
+// best first: the split with the largest reduction among all
+// splittable nodes is applied first.
+func WithMaxLeafNodes(n int) Option {
+	return func(dtg *decisionTreeGrower) { dtg.MaxLeafNodes = n }
+}
+
+// WithMinSamplesSplit prevents splitting nodes smaller than n.
+func WithMinSamplesSplit(n int) Option {
+	return func(dtg *decisionTreeGrower) { dtg.MinSamplesSplit = n }
+}
+
+// WithMinImpurityDecrease prevents splits that reduce the criterion's
+// size-weighted impurity by less than x.
+func WithMinImpurityDecrease(x float64) Option {
+	return func(dtg *decisionTreeGrower) { dtg.MinImpurityDecrease = x }
+}
+
+func dtInitialize(target Feature, bag Bag, criterion SplitCriterion) ([]*DecisionTreeNode, []int) {
+	node := &DecisionTreeNode{feature: -1, lower: math.Inf(-1), upper: math.Inf(1)}
 
 	splittableNodeMembership := make([]int, bag.Len())
-	acc := stats.NewVarianceAccumulator()
+	targets := make([]float64, 0, bag.Len())
+	weights := make([]float64, 0, bag.Len())
 	for i := 0; i < bag.Len(); i++ {
 		splittableNodeMembership[i] = 0 // Root node
 		for j := 0; j < bag.Count(i); j++ {
-			acc.Add(target.NumericValue(i))
+			targets = append(targets, target.NumericValue(i))
+			weights = append(weights, bag.Weight(i))
 		}
 	}
 
-	node.Metric = Metric{size: acc.Count(), prediction: acc.Mean()}
+	node.Metric = criterion.LeafMetric(targets, weights)
 
 	// nextSplittableNodes is next generation of splittableNodes.
 	// It is initialized here (and re-generated during each
@@ -260,26 +530,58 @@ func dtInitialize(target Feature, bag Bag) ([]*DecisionTreeNode, []int) {
 	return initialSplittableNodes, splittableNodeMembership
 }
 
+// dtNodeImpurities records the impurity of each splittable node,
+// except those with pending splits, whose impurities were recorded
+// when they were deferred.  ic is nil if the criterion doesn't report
+// impurities.
+func dtNodeImpurities(splittableNodes []*DecisionTreeNode, pendingSplits []*FeatureSplitInfo, nodeMembership []int, target Feature, bag Bag, ic impurityCriterion) {
+	targets := make([][]float64, len(splittableNodes))
+	weights := make([][]float64, len(splittableNodes))
+	if ic != nil {
+		for i, sn := range nodeMembership {
+			if sn >= 0 && pendingSplits[sn] == nil {
+				for j := 0; j < bag.Count(i); j++ {
+					targets[sn] = append(targets[sn], target.NumericValue(i))
+					weights[sn] = append(weights[sn], bag.Weight(i))
+				}
+			}
+		}
+	}
+	for inode, node := range splittableNodes {
+		if pendingSplits[inode] != nil {
+			continue
+		}
+		if ic != nil {
+			node.impurity = ic.impurity(targets[inode], weights[inode])
+		} else {
+			node.impurity = math.NaN()
+		}
+	}
+}
+
+// dtSelectSplits selects the split of each splittable node from a
+// random subset of size maxFeatures of the candidate splits.  Splits
+// that reduce the metric by less than minImpurityDecrease are
+// rejected, as are splits that violate the monotonic constraints (if
+// constraints is not nil).  The result is indexed like
+// splittableNodes and contains nil for nodes that should not be
+// split.
 func dtSelectSplits(splittableNodes []*DecisionTreeNode,
 	candidateSplitsByFeature [][]*FeatureSplitInfo,
-	maxFeatures int) ([]*DecisionTreeNode, []*SplitPair) {
+	maxFeatures int,
+	minImpurityDecrease float64,
+	constraints []int,
+	rng *rand.Rand) []*FeatureSplitInfo {
 
-	nextSplittableNodes := make([]*DecisionTreeNode, 0, 2*len(splittableNodes))
-	// nodeSplits is generated during each iteration and
-	// contains the next-generation indexes of children of
-	// nodes to be split (left and right values of
-	// SplitPair are indexes of nextSplittableNodes; index
-	// of nodeSplits match those of splittableNodes))
-	nodeSplits := make([]*SplitPair, 0, len(splittableNodes))
+	selectedSplits := make([]*FeatureSplitInfo, len(splittableNodes))
 
 	improvingSplits := make([]*FeatureSplitInfo, 0, len(candidateSplitsByFeature))
-	log.Print("Selected feature/split by eligible node: ")
 	for inode, node := range splittableNodes {
 		// For this node, build list of feature splits
 		// that reduce the metric
 		improvingSplits = improvingSplits[:0]
 		for _, nodeCandidateSplits := range candidateSplitsByFeature {
-			if nodeCandidateSplits[inode] != nil {
+			if split := nodeCandidateSplits[inode]; split != nil && !node.violates(split, constraints) {
 				improvingSplits = append(improvingSplits, nodeCandidateSplits[inode])
 			}
 		}
@@ -287,21 +589,72 @@ func dtSelectSplits(splittableNodes []*DecisionTreeNode,
 		// Consider a random subset of feature splits of size maxFeatures and pick the best of those
 		var bestSplit *FeatureSplitInfo
 		for i := 0; i < maxFeatures && i < len(improvingSplits); i++ {
-			irand := i + rand.Intn(len(improvingSplits)-i)
+			irand := i + rng.Intn(len(improvingSplits)-i)
 			improvingSplits[i], improvingSplits[irand] = improvingSplits[irand], improvingSplits[i]
 			if bestSplit == nil || improvingSplits[i].reduction > bestSplit.reduction {
 				bestSplit = improvingSplits[i]
 			}
 		}
 
+		if bestSplit != nil && bestSplit.reduction < minImpurityDecrease {
+			bestSplit = nil
+		}
+		selectedSplits[inode] = bestSplit
+	}
+	return selectedSplits
+}
+
+// dtBestFirst restricts selectedSplits for best-first growth when at
+// most budget more splits are allowed.  Only the split with the
+// largest reduction is kept.  The nodes of the other splits are
+// marked in deferred so they remain splittable in the next generation
+// unless the budget will be exhausted, in which case they become leaves.
+func dtBestFirst(selectedSplits []*FeatureSplitInfo, deferred []bool, budget int) {
+	best := -1
+	for inode, split := range selectedSplits {
+		if split != nil && (best < 0 || split.reduction > selectedSplits[best].reduction) {
+			best = inode
+		}
+	}
+	for inode, split := range selectedSplits {
+		if split != nil && (inode != best || budget <= 0) {
+			deferred[inode] = budget > 1
+			selectedSplits[inode] = nil
+		}
+	}
+}
+
+// dtApplySplits splits each node of splittableNodes having a non-nil
+// selected split.  It returns the next generation of splittable
+// nodes, which contains the children of the split nodes followed in
+// order by the deferred nodes, along with the indexes of each node's
+// children in that generation.  The SplitPair of a deferred node has
+// its next-generation index as both left and right; that of a leaf is nil.
+// The values of the children are bounded as required by constraints.
+func dtApplySplits(splittableNodes []*DecisionTreeNode,
+	selectedSplits []*FeatureSplitInfo,
+	deferred []bool,
+	constraints []int) ([]*DecisionTreeNode, []*SplitPair) {
+
+	nextSplittableNodes := make([]*DecisionTreeNode, 0, 2*len(splittableNodes))
+	// nodeSplits is generated during each iteration and
+	// contains the next-generation indexes of children of
+	// nodes to be split (left and right values of
+	// SplitPair are indexes of nextSplittableNodes; index
+	// of nodeSplits match those of splittableNodes))
+	nodeSplits := make([]*SplitPair, 0, len(splittableNodes))
+
+	for inode, node := range splittableNodes {
 		var newPair *SplitPair = nil
-		if bestSplit != nil {
+		if bestSplit := selectedSplits[inode]; bestSplit != nil {
 			node.feature = bestSplit.feature
 			node.splitter = bestSplit.splitter
 			node.reduction = bestSplit.reduction
+			node.missingLeft = bestSplit.missingLeft
 
 			node.Left = &DecisionTreeNode{feature: -1, Metric: bestSplit.left}
 			node.Right = &DecisionTreeNode{feature: -1, Metric: bestSplit.right}
+			node.boundChildren(constraints)
 
 			leftIndex := len(nextSplittableNodes)
 			nextSplittableNodes = append(nextSplittableNodes, node.Left)
@@ -312,67 +665,202 @@ func dtSelectSplits(splittableNodes []*DecisionTreeNode,
 			newPair = &SplitPair{left: leftIndex, right: rightIndex}
 		}
 		nodeSplits = append(nodeSplits, newPair)
+	}
 
-		bestSplit.Dump()
+	for inode, node := range splittableNodes {
+		if deferred[inode] {
+			index := len(nextSplittableNodes)
+			nextSplittableNodes = append(nextSplittableNodes, node)
+			nodeSplits[inode] = &SplitPair{left: index, right: index}
+		}
 	}
 	return nextSplittableNodes, nodeSplits
 }
 
 type SplitPair struct{ left, right int }
 
-func (dtg *decisionTreeGrower) grow(features []OrderedFeature, target Feature, bag Bag, oobPrediction []stats.Accumulator) *DecisionTreeNode {
+// splittable returns true if node, at the given depth, may be split.
+func (dtg *decisionTreeGrower) splittable(node *DecisionTreeNode, depth int) bool {
+	return (dtg.MaxDepth <= 0 || depth < dtg.MaxDepth) && node.size >= 2 && node.size >= dtg.MinSamplesSplit
+}
+
+// grow grows a tree using the units in bag.  Random choices are drawn
+// from rng.  tree identifies the tree in events sent to the observer.
+// If visit is not nil, it is called for each unit (including
+// out-of-bag units) once that unit reaches its leaf.
+//
+// The tree is grown breadth first, one generation of splittable nodes
+// at a time, unless MaxLeafNodes is set, in which case only the best
+// split of each generation is applied (best-first growth) and the
+// other splittable nodes are deferred to the next generation.
+func (dtg *decisionTreeGrower) grow(features []OrderedFeature, target Feature, bag Bag, rng *rand.Rand, tree int, visit func(i int, leaf *DecisionTreeNode)) *DecisionTreeNode {
 	maxFeatures := dtg.MaxFeatures
 	if maxFeatures > len(features) || maxFeatures <= 0 {
 		maxFeatures = len(features)
 	}
+	dtg.checkConstraints(len(features))
 
-	initialSplittableNodes, splittableNodeMembership := dtInitialize(target, bag)
+	unorderedFeatures := make([]Feature, len(features))
+	for i, f := range features {
+		unorderedFeatures[i] = f
+	}
+
+	initialSplittableNodes, splittableNodeMembership := dtInitialize(target, bag, dtg.criterion)
 	root := initialSplittableNodes[0]
+	ic, _ := dtg.criterion.(impurityCriterion)
+	leafCount := 1
+
+	// depths and pendingSplits are indexed like splittableNodes.
+	// pendingSplits holds the splits already selected for deferred
+	// nodes, which need not be re-evaluated.
+	depths := []int{0}
+	pendingSplits := []*FeatureSplitInfo{nil}
 
 	// candidateSplitsByFeature is a fixed length slices that is
 	// re-used during each iteration
 	candidateSplitsByFeature := make([][]*FeatureSplitInfo, len(features))
 
+	// evaluationMembership is splittableNodeMembership restricted
+	// to the nodes whose splits are evaluated in this generation.
+	evaluationMembership := make([]int, len(splittableNodeMembership))
+
+	// histograms holds the histograms of binned features or is nil
+	// if splits of binned features are found by scanning units.
+	var histograms *histogramCache
+	if !dtg.randomSplits {
+		histograms = newHistogramCache(features, target, bag, dtg.criterion)
+	}
+
+	iteration := 0
 	var nextSplittableNodes []*DecisionTreeNode
 	for splittableNodes := initialSplittableNodes; len(splittableNodes) > 0; splittableNodes = nextSplittableNodes {
-		log.Printf("*** New Iteration ***:  splittableNodeMembership: %v", splittableNodeMembership)
+
+		evaluate := make([]bool, len(splittableNodes))
+		for inode, node := range splittableNodes {
+			evaluate[inode] = pendingSplits[inode] == nil && dtg.splittable(node, depths[inode])
+		}
+		for i, sn := range splittableNodeMembership {
+			evaluationMembership[i] = -1
+			if sn >= 0 && evaluate[sn] {
+				evaluationMembership[i] = sn
+			}
+		}
+		if histograms != nil {
+			histograms.build(target, bag, splittableNodeMembership, evaluate)
+		}
+		dtNodeImpurities(splittableNodes, pendingSplits, splittableNodeMembership, target, bag, ic)
 
 		// For each feature find all optimal splits for that feature for each splittable node
 		for i, feature := range features {
 			candidateSplitsByFeature[i] = make([]*FeatureSplitInfo, 0, len(splittableNodes))
-			log.Printf("Best splits by node, feature %d:\n", i)
-			for _, dtos := range dtOptimalSplit(feature, target, splittableNodeMembership, len(splittableNodes), bag, dtg.MinLeafSize) {
+			var featureSplits []*SplitInfo
+			if dtg.randomSplits {
+				featureSplits = dtRandomSplit(feature, target, evaluationMembership, len(splittableNodes), bag, dtg.criterion, dtg.MinLeafSize, rng)
+			} else if cf, ok := feature.(*CategoricalFeature); ok {
+				featureSplits = dtOptimalCategorySplit(cf, target, evaluationMembership, len(splittableNodes), bag, dtg.criterion, dtg.MinLeafSize)
+			} else if bf, ok := feature.(*binnedFeature); ok {
+				var featureHistograms []*histogram
+				if histograms != nil {
+					featureHistograms = histograms.histograms(i, evaluate)
+				}
+				featureSplits = dtBinnedSplit(bf, featureHistograms, target, evaluationMembership, len(splittableNodes), bag, dtg.criterion, dtg.MinLeafSize)
+			} else {
+				featureSplits = dtOptimalSplit(feature, target, evaluationMembership, len(splittableNodes), bag, dtg.criterion, dtg.MinLeafSize)
+			}
+			for _, dtos := range featureSplits {
 				var split *FeatureSplitInfo
 				if dtos != nil {
 					split = &FeatureSplitInfo{i, dtos}
 				}
 				candidateSplitsByFeature[i] = append(candidateSplitsByFeature[i], split)
-				split.Dump()
 			}
 		}
 
+		selectedSplits := dtSelectSplits(splittableNodes, candidateSplitsByFeature, maxFeatures, dtg.MinImpurityDecrease, dtg.MonotonicConstraints, rng)
+		for inode, pending := range pendingSplits {
+			if pending != nil {
+				selectedSplits[inode] = pending
+			}
+		}
+
+		deferred := make([]bool, len(splittableNodes))
+		if dtg.MaxLeafNodes > 0 {
+			dtBestFirst(selectedSplits, deferred, dtg.MaxLeafNodes-leafCount)
+		}
+
 		var nodeSplits []*SplitPair
-		nextSplittableNodes, nodeSplits = dtSelectSplits(splittableNodes, candidateSplitsByFeature, maxFeatures)
+		nextSplittableNodes, nodeSplits = dtApplySplits(splittableNodes, selectedSplits, deferred, dtg.MonotonicConstraints)
+		if histograms != nil {
+			histograms.advance(splittableNodes, nodeSplits, len(nextSplittableNodes))
+		}
+
+		splits := 0
+		nextDepths := make([]int, len(nextSplittableNodes))
+		nextPendingSplits := make([]*FeatureSplitInfo, len(nextSplittableNodes))
+		for inode, pair := range nodeSplits {
+			if pair != nil {
+				if deferred[inode] {
+					nextDepths[pair.left] = depths[inode]
+					nextPendingSplits[pair.left] = selectedSplits[inode]
+				} else {
+					nextDepths[pair.left] = depths[inode] + 1
+					nextDepths[pair.right] = depths[inode] + 1
+					leafCount += 1
+					splits += 1
+					if dtg.observer != nil {
+						node := splittableNodes[inode]
+						dtg.observer.Split(SplitEvent{
+							Tree:      tree,
+							Iteration: iteration,
+							Depth:     depths[inode],
+							Feature:   node.feature,
+							Splitter:  node.splitter,
+							Reduction: node.reduction,
+							Left:      node.Left.Metric,
+							Right:     node.Right.Metric,
+						})
+					}
+				}
+			}
+		}
+		depths, pendingSplits = nextDepths, nextPendingSplits
+
+		if dtg.observer != nil {
+			dtg.observer.Iteration(IterationEvent{tree, iteration, len(splittableNodes), splits})
+		}
+		iteration += 1
+
+		if dtg.Surrogates > 0 {
+			dtSurrogateSplits(features, splittableNodes, splittableNodeMembership, bag, dtg.Surrogates)
+		}
 
 		// Update node membership
 		for i, sn := range splittableNodeMembership {
 			if sn >= 0 {
 				splittableNode := splittableNodes[sn]
-				if splittableNode.feature >= 0 {
-					if splittableNode.splitter.Split(features[splittableNode.feature].NumericValue(i)) { // Left
-						splittableNodeMembership[i] = nodeSplits[sn].left
-					} else { // Right
-						splittableNodeMembership[i] = nodeSplits[sn].right
-					}
-				} else { // No split exists --- this record has reached a leaf node.
+				if pair := nodeSplits[sn]; pair == nil { // No split exists --- this record has reached a leaf node.
 					splittableNodeMembership[i] = -1 // An impossible node reference
-					if oobPrediction != nil && bag.Count(i) == 0 {
-						oobPrediction[i].Add(splittableNode.prediction)
+					if dtg.LeafTargets && bag.Count(i) > 0 {
+						splittableNode.targets = append(splittableNode.targets, target.NumericValue(i))
+						splittableNode.targetWeights = append(splittableNode.targetWeights, float64(bag.Count(i))*bag.Weight(i))
 					}
+					if visit != nil {
+						visit(i, splittableNode)
+					}
+				} else if splittableNode.feature < 0 { // Deferred
+					splittableNodeMembership[i] = pair.left
+				} else if splittableNode.splitLeft(unorderedFeatures, i) { // Left
+					splittableNodeMembership[i] = pair.left
+				} else { // Right
+					splittableNodeMembership[i] = pair.right
 				}
 			}
 		}
 	}
+
+	if dtg.observer != nil {
+		dtg.observer.Tree(TreeEvent{tree, iteration, leafCount, root})
+	}
 	return root
 }
 
@@ -381,57 +869,78 @@ func (dtg *DecisionTreeNode) Predict(features []Feature) []float64 {
 	if len(features) > 0 {
 		result = make([]float64, features[0].Len())
 		for i := range result {
-			node := dtg
-			for node.feature >= 0 {
-				if node.splitter.Split(features[node.feature].NumericValue(i)) {
-					node = node.Left
-				} else {
-					node = node.Right
-				}
-			}
-			result[i] = node.prediction
+			result[i] = dtg.leaf(features, i).prediction
 		}
 	}
 	return result
 }
 
+// leaf returns the leaf reached by unit i of features.
+func (n *DecisionTreeNode) leaf(features []Feature, i int) *DecisionTreeNode {
+	node := n
+	for node.feature >= 0 {
+		if node.splitLeft(features, i) {
+			node = node.Left
+		} else {
+			node = node.Right
+		}
+	}
+	return node
+}
+
 type DecisionTree struct {
 	nFeatures int
 	root      *DecisionTreeNode
 	grower    *decisionTreeGrower
+	featureSchema
+
+	// seed is the seed with which the tree was trained.
+	seed int64
 }
 
-func NewDecisionTreeRegressor() *DecisionTree {
+// NewDecisionTreeRegressor returns a regression tree.  Unless
+// configured otherwise, it minimizes squared error (MSECriterion).
+func NewDecisionTreeRegressor(options ...Option) *DecisionTree {
 	return &DecisionTree{
 		0,
 		nil,
-		&decisionTreeGrower{MaxFeatures: 10, MinLeafSize: 1},
+		newDecisionTreeGrower(MSECriterion{}, options),
+		featureSchema{},
+		0,
 	}
 }
 
 func (dtr *DecisionTree) Importances() []float64 {
-	fmt.Printf("Importances(): nFeatures: %d", dtr.nFeatures)
 	importances := make([]float64, dtr.nFeatures)
 	dtr.root.Importances(importances)
 	return importances
 }
 
 func (dtr *DecisionTree) Fit(features []OrderedFeature, target Feature) {
-	for _, f := range features {
-		f.Prepare()
-	}
+	dtr.FitWeighted(features, target, nil)
+}
 
-	bag := FullBag(features[0].Len())
-	log.Printf("bag: %v", bag)
+// FitWeighted trains the tree with each unit i weighted by
+// weights[i].  A nil weights is equivalent to unit weights.
+func (dtr *DecisionTree) FitWeighted(features []OrderedFeature, target Feature, weights []float64) {
+	prepared := dtr.grower.prepare(features)
 
-	dtr.root = dtr.grower.grow(features, target, bag, nil)
+	var bag Bag = FullBag(features[0].Len())
+	if weights != nil {
+		bag = NewWeightedBag(bag, weights)
+	}
 
-	dtr.nFeatures = len(features)
+	dtr.seed = dtr.grower.seed()
+	dtr.root = dtr.grower.grow(prepared, target, bag, rand.New(rand.NewSource(dtr.seed)), 0, nil)
 
-	log.Print("Tree Dump:")
-	dtr.Dump(os.Stderr)
+	dtr.nFeatures = len(features)
+	dtr.featureSchema = newFeatureSchema(features)
 }
 
+// Seed returns the seed with which the tree was trained.  Training
+// again with WithSeed(Seed()) reproduces the tree.
+func (dtr *DecisionTree) Seed() int64 { return dtr.seed }
+
 func (dtr *DecisionTree) Predict(features []Feature) []float64 {
 	var result []float64
 	if dtr.root != nil {
@@ -1,7 +1,10 @@
 package DragonBlood_test
 
 import (
+	"bytes"
 	"fmt"
+	"math"
+	"strings"
 	"testing"
 
 	db "github.com/mawicks/DragonBlood"
@@ -42,3 +45,85 @@ func TestDecisionTree(test *testing.T) {
 
 	fmt.Printf("%v\n", dt.Importances())
 }
+
+func TestDecisionTreeStoppingOptions(test *testing.T) {
+	x := db.NewNumericFeature(nil)
+	x.Add(0, 1, 2, 3, 4, 5, 6, 7)
+
+	t := db.NewNumericFeature(nil)
+	t.Add(3, 0, 3, 1, 7, 6, 5, -1)
+
+	leaves := func(dt *db.DecisionTree) int {
+		var dump bytes.Buffer
+		dt.Dump(&dump)
+		return strings.Count(dump.String(), "(LEAF)")
+	}
+
+	for _, c := range []struct {
+		option db.Option
+		leaves int
+	}{
+		{db.WithMaxDepth(1), 2},
+		{db.WithMaxDepth(2), 3}, // The first split isolates the last unit
+		{db.WithMaxLeafNodes(3), 3},
+		{db.WithMaxLeafNodes(5), 5},
+		{db.WithMinSamplesSplit(9), 1},
+		{db.WithMinImpurityDecrease(1000.0), 1},
+		{db.WithMinLeafSize(4), 2},
+	} {
+		dt := db.NewDecisionTreeRegressor(c.option)
+		dt.Fit([]db.OrderedFeature{x}, t)
+		if n := leaves(dt); n != c.leaves {
+			test.Errorf("Option %d: tree has %d leaves; expected %d", c.leaves, n, c.leaves)
+		}
+	}
+}
+
+func TestDecisionTreeWeights(test *testing.T) {
+	// Integer weights are equivalent to repeated rows
+	x := db.NewNumericFeature(nil)
+	x.Add(0, 1, 2, 3)
+
+	t := db.NewNumericFeature(nil)
+	t.Add(1, 2, 3, 10)
+
+	dt := db.NewDecisionTreeRegressor(db.WithMinSamplesSplit(100))
+	dt.FitWeighted([]db.OrderedFeature{x}, t, []float64{1, 1, 1, 3})
+	if p := dt.Predict([]db.Feature{x})[0]; p != 6.0 {
+		test.Errorf("weighted root predicted %v; expected 6", p)
+	}
+
+	// A unit with zero weight has no influence and can't form a leaf
+	t = db.NewNumericFeature(nil)
+	t.Add(1, 1, 100, 1)
+
+	dt = db.NewDecisionTreeRegressor()
+	dt.FitWeighted([]db.OrderedFeature{x}, t, []float64{1, 1, 0, 1})
+	for i, p := range dt.Predict([]db.Feature{x}) {
+		if p != 1.0 {
+			test.Errorf("Row %d: predicted %v; expected 1", i, p)
+		}
+	}
+}
+
+func TestDecisionTreeAdjacentValues(test *testing.T) {
+	// The midpoint of 1 and the next larger float64 rounds to 1, which
+	// would send no unit left.
+	next := math.Nextafter(1, 2)
+	x := db.NewNumericFeature([]float64{1, 1, next, next})
+	t := db.NewNumericFeature([]float64{0, 0, 10, 10})
+
+	for m, dt := range []*db.DecisionTree{
+		db.NewDecisionTreeRegressor(),
+		db.NewDecisionTreeRegressor(db.WithMaxBins(16)),
+		db.NewDecisionTreeRegressor(db.WithCriterion(db.MAECriterion{})),
+		db.NewDecisionTreeRegressor(db.WithCriterion(db.HuberCriterion{Delta: 1.0})),
+	} {
+		dt.Fit([]db.OrderedFeature{x}, t)
+		for i, p := range dt.Predict([]db.Feature{x}) {
+			if expected := t.NumericValue(i); p != expected {
+				test.Errorf("Model %d, row %d: predicted %v; expected %v", m, i, p, expected)
+			}
+		}
+	}
+}
@@ -1,12 +1,18 @@
 package DragonBlood
 
-import "math/rand"
+import (
+	"fmt"
+	"math/rand"
+)
 
 // Bag
 type Bag interface {
 	Len() int
 	Count(int) int
 	Resample()
+
+	// Weight returns the weight of each occurrence of a unit.
+	Weight(int) float64
 }
 
 type bag []int
@@ -17,14 +23,25 @@ func NewBag(n int) bag {
 	return newBag
 }
 
-func (b bag) Resample() {
+// NewBagFromSource is like NewBag but draws the sample from rng
+// rather than from the global source, so that a given source yields
+// the same bag.
+func NewBagFromSource(n int, rng *rand.Rand) bag {
+	newBag := bag(make([]int, n))
+	newBag.resample(rng.Intn)
+	return newBag
+}
+
+func (b bag) Resample() { b.resample(rand.Intn) }
+
+func (b bag) resample(intn func(int) int) {
 	for i := range b {
 		b[i] = 0
 	}
 
 	n := len(b)
 	for i := 0; i < n; i++ {
-		b[rand.Intn(n)] += 1
+		b[intn(n)] += 1
 	}
 }
 
@@ -32,9 +49,29 @@ func (b bag) Count(i int) int { return b[i] }
 
 func (b bag) Len() int { return len(b) }
 
+func (bag) Weight(int) float64 { return 1.0 }
+
 type FullBag int
 
-func (n FullBag) Len() int     { return int(n) }
-func (FullBag) Resample()      {}
-func (FullBag) Count(int) int  { return 1 }
-func (FullBag) String() string { return "Full Bag (all samples)" }
+func (n FullBag) Len() int         { return int(n) }
+func (FullBag) Resample()          {}
+func (FullBag) Count(int) int      { return 1 }
+func (FullBag) Weight(int) float64 { return 1.0 }
+func (FullBag) String() string     { return "Full Bag (all samples)" }
+
+// weightedBag is a Bag whose units carry sample weights.
+type weightedBag struct {
+	Bag
+	weights []float64
+}
+
+// NewWeightedBag returns a Bag with the counts of bag in which each
+// occurrence of unit i has weight weights[i].
+func NewWeightedBag(bag Bag, weights []float64) Bag {
+	if len(weights) != bag.Len() {
+		panic(fmt.Sprintf("Argument mismatch: bag.Len()=%d, but len(weights)=%d", bag.Len(), len(weights)))
+	}
+	return weightedBag{bag, weights}
+}
+
+func (b weightedBag) Weight(i int) float64 { return b.weights[i] }
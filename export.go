@@ -0,0 +1,327 @@
+package DragonBlood
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"strings"
+)
+
+// treeExporter renders trees for visualization.  Features without a
+// name are called feature_j, categories without a table are shown by
+// code, and classes without a label are shown by code.
+type treeExporter struct {
+	names   []string
+	tables  []StringTable
+	classes []string
+}
+
+// newTreeExporter returns an exporter for a model with the given
+// schema, with the feature names replaced by featureNames unless it
+// is nil.
+func newTreeExporter(schema featureSchema, featureNames []string, classes StringTable, nClasses int) *treeExporter {
+	e := &treeExporter{names: schema.names, tables: schema.tables}
+	if featureNames != nil {
+		if len(featureNames) != len(schema.names) {
+			panic(fmt.Sprintf("Argument mismatch: model has %d features, but len(featureNames)=%d", len(schema.names), len(featureNames)))
+		}
+		e.names = featureNames
+	}
+	if classes != nil {
+		e.classes = stringTableStrings(classes, nClasses)
+	}
+	return e
+}
+
+func (e *treeExporter) feature(j int) string {
+	if j < len(e.names) {
+		return e.names[j]
+	}
+	return fmt.Sprintf("feature_%d", j)
+}
+
+func (e *treeExporter) category(j, code int) string {
+	if j < len(e.tables) && e.tables[j] != nil && code < e.tables[j].Len() {
+		return e.tables[j].Decode(code)
+	}
+	return fmt.Sprint(code)
+}
+
+func (e *treeExporter) class(code int) string {
+	if code >= 0 && code < len(e.classes) {
+		return e.classes[code]
+	}
+	return fmt.Sprint(code)
+}
+
+// condition describes the units that splitter sends left from feature
+// j, or right if reverse is true.
+func (e *treeExporter) condition(j int, splitter Splitter, reverse bool) string {
+	var condition string
+	switch s := splitter.(type) {
+	case NumericSplitter:
+		if reverse {
+			return fmt.Sprintf("%s >= %g", e.feature(j), float64(s))
+		}
+		return fmt.Sprintf("%s < %g", e.feature(j), float64(s))
+	case CategorySetSplitter:
+		categories := make([]string, len(s))
+		for i, code := range s {
+			categories[i] = e.category(j, code)
+		}
+		condition = fmt.Sprintf("%s in {%s}", e.feature(j), strings.Join(categories, ", "))
+	default:
+		condition = fmt.Sprintf("%s %s", e.feature(j), splitter)
+	}
+	if reverse {
+		condition = "not " + condition
+	}
+	return condition
+}
+
+// predictionRange returns the smallest and largest predictions of the
+// nodes below n.
+func predictionRange(n *DecisionTreeNode) (low, high float64) {
+	low, high = n.prediction, n.prediction
+	if n.feature >= 0 {
+		for _, child := range []*DecisionTreeNode{n.Left, n.Right} {
+			l, h := predictionRange(child)
+			low, high = math.Min(low, l), math.Max(high, h)
+		}
+	}
+	return low, high
+}
+
+// classColors are the fill colors of the classes of classification
+// trees, repeated for more than ten classes.
+var classColors = []string{
+	"#e58139", "#399de5", "#47e539", "#e539c0", "#e5d839",
+	"#8139e5", "#39e5c5", "#e53958", "#7be539", "#3956e5",
+}
+
+// color returns the fill color of n, whose tree has predictions
+// between low and high.  Regression nodes are shaded by prediction and
+// classification nodes by the color of their majority class, shaded
+// by its share of the node.
+func (e *treeExporter) color(n *DecisionTreeNode, low, high float64) string {
+	hue, strength := classColors[0], 0.0
+	if n.distribution != nil {
+		p := n.probabilities(len(n.distribution))
+		if k := argmax(p); k >= 0 {
+			hue = classColors[k%len(classColors)]
+			if len(p) > 1 {
+				strength = (p[k] - 1/float64(len(p))) / (1 - 1/float64(len(p)))
+			}
+		}
+	} else if high > low {
+		strength = (n.prediction - low) / (high - low)
+	}
+	if math.IsNaN(strength) {
+		strength = 0
+	}
+	return fmt.Sprintf("%s%02x", hue, int(math.Round(255*clip(strength, 0, 1))))
+}
+
+// dotString quotes s as a DOT string.
+func dotString(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(s) + `"`
+}
+
+// writeDOT writes the tree below root as a Graphviz digraph.
+func (e *treeExporter) writeDOT(w io.Writer, root *DecisionTreeNode) error {
+	var b strings.Builder
+	b.WriteString("digraph Tree {\n")
+	b.WriteString("node [shape=box, style=\"filled, rounded\", fontname=\"helvetica\"];\n")
+	b.WriteString("edge [fontname=\"helvetica\"];\n")
+
+	if root != nil {
+		low, high := predictionRange(root)
+		next := 0
+		var write func(n *DecisionTreeNode) int
+		write = func(n *DecisionTreeNode) int {
+			id := next
+			next++
+
+			var lines []string
+			if n.feature >= 0 {
+				lines = append(lines, e.condition(n.feature, n.splitter, false))
+			}
+			lines = append(lines, fmt.Sprintf("samples = %d", n.size))
+			if n.weight != float64(n.size) {
+				lines = append(lines, fmt.Sprintf("weight = %g", n.weight))
+			}
+			if n.distribution != nil {
+				lines = append(lines, fmt.Sprintf("distribution = %v", n.distribution))
+				lines = append(lines, fmt.Sprintf("class = %s", e.class(int(n.prediction))))
+			} else {
+				lines = append(lines, fmt.Sprintf("prediction = %g", n.prediction))
+			}
+			if n.feature >= 0 {
+				lines = append(lines, fmt.Sprintf("reduction = %g", n.reduction))
+			}
+			fmt.Fprintf(&b, "%d [label=%s, fillcolor=%s];\n", id, dotString(strings.Join(lines, "\n")), dotString(e.color(n, low, high)))
+
+			if n.feature >= 0 {
+				missing := [2]string{"", ", missing"}
+				if n.missingLeft {
+					missing[0], missing[1] = missing[1], missing[0]
+				}
+				left := write(n.Left)
+				fmt.Fprintf(&b, "%d -> %d [label=%s];\n", id, left, dotString("true"+missing[0]))
+				right := write(n.Right)
+				fmt.Fprintf(&b, "%d -> %d [label=%s];\n", id, right, dotString("false"+missing[1]))
+			}
+			return id
+		}
+		write(root)
+	}
+
+	b.WriteString("}\n")
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// exportNode is the JSON form of a node written by writeJSON.
+type exportNode struct {
+	Condition    string        `json:"condition,omitempty"`
+	Feature      string        `json:"feature,omitempty"`
+	Threshold    *jsonFloat    `json:"threshold,omitempty"`
+	Categories   []string      `json:"categories,omitempty"`
+	Missing      string        `json:"missing,omitempty"`
+	Surrogates   []string      `json:"surrogates,omitempty"`
+	Samples      int           `json:"samples"`
+	Weight       jsonFloat     `json:"weight"`
+	Prediction   jsonFloat     `json:"prediction"`
+	Class        string        `json:"class,omitempty"`
+	Distribution []float64     `json:"distribution,omitempty"`
+	Reduction    jsonFloat     `json:"reduction,omitempty"`
+	Children     []*exportNode `json:"children,omitempty"`
+}
+
+func (e *treeExporter) node(n *DecisionTreeNode) *exportNode {
+	result := &exportNode{
+		Samples:      n.size,
+		Weight:       jsonFloat(n.weight),
+		Prediction:   jsonFloat(n.prediction),
+		Distribution: n.distribution,
+	}
+	if n.distribution != nil {
+		result.Class = e.class(int(n.prediction))
+	}
+	if n.feature < 0 {
+		return result
+	}
+
+	result.Condition = e.condition(n.feature, n.splitter, false)
+	result.Feature = e.feature(n.feature)
+	switch s := n.splitter.(type) {
+	case NumericSplitter:
+		threshold := jsonFloat(s)
+		result.Threshold = &threshold
+	case CategorySetSplitter:
+		result.Categories = make([]string, len(s))
+		for i, code := range s {
+			result.Categories[i] = e.category(n.feature, code)
+		}
+	}
+	result.Missing = "right"
+	if n.missingLeft {
+		result.Missing = "left"
+	}
+	for _, s := range n.surrogates {
+		result.Surrogates = append(result.Surrogates, e.condition(s.feature, s.splitter, s.reverse))
+	}
+	result.Reduction = jsonFloat(n.reduction)
+	result.Children = []*exportNode{e.node(n.Left), e.node(n.Right)}
+	return result
+}
+
+// writeJSON writes the tree below root as nested JSON objects.
+func (e *treeExporter) writeJSON(w io.Writer, root *DecisionTreeNode) error {
+	var node *exportNode
+	if root != nil {
+		node = e.node(root)
+	}
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(node)
+}
+
+// ExportDOT writes the tree below n in the Graphviz DOT language.
+// Each node shows its split condition, sample count, prediction (or
+// class distribution), and impurity reduction, and is shaded by its
+// prediction (or majority class).  Edges are labeled with the outcome
+// of the condition and with the direction of missing values.  Feature
+// j is labeled featureNames[j], or feature_j if featureNames is too
+// short.
+func (n *DecisionTreeNode) ExportDOT(w io.Writer, featureNames []string) error {
+	return (&treeExporter{names: featureNames}).writeDOT(w, n)
+}
+
+// ExportJSON writes the tree below n as a nested JSON object in which
+// each interior node lists its left and right children under
+// "children", as expected by d3.hierarchy.  Nodes carry the same
+// information as ExportDOT, along with the split threshold or
+// categories and any surrogate splits.
+func (n *DecisionTreeNode) ExportJSON(w io.Writer, featureNames []string) error {
+	return (&treeExporter{names: featureNames}).writeJSON(w, n)
+}
+
+// ExportDOT writes the tree in the Graphviz DOT language (see
+// DecisionTreeNode.ExportDOT), naming categories by their strings.
+// Features are labeled with the names of the training features unless
+// featureNames is non-nil.
+func (dtr *DecisionTree) ExportDOT(w io.Writer, featureNames []string) error {
+	return newTreeExporter(dtr.featureSchema, featureNames, nil, 0).writeDOT(w, dtr.root)
+}
+
+// ExportJSON writes the tree as nested JSON (see
+// DecisionTreeNode.ExportJSON).  See DecisionTree.ExportDOT.
+func (dtr *DecisionTree) ExportJSON(w io.Writer, featureNames []string) error {
+	return newTreeExporter(dtr.featureSchema, featureNames, nil, 0).writeJSON(w, dtr.root)
+}
+
+// ExportDOT writes the tree in the Graphviz DOT language, labeling
+// classes by their strings.  See DecisionTree.ExportDOT.
+func (dtc *DecisionTreeClassifier) ExportDOT(w io.Writer, featureNames []string) error {
+	return newTreeExporter(dtc.featureSchema, featureNames, dtc.classes, dtc.nClasses).writeDOT(w, dtc.root)
+}
+
+// ExportJSON writes the tree as nested JSON, labeling classes by their
+// strings.  See DecisionTree.ExportJSON.
+func (dtc *DecisionTreeClassifier) ExportJSON(w io.Writer, featureNames []string) error {
+	return newTreeExporter(dtc.featureSchema, featureNames, dtc.classes, dtc.nClasses).writeJSON(w, dtc.root)
+}
+
+// tree returns tree t of the forest, panicking if there is none.
+func (rf *randomForest) tree(t int) *DecisionTreeNode {
+	if t < 0 || t >= len(rf.trees) {
+		panic(fmt.Sprintf("Argument mismatch: forest has %d trees, but tree %d was requested", len(rf.trees), t))
+	}
+	return rf.trees[t]
+}
+
+// ExportTreeDOT writes tree t of the forest in the Graphviz DOT
+// language.  See DecisionTree.ExportDOT.
+func (rf *randomForest) ExportTreeDOT(w io.Writer, t int, featureNames []string) error {
+	return newTreeExporter(rf.featureSchema, featureNames, nil, 0).writeDOT(w, rf.tree(t))
+}
+
+// ExportTreeJSON writes tree t of the forest as nested JSON.  See
+// DecisionTree.ExportJSON.
+func (rf *randomForest) ExportTreeJSON(w io.Writer, t int, featureNames []string) error {
+	return newTreeExporter(rf.featureSchema, featureNames, nil, 0).writeJSON(w, rf.tree(t))
+}
+
+// ExportTreeDOT writes tree t of the forest in the Graphviz DOT
+// language, labeling classes by their strings.
+func (rf *RandomForestClassifier) ExportTreeDOT(w io.Writer, t int, featureNames []string) error {
+	return newTreeExporter(rf.featureSchema, featureNames, rf.classes, rf.nClasses).writeDOT(w, rf.tree(t))
+}
+
+// ExportTreeJSON writes tree t of the forest as nested JSON, labeling
+// classes by their strings.
+func (rf *RandomForestClassifier) ExportTreeJSON(w io.Writer, t int, featureNames []string) error {
+	return newTreeExporter(rf.featureSchema, featureNames, rf.classes, rf.nClasses).writeJSON(w, rf.tree(t))
+}
@@ -0,0 +1,123 @@
+package DragonBlood_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	db "github.com/mawicks/DragonBlood"
+)
+
+// exportedNode is the subset of the JSON written by ExportJSON that
+// the tests inspect.
+type exportedNode struct {
+	Condition string          `json:"condition"`
+	Samples   int             `json:"samples"`
+	Class     string          `json:"class"`
+	Children  []*exportedNode `json:"children"`
+}
+
+func (n *exportedNode) leaves() int {
+	if len(n.Children) == 0 {
+		return 1
+	}
+	return n.Children[0].leaves() + n.Children[1].leaves()
+}
+
+func TestExportDOTAndJSON(test *testing.T) {
+	x := db.NewNumericFeature(nil)
+	x.Add(0, 1, 2, 3, 4, 5, 6, 7)
+	c := db.NewCategoricalFeature(db.NewStringTable())
+	c.AddFromString("red", "blue", "red", "blue", "red", "blue", "red", "blue")
+	t := db.NewNumericFeature(nil)
+	t.Add(0, 10, 1, 11, 2, 12, 3, 13)
+	features := []db.OrderedFeature{x, c}
+
+	dt := db.NewDecisionTreeRegressor()
+	dt.Fit(features, t)
+
+	var dot bytes.Buffer
+	if err := dt.ExportDOT(&dot, []string{"width", "color"}); err != nil {
+		test.Fatalf("ExportDOT returned %v", err)
+	}
+	s := dot.String()
+	if !strings.HasPrefix(s, "digraph Tree {") || !strings.HasSuffix(s, "}\n") {
+		test.Errorf("ExportDOT did not write a digraph:\n%s", s)
+	}
+	for _, want := range []string{"width < ", "color in {", "samples = 8", "prediction = 6.5", "reduction = "} {
+		if !strings.Contains(s, want) {
+			test.Errorf("ExportDOT output lacks %q:\n%s", want, s)
+		}
+	}
+	if strings.Contains(s, "feature_") {
+		test.Errorf("ExportDOT used raw feature indices despite names:\n%s", s)
+	}
+
+	var text bytes.Buffer
+	dt.Dump(&text)
+	leaves := strings.Count(text.String(), "(LEAF)")
+	if nodes, edges := strings.Count(s, "fillcolor="), strings.Count(s, "->"); nodes != 2*leaves-1 || edges != nodes-1 {
+		test.Errorf("ExportDOT wrote %d nodes and %d edges for %d leaves", nodes, edges, leaves)
+	}
+
+	var encoded bytes.Buffer
+	if err := dt.ExportJSON(&encoded, nil); err != nil {
+		test.Fatalf("ExportJSON returned %v", err)
+	}
+	var root exportedNode
+	if err := json.Unmarshal(encoded.Bytes(), &root); err != nil {
+		test.Fatalf("ExportJSON wrote invalid JSON: %v", err)
+	}
+	if root.Samples != 8 || root.leaves() != leaves {
+		test.Errorf("ExportJSON root has %d samples and %d leaves; expected 8 and %d", root.Samples, root.leaves(), leaves)
+	}
+	if root.Condition != "feature_1 in {red}" && root.Condition != "feature_1 in {blue}" {
+		test.Errorf("ExportJSON did not name categories:\n%s", encoded.String())
+	}
+}
+
+func TestExportClassifierAndForest(test *testing.T) {
+	x := db.NewNumericFeature(nil)
+	x.Add(0, 1, 2, 3, 4, 5, 6, 7)
+	class := db.NewCategoricalFeature(db.NewStringTable())
+	class.AddFromString("no", "no", "no", "no", "yes", "yes", "yes", "yes")
+	features := []db.OrderedFeature{x}
+
+	dtc := db.NewDecisionTreeClassifier(db.Gini)
+	dtc.Fit(features, class)
+	var encoded bytes.Buffer
+	if err := dtc.ExportJSON(&encoded, []string{"x"}); err != nil {
+		test.Fatalf("ExportJSON returned %v", err)
+	}
+	var root exportedNode
+	if err := json.Unmarshal(encoded.Bytes(), &root); err != nil {
+		test.Fatalf("ExportJSON wrote invalid JSON: %v", err)
+	}
+	if root.Condition != "x < 3.5" || len(root.Children) != 2 || root.Children[0].Class != "no" || root.Children[1].Class != "yes" {
+		test.Errorf("ExportJSON wrote unexpected tree:\n%s", encoded.String())
+	}
+
+	rf := db.NewRandomForestClassifier(3, db.Gini, db.WithSeed(1))
+	rf.Fit(features, class)
+	var dot bytes.Buffer
+	if err := rf.ExportTreeDOT(&dot, 2, nil); err != nil {
+		test.Fatalf("ExportTreeDOT returned %v", err)
+	}
+	if !strings.Contains(dot.String(), "class = ") || strings.Contains(dot.String(), "class = 0") {
+		test.Errorf("ExportTreeDOT did not label classes:\n%s", dot.String())
+	}
+
+	rfr := db.NewRandomForestRegressor(3, db.WithSeed(1))
+	rfr.Fit(features, x)
+	for _, t := range []int{-1, 3} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					test.Errorf("ExportTreeJSON(%d) did not panic for a forest of 3 trees", t)
+				}
+			}()
+			rfr.ExportTreeJSON(&dot, t, nil)
+		}()
+	}
+}
@@ -0,0 +1,196 @@
+package DragonBlood
+
+import (
+	"math"
+	"math/rand"
+	"sort"
+)
+
+// WithBootstrap selects whether each tree of a forest is grown on a
+// bootstrap sample (the default for random forests) or on every unit
+// (the default for extra trees).  Trees grown without bootstrap have
+// no out-of-bag units, so the out-of-bag predictions returned by Fit
+// are NaN.
+func WithBootstrap(bootstrap bool) Option {
+	return func(dtg *decisionTreeGrower) { dtg.Bootstrap = bootstrap }
+}
+
+// withRandomSplits makes the grower draw one random split per feature
+// and node rather than searching for the best one.
+func withRandomSplits(dtg *decisionTreeGrower) { dtg.randomSplits = true }
+
+// ExtraTreesRegressor is a forest of extremely randomized regression
+// trees (Geurts et al. 2006).  Rather than searching every cut point
+// of a candidate feature, each node draws a single threshold
+// uniformly between the feature's minimum and maximum within the node
+// (or a random subset of a categorical feature's categories) and the
+// best of these random splits over the candidate features is kept.
+// Unless configured otherwise with WithBootstrap, each tree is grown
+// on every unit.
+//
+// The trained model is an ordinary forest: it is saved as, and may be
+// loaded as, a RandomForestRegressor.
+type ExtraTreesRegressor struct {
+	RandomForestRegressor
+}
+
+// NewExtraTreesRegressor returns a forest of nTrees extremely
+// randomized regression trees.  Unless configured otherwise, the
+// trees minimize squared error (MSECriterion).
+func NewExtraTreesRegressor(nTrees int, options ...Option) *ExtraTreesRegressor {
+	options = append([]Option{withRandomSplits, WithBootstrap(false)}, options...)
+	return &ExtraTreesRegressor{
+		RandomForestRegressor{newRandomForest(nTrees, newDecisionTreeGrower(MSECriterion{}, options))},
+	}
+}
+
+// ExtraTreesClassifier is a forest of extremely randomized
+// classification trees.  See ExtraTreesRegressor.  The trained model
+// is saved as, and may be loaded as, a RandomForestClassifier.
+type ExtraTreesClassifier struct {
+	RandomForestClassifier
+}
+
+// NewExtraTreesClassifier returns a forest of nTrees extremely
+// randomized classification trees.
+func NewExtraTreesClassifier(nTrees int, impurity Impurity, options ...Option) *ExtraTreesClassifier {
+	options = append([]Option{withRandomSplits, WithBootstrap(false)}, options...)
+	return &ExtraTreesClassifier{
+		RandomForestClassifier{newRandomForest(nTrees, newDecisionTreeGrower(impurity, options)), nil, 0},
+	}
+}
+
+// dtRandomSplit draws a random split of feature f for each splittable
+// node and evaluates it using criterion.  Numeric thresholds are drawn
+// uniformly between the smallest and largest values of f in the node;
+// categorical splits send a random, non-empty, proper subset of the
+// categories present in the node to the left.  As in dtOptimalSplit(),
+// units with missing values are sent right and, if the node has any,
+// left, and the better direction is recorded.  Other arguments are as
+// for dtOptimalSplit().
+func dtRandomSplit(
+	f Feature,
+	target Feature,
+	nodeMembership []int,
+	nodeCount int,
+	bag Bag,
+	criterion SplitCriterion,
+	minSize float64,
+	rng *rand.Rand) []*SplitInfo {
+
+	_, categorical := f.(*CategoricalFeature)
+
+	min := make([]float64, nodeCount)
+	max := make([]float64, nodeCount)
+	for node := range min {
+		min[node], max[node] = math.Inf(1), math.Inf(-1)
+	}
+	categories := make([]map[int]bool, nodeCount)
+	for i, node := range nodeMembership {
+		if node >= 0 && bag.Count(i) > 0 {
+			if x := f.NumericValue(i); !math.IsNaN(x) {
+				min[node], max[node] = math.Min(min[node], x), math.Max(max[node], x)
+				if categorical {
+					if categories[node] == nil {
+						categories[node] = make(map[int]bool)
+					}
+					categories[node][int(x)] = true
+				}
+			}
+		}
+	}
+
+	// Draw the splitters in node order so that the random stream
+	// doesn't depend on anything but the data.
+	splitters := make([]Splitter, nodeCount)
+	for node := range splitters {
+		if !(min[node] < max[node]) {
+			continue
+		}
+		if categorical {
+			splitters[node] = randomCategorySplitter(categories[node], rng)
+		} else {
+			splitters[node] = NumericSplitter(min[node] + rng.Float64()*(max[node]-min[node]))
+		}
+	}
+
+	// Group the units of each node by the side of the split to which
+	// they go (left, right, or missing).
+	const left, right, missing = 0, 1, 2
+	sides := make([][3][]int, nodeCount)
+	for i, node := range nodeMembership {
+		if node >= 0 && bag.Count(i) > 0 && splitters[node] != nil {
+			side := right
+			if x := f.NumericValue(i); math.IsNaN(x) {
+				side = missing
+			} else if splitters[node].Split(x) {
+				side = left
+			}
+			sides[node][side] = append(sides[node][side], i)
+		}
+	}
+
+	// evaluate passes the units of groups, in order, to a new
+	// accumulator.  The units of the first group are moved with
+	// feature value 0 and the others with feature value 1, so the
+	// only split the accumulator sees is the one between the first
+	// group and the rest.
+	evaluate := func(groups ...[]int) *SplitInfo {
+		accumulator := criterion.NewAccumulator(minSize)
+		for g := len(groups) - 1; g >= 0; g-- {
+			for u := len(groups[g]) - 1; u >= 0; u-- {
+				i := groups[g][u]
+				for j := 0; j < bag.Count(i); j++ {
+					accumulator.Add(target.NumericValue(i), bag.Weight(i))
+				}
+			}
+		}
+		for g, group := range groups {
+			featureValue := math.Min(float64(g), 1.0)
+			for _, i := range group {
+				for j := 0; j < bag.Count(i); j++ {
+					accumulator.Move(featureValue, target.NumericValue(i), bag.Weight(i))
+				}
+			}
+		}
+		return accumulator.BestSplit()
+	}
+
+	result := make([]*SplitInfo, nodeCount)
+	for node, splitter := range splitters {
+		if splitter == nil {
+			continue
+		}
+		s := &sides[node]
+		split := evaluate(s[left], s[right], s[missing])
+		if len(s[missing]) > 0 {
+			missingLeft := evaluate(append(append([]int(nil), s[missing]...), s[left]...), s[right])
+			if missingLeft != nil && (split == nil || missingLeft.reduction > split.reduction) {
+				missingLeft.missingLeft = true
+				split = missingLeft
+			}
+		} else if split != nil {
+			split.missingLeft = split.left.weight > split.right.weight
+		}
+		if split != nil {
+			split.splitter = splitter
+			result[node] = split
+		}
+	}
+	return result
+}
+
+// randomCategorySplitter returns a splitter that sends a random,
+// non-empty, proper subset of categories (which must hold at least two
+// codes) to the left.
+func randomCategorySplitter(categories map[int]bool, rng *rand.Rand) CategorySetSplitter {
+	present := make([]int, 0, len(categories))
+	for code := range categories {
+		present = append(present, code)
+	}
+	sort.Ints(present)
+	rng.Shuffle(len(present), func(i, j int) { present[i], present[j] = present[j], present[i] })
+	left := present[:1+rng.Intn(len(present)-1)]
+	sort.Ints(left)
+	return CategorySetSplitter(left)
+}
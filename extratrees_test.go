@@ -0,0 +1,96 @@
+package DragonBlood_test
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+
+	db "github.com/mawicks/DragonBlood"
+)
+
+func TestExtraTreesRegressor(test *testing.T) {
+	rng := rand.New(rand.NewSource(3))
+	x := db.NewNumericFeature(nil)
+	noise := db.NewNumericFeature(nil)
+	t := db.NewNumericFeature(nil)
+	for i := 0; i < 200; i++ {
+		xi := rng.Float64()
+		x.Add(xi)
+		noise.Add(rng.Float64())
+		t.Add(math.Floor(4 * xi))
+	}
+	features := []db.OrderedFeature{x, noise}
+
+	et := db.NewExtraTreesRegressor(20, db.WithSeed(1))
+	oob := et.Fit(features, t)
+	for i, p := range oob {
+		if !math.IsNaN(p) {
+			test.Errorf("Row %d: out-of-bag prediction %v without bootstrap; expected NaN", i, p)
+			break
+		}
+	}
+
+	mse := 0.0
+	for i, p := range et.Predict([]db.Feature{x, noise}) {
+		mse += (p - t.NumericValue(i)) * (p - t.NumericValue(i)) / float64(t.Len())
+	}
+	if mse > 0.01 {
+		test.Errorf("Training MSE is %v; expected a near-perfect fit", mse)
+	}
+
+	// Bootstrap samples leave units out of bag
+	bootstrapped := db.NewExtraTreesRegressor(20, db.WithSeed(1), db.WithBootstrap(true))
+	count := 0
+	for _, p := range bootstrapped.Fit(features, t) {
+		if !math.IsNaN(p) {
+			count++
+		}
+	}
+	if count == 0 {
+		test.Errorf("No out-of-bag predictions with bootstrap")
+	}
+
+	// Random thresholds fall anywhere between the training values,
+	// unlike those of the exhaustive search, which are midpoints.
+	rf := db.NewRandomForestRegressor(20, db.WithSeed(1), db.WithBootstrap(false))
+	rf.Fit(features, t)
+
+	grid := db.NewNumericFeature(nil)
+	zero := db.NewNumericFeature(nil)
+	for i := 0; i < 1000; i++ {
+		grid.Add(float64(i) / 1000)
+		zero.Add(0)
+	}
+	rfPrediction := rf.Predict([]db.Feature{grid, zero})
+	differ := false
+	for i, p := range et.Predict([]db.Feature{grid, zero}) {
+		differ = differ || p != rfPrediction[i]
+	}
+	if !differ {
+		test.Errorf("Extra trees and random forest made identical predictions")
+	}
+}
+
+func TestExtraTreesClassifier(test *testing.T) {
+	c := db.NewCategoricalFeature(db.NewStringTable())
+	t := db.NewCategoricalFeature(db.NewStringTable())
+	x := db.NewNumericFeature(nil)
+	for i := 0; i < 60; i++ {
+		category := []string{"a", "b", "c", "d"}[i%4]
+		c.AddFromString(category)
+		x.Add(float64(i % 5))
+		if category == "a" || category == "c" {
+			t.AddFromString("yes")
+		} else {
+			t.AddFromString("no")
+		}
+	}
+
+	et := db.NewExtraTreesClassifier(10, db.Gini, db.WithSeed(2))
+	et.Fit([]db.OrderedFeature{c, x}, t)
+	for i, p := range et.Predict([]db.Feature{c, x}) {
+		if p != t.Value(i) {
+			test.Errorf("Row %d: predicted %v; actual %v", i, p, t.Value(i))
+		}
+	}
+}
@@ -0,0 +1,510 @@
+package DragonBlood
+
+import (
+	"math"
+	"sort"
+)
+
+const (
+	// maxBins is the largest number of bins of a binned feature.
+	maxBins = 255
+
+	// missingBin is the bin of missing values.
+	missingBin = 255
+
+	// binSampleSize is the number of values sampled to choose the
+	// bin boundaries of a feature.
+	binSampleSize = 200000
+)
+
+// WithMaxBins quantizes each numeric feature into at most n bins
+// (at most 255) before training, so that splits are found by scanning
+// bins rather than sorted units.  Bins are chosen from the quantiles
+// of the training values and thresholds are placed between the values
+// of adjacent bins, so trees predict from raw feature values as usual.
+// Features with n or fewer distinct values yield the same splits as
+// unbinned features.  Binned features aren't used as surrogates.
+// Zero (the default) disables binning.
+func WithMaxBins(n int) Option {
+	return func(dtg *decisionTreeGrower) { dtg.MaxBins = n }
+}
+
+// binnedFeature is a numeric feature quantized into bins.  It presents
+// the raw values of the feature, but has no order (InOrder() panics);
+// splits are found from its bins.
+type binnedFeature struct {
+	Feature
+
+	// bins holds the bin of each unit (missingBin for missing values).
+	bins []uint8
+
+	// thresholds[b] separates bin b from bin b+1: x belongs to a bin
+	// less than or equal to b if x < thresholds[b].
+	thresholds []float64
+}
+
+// newBinnedFeature quantizes f into at most n bins.
+func newBinnedFeature(f Feature, n int) *binnedFeature {
+	if n > maxBins {
+		n = maxBins
+	}
+
+	// An empty feature has no values to sample but still needs a stride.
+	stride := (f.Len() + binSampleSize - 1) / binSampleSize
+	if stride < 1 {
+		stride = 1
+	}
+	values := make([]float64, 0, f.Len()/stride+1)
+	for i := 0; i < f.Len(); i += stride {
+		if x := f.NumericValue(i); !math.IsNaN(x) {
+			values = append(values, x)
+		}
+	}
+	sort.Float64s(values)
+
+	// distinct[j] is the jth distinct value and cumulative[j] is the
+	// number of values less than or equal to it.
+	var distinct []float64
+	var cumulative []int
+	for i, x := range values {
+		if i == 0 || x != distinct[len(distinct)-1] {
+			distinct = append(distinct, x)
+			cumulative = append(cumulative, 0)
+		}
+		cumulative[len(cumulative)-1] = i + 1
+	}
+
+	var thresholds []float64
+	if len(distinct) <= n {
+		for j := 1; j < len(distinct); j++ {
+			thresholds = append(thresholds, splitThreshold(distinct[j-1], distinct[j]))
+		}
+	} else {
+		j := 0
+		for k := 1; k < n; k++ {
+			target := k * len(values) / n
+			for j < len(distinct)-2 && cumulative[j] < target {
+				j++
+			}
+			if threshold := splitThreshold(distinct[j], distinct[j+1]); len(thresholds) == 0 || threshold > thresholds[len(thresholds)-1] {
+				thresholds = append(thresholds, threshold)
+			}
+		}
+	}
+
+	bf := &binnedFeature{f, make([]uint8, f.Len()), thresholds}
+	for i := range bf.bins {
+		bf.bins[i] = bf.bin(f.NumericValue(i))
+	}
+	return bf
+}
+
+// bin returns the bin of x.
+func (bf *binnedFeature) bin(x float64) uint8 {
+	if math.IsNaN(x) {
+		return missingBin
+	}
+	return uint8(sort.Search(len(bf.thresholds), func(b int) bool { return bf.thresholds[b] > x }))
+}
+
+func (bf *binnedFeature) nBins() int { return len(bf.thresholds) + 1 }
+
+// index returns the histogram index of unit i, which is nBins() for
+// missing values.
+func (bf *binnedFeature) index(i int) int {
+	if b := bf.bins[i]; b != missingBin {
+		return int(b)
+	}
+	return bf.nBins()
+}
+
+func (bf *binnedFeature) Prepare() {}
+
+func (bf *binnedFeature) InOrder(int) int {
+	panic("InOrder() called on a binned feature")
+}
+
+// splitter maps a NumericSplitter on bin indexes, whose threshold lies
+// midway between two bins, to a NumericSplitter on raw values.
+func (bf *binnedFeature) splitter(s NumericSplitter) NumericSplitter {
+	t := float64(s)
+	if math.IsInf(t, 0) {
+		return s
+	}
+	return NumericSplitter(bf.thresholds[int(math.Floor(t))])
+}
+
+// histogram holds the sufficient statistics of the targets of a node
+// by bin.  The last entry holds the missing values.
+type histogram struct {
+	count  []int
+	weight []float64
+	sum    []float64
+
+	// classWeights holds the weight of each class by bin
+	// (classification only).
+	classWeights [][]float64
+}
+
+func newHistogram(nBins, nClasses int) *histogram {
+	h := &histogram{
+		count:  make([]int, nBins+1),
+		weight: make([]float64, nBins+1),
+		sum:    make([]float64, nBins+1),
+	}
+	if nClasses > 0 {
+		h.classWeights = make([][]float64, nBins+1)
+		for b := range h.classWeights {
+			h.classWeights[b] = make([]float64, nClasses)
+		}
+	}
+	return h
+}
+
+func (h *histogram) add(b, count int, weight, target float64) {
+	h.count[b] += count
+	h.weight[b] += float64(count) * weight
+	h.sum[b] += float64(count) * weight * target
+	if h.classWeights != nil {
+		h.classWeights[b][int(target)] += float64(count) * weight
+	}
+}
+
+// difference returns the histogram of the sibling of the node whose
+// histogram is h given the histogram of their parent.
+func (h *histogram) difference(parent *histogram) *histogram {
+	result := newHistogram(len(h.count)-1, 0)
+	if h.classWeights != nil {
+		result.classWeights = make([][]float64, len(h.classWeights))
+	}
+	for b := range h.count {
+		result.count[b] = parent.count[b] - h.count[b]
+		if result.count[b] > 0 {
+			result.weight[b] = parent.weight[b] - h.weight[b]
+			result.sum[b] = parent.sum[b] - h.sum[b]
+		}
+		if h.classWeights != nil {
+			result.classWeights[b] = make([]float64, len(h.classWeights[b]))
+			if result.count[b] > 0 {
+				for k := range result.classWeights[b] {
+					result.classWeights[b][k] = parent.classWeights[b][k] - h.classWeights[b][k]
+				}
+			}
+		}
+	}
+	return result
+}
+
+// emit passes the entries of bin b to f.  The entries are the mean
+// target and weight of the bin or, for classification, the weight of
+// each class.  Splitting on these entries rather than on the units
+// gives the same reduction for criteria whose impurity is a sum of
+// per-unit terms less a function of the node's sufficient statistics.
+func (h *histogram) emit(b int, f func(target, weight float64)) {
+	if h.count[b] == 0 {
+		return
+	}
+	if h.classWeights != nil {
+		for k, w := range h.classWeights[b] {
+			if w > 0 {
+				f(float64(k), w)
+			}
+		}
+	} else if h.weight[b] > 0 {
+		f(h.sum[b]/h.weight[b], h.weight[b])
+	} else {
+		f(0.0, 0.0)
+	}
+}
+
+// histogramCriterion returns true if splits for criterion may be
+// found from histograms.
+func histogramCriterion(criterion SplitCriterion) bool {
+	switch criterion.(type) {
+	case MSECriterion, FriedmanMSECriterion, PoissonCriterion, Impurity:
+		return true
+	}
+	return false
+}
+
+// histogramCache holds the histograms of the binned features for one
+// generation of splittable nodes.  The histograms of the larger child
+// of a split are computed as the difference between those of its
+// parent and of its sibling (the "subtraction trick"), so only the
+// units of the smaller child are scanned.
+type histogramCache struct {
+	binned   []*binnedFeature
+	nClasses int
+
+	// nodes[node][f] is the histogram of node for feature f or nil
+	// if f is not binned.  nodes[node] is nil until computed.
+	nodes [][]*histogram
+
+	// If parent[node] is not nil, the histograms of node are those
+	// of parent[node] less those of node sibling[node].
+	parent  [][]*histogram
+	sibling []int
+}
+
+// newHistogramCache returns a cache for the root of a tree or nil if
+// no feature is binned or criterion cannot split histograms.
+func newHistogramCache(features []OrderedFeature, target Feature, bag Bag, criterion SplitCriterion) *histogramCache {
+	if !histogramCriterion(criterion) {
+		return nil
+	}
+
+	hc := &histogramCache{
+		binned:  make([]*binnedFeature, len(features)),
+		nodes:   [][]*histogram{nil},
+		parent:  [][]*histogram{nil},
+		sibling: []int{-1},
+	}
+	found := false
+	for f, feature := range features {
+		hc.binned[f], _ = feature.(*binnedFeature)
+		found = found || hc.binned[f] != nil
+	}
+	if !found {
+		return nil
+	}
+
+	if _, ok := criterion.(Impurity); ok {
+		for i := 0; i < bag.Len(); i++ {
+			if k := int(target.NumericValue(i)); bag.Count(i) > 0 && k >= hc.nClasses {
+				hc.nClasses = k + 1
+			}
+		}
+	}
+	return hc
+}
+
+// build computes the histograms of the nodes to be evaluated.
+// nodeMembership maps each unit to its splittable node.
+func (hc *histogramCache) build(target Feature, bag Bag, nodeMembership []int, evaluate []bool) {
+	scan := make([]bool, len(evaluate))
+	needed := false
+	for node, e := range evaluate {
+		if e && hc.nodes[node] == nil {
+			if hc.parent[node] == nil {
+				scan[node] = true
+			} else if sibling := hc.sibling[node]; hc.nodes[sibling] == nil {
+				scan[sibling] = true
+			}
+			needed = true
+		}
+	}
+	if !needed {
+		return
+	}
+
+	for node := range scan {
+		if scan[node] {
+			hc.nodes[node] = make([]*histogram, len(hc.binned))
+			for f, bf := range hc.binned {
+				if bf != nil {
+					hc.nodes[node][f] = newHistogram(bf.nBins(), hc.nClasses)
+				}
+			}
+		}
+	}
+	for i, node := range nodeMembership {
+		if node >= 0 && scan[node] && bag.Count(i) > 0 {
+			for f, bf := range hc.binned {
+				if bf != nil {
+					hc.nodes[node][f].add(bf.index(i), bag.Count(i), bag.Weight(i), target.NumericValue(i))
+				}
+			}
+		}
+	}
+
+	for node, e := range evaluate {
+		if e && hc.nodes[node] == nil {
+			sibling := hc.nodes[hc.sibling[node]]
+			hc.nodes[node] = make([]*histogram, len(hc.binned))
+			for f, h := range sibling {
+				if h != nil {
+					hc.nodes[node][f] = h.difference(hc.parent[node][f])
+				}
+			}
+		}
+	}
+}
+
+// histograms returns the histograms of feature f for the nodes to be
+// evaluated (nil for other nodes).
+func (hc *histogramCache) histograms(f int, evaluate []bool) []*histogram {
+	result := make([]*histogram, len(evaluate))
+	for node, e := range evaluate {
+		if e {
+			result[node] = hc.nodes[node][f]
+		}
+	}
+	return result
+}
+
+// advance prepares the cache for the next generation of splittable
+// nodes, of which there are nextCount, given the splits applied to
+// the current generation by dtApplySplits().
+func (hc *histogramCache) advance(splittableNodes []*DecisionTreeNode, nodeSplits []*SplitPair, nextCount int) {
+	nodes := make([][]*histogram, nextCount)
+	parent := make([][]*histogram, nextCount)
+	sibling := make([]int, nextCount)
+
+	for inode, pair := range nodeSplits {
+		if pair == nil || hc.nodes[inode] == nil {
+			continue
+		}
+		if pair.left == pair.right { // Deferred
+			nodes[pair.left] = hc.nodes[inode]
+			continue
+		}
+
+		smaller, larger := pair.left, pair.right
+		if node := splittableNodes[inode]; node.Left.size > node.Right.size {
+			smaller, larger = larger, smaller
+		}
+		parent[larger] = hc.nodes[inode]
+		sibling[larger] = smaller
+	}
+
+	hc.nodes, hc.parent, hc.sibling = nodes, parent, sibling
+}
+
+// dtBinnedSplit computes an optimal split of binned feature f for each
+// splittable node.  If histograms is not nil, it holds the histogram
+// of each node to be evaluated (nil for other nodes); otherwise the
+// units of each node are scanned in order of their bins.  Other
+// arguments are as for dtOptimalSplit().
+func dtBinnedSplit(
+	f *binnedFeature,
+	histograms []*histogram,
+	target Feature,
+	nodeMembership []int,
+	nodeCount int,
+	bag Bag,
+	criterion SplitCriterion,
+	minSize float64) []*SplitInfo {
+
+	nBins := f.nBins()
+
+	// emitters[node] passes the entries of a bin to a function and
+	// counts[node] holds the number of units in each bin.
+	emitters := make([]func(b int, f func(target, weight float64)), nodeCount)
+	counts := make([][]int, nodeCount)
+	if histograms != nil {
+		for node, h := range histograms {
+			if h != nil {
+				emitters[node] = h.emit
+				counts[node] = h.count
+			}
+		}
+	} else {
+		units := make([][][]int, nodeCount)
+		for i, node := range nodeMembership {
+			if node >= 0 && bag.Count(i) > 0 {
+				if units[node] == nil {
+					units[node] = make([][]int, nBins+1)
+					counts[node] = make([]int, nBins+1)
+				}
+				b := f.index(i)
+				units[node][b] = append(units[node][b], i)
+				counts[node][b] += bag.Count(i)
+			}
+		}
+		for node, nodeUnits := range units {
+			if nodeUnits != nil {
+				nodeUnits := nodeUnits
+				emitters[node] = func(b int, f func(target, weight float64)) {
+					for _, i := range nodeUnits[b] {
+						for j := 0; j < bag.Count(i); j++ {
+							f(target.NumericValue(i), bag.Weight(i))
+						}
+					}
+				}
+			}
+		}
+	}
+
+	result := make([]*SplitInfo, nodeCount)
+	for node, emit := range emitters {
+		if emit == nil {
+			continue
+		}
+		split := dtScanBins(nBins, counts[node][nBins] > 0, emit, criterion, minSize)
+		if split == nil {
+			continue
+		}
+
+		// Restore the sizes of the children, which count
+		// histogram entries rather than units.
+		threshold := float64(split.splitter.(NumericSplitter))
+		leftSize, size := 0, 0
+		for b, count := range counts[node] {
+			if (b < nBins && float64(b) < threshold) || (b == nBins && split.missingLeft) {
+				leftSize += count
+			}
+			size += count
+		}
+		split.left.size, split.right.size = leftSize, size-leftSize
+
+		split.splitter = f.splitter(NumericSplitter(threshold))
+		result[node] = split
+	}
+	return result
+}
+
+// dtScanBins finds the best split of a node whose bins (with the bin
+// of missing values last) pass their entries to emit.  As in
+// dtOptimalSplit(), missing values are first sent right and, if the
+// node has any, then sent left.  The threshold of the resulting
+// splitter is in units of bins.
+func dtScanBins(nBins int, hasMissing bool, emit func(b int, f func(target, weight float64)), criterion SplitCriterion, minSize float64) *SplitInfo {
+	missingRight := criterion.NewAccumulator(minSize)
+	for b := nBins; b >= 0; b-- {
+		emit(b, missingRight.Add)
+	}
+	for b := 0; b <= nBins; b++ {
+		featureValue := float64(b)
+		if b == nBins {
+			featureValue = math.Inf(1)
+		}
+		emit(b, func(target, weight float64) { missingRight.Move(featureValue, target, weight) })
+	}
+	result := missingRight.BestSplit()
+
+	if hasMissing {
+		missingLeft := criterion.NewAccumulator(minSize)
+		for b := nBins - 1; b >= 0; b-- {
+			emit(b, missingLeft.Add)
+		}
+		emit(nBins, missingLeft.Add)
+		emit(nBins, func(target, weight float64) { missingLeft.Move(math.Inf(-1), target, weight) })
+		for b := 0; b < nBins; b++ {
+			featureValue := float64(b)
+			emit(b, func(target, weight float64) { missingLeft.Move(featureValue, target, weight) })
+		}
+		if split := missingLeft.BestSplit(); split != nil && (result == nil || split.reduction > result.reduction) {
+			split.missingLeft = true
+			result = split
+		}
+	} else if result != nil {
+		result.missingLeft = result.left.weight > result.right.weight
+	}
+	return result
+}
+
+// prepare readies features for training: numeric features are binned
+// if MaxBins is set and all other features are prepared in place.
+// The result replaces features in calls to grow().
+func (dtg *decisionTreeGrower) prepare(features []OrderedFeature) []OrderedFeature {
+	prepared := make([]OrderedFeature, len(features))
+	for i, f := range features {
+		if _, ok := f.(*CategoricalFeature); !ok && dtg.MaxBins > 0 {
+			prepared[i] = newBinnedFeature(f, dtg.MaxBins)
+		} else {
+			f.Prepare()
+			prepared[i] = f
+		}
+	}
+	return prepared
+}
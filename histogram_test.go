@@ -0,0 +1,121 @@
+package DragonBlood_test
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+
+	db "github.com/mawicks/DragonBlood"
+)
+
+// binningData returns features with few distinct values (some
+// missing) and a target depending on them.
+func binningData(n int) ([]*db.NumericFeature, []float64) {
+	rng := rand.New(rand.NewSource(1))
+	x := db.NewNumericFeature(nil)
+	y := db.NewNumericFeature(nil)
+	t := make([]float64, n)
+	for i := 0; i < n; i++ {
+		xi, yi := float64(rng.Intn(20)), float64(rng.Intn(7))
+		t[i] = float64(int(xi)%5) + 3*yi + float64(rng.Intn(3))
+		if rng.Intn(10) == 0 {
+			yi = math.NaN()
+		}
+		x.Add(xi)
+		y.Add(yi)
+	}
+	return []*db.NumericFeature{x, y}, t
+}
+
+func TestBinnedDecisionTreeRegressor(test *testing.T) {
+	x, t := binningData(500)
+	target := db.NewNumericFeature(t)
+	features := []db.Feature{x[0], x[1]}
+
+	// With fewer distinct values than bins, binned and unbinned
+	// trees choose the same splits.
+	for _, criterion := range []db.SplitCriterion{db.MSECriterion{}, db.PoissonCriterion{}, db.MAECriterion{}} {
+		for _, limit := range []db.Option{db.WithMaxDepth(6), db.WithMaxLeafNodes(12)} {
+			exact := db.NewDecisionTreeRegressor(db.WithCriterion(criterion), limit, db.WithSeed(1))
+			exact.Fit([]db.OrderedFeature{x[0], x[1]}, target)
+
+			binned := db.NewDecisionTreeRegressor(db.WithCriterion(criterion), limit, db.WithSeed(1), db.WithMaxBins(32))
+			binned.Fit([]db.OrderedFeature{x[0], x[1]}, target)
+
+			expected := exact.Predict(features)
+			for i, p := range binned.Predict(features) {
+				if math.Abs(p-expected[i]) > 1e-9 {
+					test.Errorf("%T: row %d: binned tree predicted %v; unbinned tree predicted %v", criterion, i, p, expected[i])
+				}
+			}
+		}
+	}
+}
+
+func TestBinnedDecisionTreeClassifier(test *testing.T) {
+	x, t := binningData(500)
+	target := db.NewCategoricalFeature(db.NewStringTable())
+	for _, ti := range t {
+		target.AddFromString([]string{"low", "mid", "high"}[int(ti)%3])
+	}
+	features := []db.Feature{x[0], x[1]}
+
+	exact := db.NewDecisionTreeClassifier(db.Gini, db.WithMaxDepth(5), db.WithSeed(1))
+	exact.Fit([]db.OrderedFeature{x[0], x[1]}, target)
+
+	binned := db.NewDecisionTreeClassifier(db.Gini, db.WithMaxDepth(5), db.WithSeed(1), db.WithMaxBins(255))
+	binned.Fit([]db.OrderedFeature{x[0], x[1]}, target)
+
+	expected := exact.PredictProba(features)
+	for i, p := range binned.PredictProba(features) {
+		for k := range p {
+			if math.Abs(p[k]-expected[i][k]) > 1e-9 {
+				test.Errorf("Row %d: binned tree predicted %v; unbinned tree predicted %v", i, p, expected[i])
+				break
+			}
+		}
+	}
+}
+
+func TestBinnedThresholds(test *testing.T) {
+	// 1000 distinct values in 16 bins; the step falls on a bin
+	// boundary, so a single split separates the classes.
+	x := db.NewNumericFeature(nil)
+	t := db.NewNumericFeature(nil)
+	for i := 0; i < 1000; i++ {
+		x.Add(float64(i))
+		if i < 500 {
+			t.Add(0)
+		} else {
+			t.Add(1)
+		}
+	}
+
+	features := []db.OrderedFeature{x}
+	dt := db.NewDecisionTreeRegressor(db.WithMaxBins(16), db.WithMaxDepth(1))
+	dt.Fit(features, t)
+	rf := db.NewRandomForestRegressor(5, db.WithMaxBins(16), db.WithMaxDepth(1), db.WithSeed(1))
+	rf.Fit(features, t)
+	gb := db.NewGradientBoostingRegressor(20, db.WithMaxBins(16), db.WithLearningRate(1), db.WithSeed(1))
+	gb.Fit(features, t)
+
+	for _, model := range []interface {
+		Predict([]db.Feature) []float64
+	}{dt, rf, gb} {
+		// Predictions use the raw values of new units
+		newX := db.NewNumericFeature([]float64{-10, 499.4, 499.6, 2000})
+		for i, p := range model.Predict([]db.Feature{newX}) {
+			if expected := []float64{0, 0, 1, 1}[i]; math.Abs(p-expected) > 0.05 {
+				test.Errorf("%T: predicted %v for %v; expected %v", model, p, newX.Value(i), expected)
+			}
+		}
+	}
+}
+
+func TestBinnedEmptyFeature(test *testing.T) {
+	// Binning accepts an empty feature, as exact split finding does.
+	x := db.NewNumericFeature(nil)
+	t := db.NewNumericFeature(nil)
+	db.NewDecisionTreeRegressor().Fit([]db.OrderedFeature{x}, t)
+	db.NewDecisionTreeRegressor(db.WithMaxBins(16)).Fit([]db.OrderedFeature{x}, t)
+}
@@ -0,0 +1,188 @@
+package DragonBlood
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+
+	"github.com/mawicks/DragonBlood/stats"
+)
+
+// Predictor is a model that predicts a numeric value (e.g., a target,
+// a score, or a class probability) for each unit of features.
+type Predictor interface {
+	Predict(features []Feature) []float64
+}
+
+// PredictorFunc adapts a function to Predictor, e.g., to score a
+// classifier by the probability of one class.
+type PredictorFunc func(features []Feature) []float64
+
+func (f PredictorFunc) Predict(features []Feature) []float64 { return f(features) }
+
+// permutedFeature presents the values of a feature in another order:
+// value i is value order[i] of the feature.
+type permutedFeature struct {
+	Feature
+	order []int
+}
+
+func (pf *permutedFeature) NumericValue(i int) float64 { return pf.Feature.NumericValue(pf.order[i]) }
+func (pf *permutedFeature) Value(i int) interface{}    { return pf.Feature.Value(pf.order[i]) }
+
+// featureValues returns the numeric values of f.
+func featureValues(f Feature) []float64 {
+	result := make([]float64, f.Len())
+	for i := range result {
+		result[i] = f.NumericValue(i)
+	}
+	return result
+}
+
+// PermutationImportance returns the mean and standard deviation, over
+// nRepeats random permutations, of the degradation of the score of
+// model's predictions of target when the values of each feature are
+// shuffled (Breiman 2001).  Unlike Importances, which sums split
+// reductions on the training data, it applies to any model and can
+// be measured on held-out data.  Permutations are drawn from rng, so
+// a source with a given seed gives the same importances.
+func PermutationImportance(model Predictor, features []Feature, target Feature, scorer Scorer, nRepeats int, rng *rand.Rand) (mean, std []float64) {
+	if nRepeats < 1 {
+		panic(fmt.Sprintf("permutation importance requires at least one repeat (%d requested)", nRepeats))
+	}
+
+	targetValues := featureValues(target)
+	baseline := scorer.Score(model.Predict(features), targetValues)
+
+	mean = make([]float64, len(features))
+	std = make([]float64, len(features))
+	permuted := make([]Feature, len(features))
+	for j := range features {
+		copy(permuted, features)
+		accumulator := stats.NewVarianceAccumulator()
+		for r := 0; r < nRepeats; r++ {
+			permuted[j] = &permutedFeature{features[j], rng.Perm(target.Len())}
+			accumulator.Add(degradation(scorer, baseline, scorer.Score(model.Predict(permuted), targetValues)))
+		}
+		mean[j], std[j] = accumulator.Mean(), math.Sqrt(accumulator.Variance())
+	}
+	return mean, std
+}
+
+// DropColumnImportance returns the degradation of the score on test
+// data of a model trained without each feature relative to one
+// trained with every feature.  fit trains a model on the given
+// features and target, and is called once with every feature and
+// once without each one.  features and testFeatures must hold the
+// same features.  Drop-column importance accounts for features that
+// can substitute for one another, which share their permutation
+// importance, at the cost of retraining.
+func DropColumnImportance(fit func(features []OrderedFeature, target Feature) Predictor, features []OrderedFeature, target Feature, testFeatures []Feature, testTarget Feature, scorer Scorer) []float64 {
+	if len(features) != len(testFeatures) {
+		panic(fmt.Sprintf("Argument mismatch: len(features)=%d, but len(testFeatures)=%d", len(features), len(testFeatures)))
+	}
+
+	testValues := featureValues(testTarget)
+	baseline := scorer.Score(fit(features, target).Predict(testFeatures), testValues)
+
+	result := make([]float64, len(features))
+	for j := range features {
+		var kept []OrderedFeature
+		var keptTest []Feature
+		for k := range features {
+			if k != j {
+				kept = append(kept, features[k])
+				keptTest = append(keptTest, testFeatures[k])
+			}
+		}
+		result[j] = degradation(scorer, baseline, scorer.Score(fit(kept, target).Predict(keptTest), testValues))
+	}
+	return result
+}
+
+// OOBPermutationImportance returns the mean and standard deviation,
+// over the trees of the forest, of the degradation of each tree's
+// score on its out-of-bag units when the values of each feature are
+// permuted among those units, as originally formulated by Breiman
+// (2001).  Each tree's degradation is averaged over nRepeats
+// permutations.  features and target must be those with which the
+// forest was trained by its most recent call to Fit, since each
+// tree's sample is redrawn from the forest's seed.  The permutations
+// are drawn from the same seed, so results are reproducible.
+// OOBPermutationImportance panics if the forest wasn't trained on
+// bootstrap samples, whatever the options of a forest it was loaded
+// into.
+func (rf *RandomForestRegressor) OOBPermutationImportance(features []Feature, target Feature, scorer Scorer, nRepeats int) (mean, std []float64) {
+	if nRepeats < 1 {
+		panic(fmt.Sprintf("permutation importance requires at least one repeat (%d requested)", nRepeats))
+	}
+	rf.checkOOB("OOBPermutationImportance", features)
+
+	targetValues := featureValues(target)
+	trees := rf.trees
+	seeds := rf.treeSeeds()
+
+	// treeDegradation[t][j] is the mean degradation of tree t when
+	// feature j is permuted, or NaN if tree t has no out-of-bag units.
+	treeDegradation := make([][]float64, len(trees))
+	rf.parallelRange(len(trees), func(start, end int) {
+		for t := start; t < end; t++ {
+			rng, bag := rf.treeBag(seeds[t], target.Len())
+			var oob []int
+			for i := 0; i < target.Len(); i++ {
+				if bag.Count(i) == 0 {
+					oob = append(oob, i)
+				}
+			}
+			treeDegradation[t] = make([]float64, len(features))
+			if trees[t] == nil || len(oob) == 0 {
+				for j := range treeDegradation[t] {
+					treeDegradation[t][j] = math.NaN()
+				}
+				continue
+			}
+
+			oobTarget := make([]float64, len(oob))
+			for k, i := range oob {
+				oobTarget[k] = targetValues[i]
+			}
+			score := func(features []Feature) float64 {
+				predictions := make([]float64, len(oob))
+				for k, i := range oob {
+					predictions[k] = trees[t].leaf(features, i).prediction
+				}
+				return scorer.Score(predictions, oobTarget)
+			}
+			baseline := score(features)
+
+			permuted := make([]Feature, len(features))
+			order := make([]int, target.Len())
+			for j := range features {
+				copy(permuted, features)
+				for i := range order {
+					order[i] = i
+				}
+				permuted[j] = &permutedFeature{features[j], order}
+				for r := 0; r < nRepeats; r++ {
+					for k, p := range rng.Perm(len(oob)) {
+						order[oob[k]] = oob[p]
+					}
+					treeDegradation[t][j] += degradation(scorer, baseline, score(permuted)) / float64(nRepeats)
+				}
+			}
+		}
+	})
+
+	mean = make([]float64, len(features))
+	std = make([]float64, len(features))
+	for j := range features {
+		accumulator := stats.NewVarianceAccumulator()
+		for _, d := range treeDegradation {
+			if !math.IsNaN(d[j]) {
+				accumulator.Add(d[j])
+			}
+		}
+		mean[j], std[j] = accumulator.Mean(), math.Sqrt(accumulator.Variance())
+	}
+	return mean, std
+}
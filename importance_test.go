@@ -0,0 +1,133 @@
+package DragonBlood_test
+
+import (
+	"bytes"
+	"math/rand"
+	"testing"
+
+	db "github.com/mawicks/DragonBlood"
+)
+
+// importanceData returns three features, of which the first matters
+// most, the second less, and the third not at all, and a target.
+func importanceData(n int, rng *rand.Rand) ([]*db.NumericFeature, *db.NumericFeature) {
+	x := []*db.NumericFeature{db.NewNumericFeature(nil), db.NewNumericFeature(nil), db.NewNumericFeature(nil)}
+	t := db.NewNumericFeature(nil)
+	for i := 0; i < n; i++ {
+		v := []float64{rng.Float64(), rng.Float64(), rng.Float64()}
+		for j := range x {
+			x[j].Add(v[j])
+		}
+		t.Add(4*v[0] + v[1] + rng.NormFloat64()/10)
+	}
+	return x, t
+}
+
+func checkImportanceOrder(test *testing.T, name string, importance []float64) {
+	if !(importance[0] > importance[1] && importance[1] > importance[2]) {
+		test.Errorf("%s importances %v are not in decreasing order", name, importance)
+	}
+	if importance[2] > 0.1*importance[1] {
+		test.Errorf("%s importance of an irrelevant feature is %v", name, importance[2])
+	}
+}
+
+func TestPermutationImportance(test *testing.T) {
+	rng := rand.New(rand.NewSource(7))
+	x, t := importanceData(400, rng)
+	features := []db.OrderedFeature{x[0], x[1], x[2]}
+	unordered := []db.Feature{x[0], x[1], x[2]}
+	testX, testT := importanceData(400, rng)
+	testFeatures := []db.Feature{testX[0], testX[1], testX[2]}
+
+	rf := db.NewRandomForestRegressor(30, db.WithSeed(1), db.WithMinLeafSize(5))
+	rf.Fit(features, t)
+
+	mean, std := db.PermutationImportance(rf, testFeatures, testT, db.MSEScorer{}, 3, rand.New(rand.NewSource(2)))
+	checkImportanceOrder(test, "Permutation", mean)
+	for j, s := range std {
+		if !(s >= 0 && s < mean[0]) {
+			test.Errorf("Permutation importance of feature %d has standard deviation %v", j, s)
+		}
+	}
+	again, _ := db.PermutationImportance(rf, testFeatures, testT, db.MSEScorer{}, 3, rand.New(rand.NewSource(2)))
+	for j := range mean {
+		if again[j] != mean[j] {
+			test.Errorf("Permutation importance of feature %d is %v and then %v with the same seed", j, mean[j], again[j])
+		}
+	}
+
+	mean, std = rf.OOBPermutationImportance(unordered, t, db.MSEScorer{}, 2)
+	checkImportanceOrder(test, "OOB permutation", mean)
+	again, _ = rf.OOBPermutationImportance(unordered, t, db.MSEScorer{}, 2)
+	for j := range mean {
+		if again[j] != mean[j] {
+			test.Errorf("OOB permutation importance of feature %d is %v and then %v", j, mean[j], again[j])
+		}
+	}
+
+	fit := func(features []db.OrderedFeature, target db.Feature) db.Predictor {
+		rf := db.NewRandomForestRegressor(30, db.WithSeed(1), db.WithMinLeafSize(5))
+		rf.Fit(features, target)
+		return rf
+	}
+	checkImportanceOrder(test, "Drop-column", db.DropColumnImportance(fit, features, t, testFeatures, testT, db.MSEScorer{}))
+}
+
+func TestPermutationImportanceOfClassifier(test *testing.T) {
+	rng := rand.New(rand.NewSource(8))
+	x, t := importanceData(300, rng)
+	class := db.NewCategoricalFeature(db.NewStringTable())
+	for i := 0; i < t.Len(); i++ {
+		if t.NumericValue(i) > 2.5 {
+			class.AddFromString("high")
+		} else {
+			class.AddFromString("low")
+		}
+	}
+
+	rf := db.NewRandomForestClassifier(30, db.Gini, db.WithSeed(1))
+	rf.Fit([]db.OrderedFeature{x[0], x[1], x[2]}, class)
+	high := db.PredictorFunc(func(features []db.Feature) []float64 {
+		probabilities := rf.PredictProba(features)
+		result := make([]float64, len(probabilities))
+		for i, p := range probabilities {
+			result[i] = p[int(class.NumericValue(0))]
+		}
+		return result
+	})
+
+	isHigh := db.NewNumericFeature(nil)
+	for i := 0; i < class.Len(); i++ {
+		if class.NumericValue(i) == class.NumericValue(0) {
+			isHigh.Add(1.0)
+		} else {
+			isHigh.Add(0.0)
+		}
+	}
+	mean, _ := db.PermutationImportance(high, []db.Feature{x[0], x[1], x[2]}, isHigh, db.ROCAreaScorer{}, 3, rand.New(rand.NewSource(3)))
+	if !(mean[0] > mean[1] && mean[0] > mean[2]) {
+		test.Errorf("ROC area importances %v do not favor the first feature", mean)
+	}
+}
+
+func TestOOBPermutationImportanceOfLoadedForest(test *testing.T) {
+	x, t := importanceData(100, rand.New(rand.NewSource(8)))
+	rf := db.NewRandomForestRegressor(5, db.WithSeed(1), db.WithBootstrap(false))
+	rf.Fit([]db.OrderedFeature{x[0], x[1], x[2]}, t)
+
+	var buffer bytes.Buffer
+	if err := rf.Save(&buffer); err != nil {
+		test.Fatalf("Save returned %v", err)
+	}
+	loaded := db.NewRandomForestRegressor(0)
+	if err := loaded.Load(&buffer); err != nil {
+		test.Fatalf("Load returned %v", err)
+	}
+	defer func() {
+		if recover() == nil {
+			test.Errorf("OOBPermutationImportance() didn't panic for a forest grown without bootstrap samples")
+		}
+	}()
+	loaded.OOBPermutationImportance([]db.Feature{x[0], x[1], x[2]}, t, db.MSEScorer{}, 1)
+}
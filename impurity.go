@@ -0,0 +1,147 @@
+package DragonBlood
+
+import (
+	"fmt"
+	"math"
+)
+
+// Impurity is a splitting criterion for classification trees.  The
+// target of a classification tree is a class code, such as the
+// NumericValue() of a CategoricalFeature.
+type Impurity int
+
+const (
+	// Gini selects splits that minimize the Gini impurity.
+	Gini Impurity = iota
+
+	// Entropy selects splits that minimize the entropy (in bits).
+	Entropy
+)
+
+func (imp Impurity) String() string {
+	switch imp {
+	case Gini:
+		return "gini"
+	case Entropy:
+		return "entropy"
+	}
+	return "unknown impurity"
+}
+
+func (imp Impurity) NewAccumulator(minLeafSize float64) SplitAccumulator {
+	return NewScanAccumulator(minLeafSize, newClassCounts(imp), newClassCounts(imp))
+}
+
+func (imp Impurity) LeafMetric(targets, weights []float64) Metric {
+	weights = unitWeights(targets, weights)
+	counts := newClassCounts(imp)
+	for i, t := range targets {
+		counts.Add(t, weights[i])
+	}
+	return counts.Metric()
+}
+
+func (imp Impurity) impurity(targets, weights []float64) float64 {
+	weights = unitWeights(targets, weights)
+	counts := newClassCounts(imp)
+	for i, t := range targets {
+		counts.Add(t, weights[i])
+	}
+	return counts.Impurity()
+}
+
+// classCounts is an implementation of NodeStatistics that tallies the
+// weight of the units of each class.
+type classCounts struct {
+	impurity Impurity
+	counts   []float64
+	total    float64
+	n        int
+
+	// sum is the sum of term(c) over the class counts c.
+	sum float64
+}
+
+func newClassCounts(impurity Impurity) *classCounts {
+	return &classCounts{impurity: impurity}
+}
+
+func (cc *classCounts) term(c float64) float64 {
+	if cc.impurity == Entropy {
+		if c > 0 {
+			return c * math.Log2(c)
+		}
+		return 0.0
+	}
+	return c * c
+}
+
+// update adds delta to the weight of class targetValue, which must
+// be a class code (a non-negative integer).
+func (cc *classCounts) update(targetValue, delta float64) {
+	if !(targetValue >= 0) || math.IsInf(targetValue, 1) || targetValue != math.Trunc(targetValue) {
+		panic(fmt.Sprintf("invalid class code %v (class codes are non-negative integers)", targetValue))
+	}
+	k := int(targetValue)
+	for len(cc.counts) <= k {
+		cc.counts = append(cc.counts, 0.0)
+	}
+	cc.sum -= cc.term(cc.counts[k])
+	cc.counts[k] += delta
+	cc.sum += cc.term(cc.counts[k])
+	cc.total += delta
+}
+
+func (cc *classCounts) Add(targetValue, weight float64) {
+	cc.n += 1
+	cc.update(targetValue, weight)
+}
+
+func (cc *classCounts) Subtract(targetValue, weight float64) {
+	if cc.n <= 0 {
+		panic("Subtract() called more than Add()")
+	}
+	cc.n -= 1
+	if cc.n == 0 {
+		*cc = classCounts{impurity: cc.impurity, counts: cc.counts[:0]}
+		return
+	}
+	cc.update(targetValue, -weight)
+}
+
+func (cc *classCounts) Count() int { return cc.n }
+
+func (cc *classCounts) Weight() float64 { return cc.total }
+
+func (cc *classCounts) Impurity() float64 {
+	if cc.total <= 0 {
+		return 0.0
+	}
+	if cc.impurity == Entropy {
+		return math.Max(cc.total*math.Log2(cc.total)-cc.sum, 0.0)
+	}
+	return math.Max(cc.total-cc.sum/cc.total, 0.0)
+}
+
+func (cc *classCounts) Metric() Metric {
+	distribution := make([]float64, len(cc.counts))
+	copy(distribution, cc.counts)
+	return Metric{
+		size:         cc.n,
+		weight:       cc.total,
+		prediction:   float64(argmax(distribution)),
+		distribution: distribution,
+	}
+}
+
+// argmax returns the index of the largest element of x (the first
+// such index in case of ties) or -1 if x is empty.
+func argmax(x []float64) int {
+	result := -1
+	for i, v := range x {
+		if result < 0 || v > x[result] {
+			result = i
+		}
+	}
+	return result
+}
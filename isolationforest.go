@@ -0,0 +1,263 @@
+package DragonBlood
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+)
+
+// isolationOptions holds the options of isolation forests.
+type isolationOptions struct {
+	// SampleSize is the number of units sampled (without
+	// replacement) to grow each tree.
+	SampleSize int
+
+	// Contamination is the expected fraction of anomalies in the
+	// training data, which sets the score above which Predict flags
+	// a unit.
+	Contamination float64
+}
+
+// WithSampleSize sets the number of units sampled without replacement
+// to grow each tree of an isolation forest (default 256, or every
+// unit if there are fewer).
+func WithSampleSize(n int) Option {
+	return func(dtg *decisionTreeGrower) { dtg.isolation.SampleSize = n }
+}
+
+// WithContamination sets the expected fraction of anomalies in the
+// training data of an isolation forest (default 0.1).  Predict flags
+// the units whose scores exceed those of all but this fraction of the
+// training units.
+func WithContamination(fraction float64) Option {
+	return func(dtg *decisionTreeGrower) { dtg.isolation.Contamination = fraction }
+}
+
+// IsolationForest detects anomalies in unlabeled data (Liu et al.
+// 2008).  Each tree recursively splits a random subsample of the units
+// on a randomly chosen feature: numeric features at a threshold drawn
+// uniformly between the feature's minimum and maximum within the node,
+// and categorical features by a random, non-empty, proper subset of
+// the categories present in the node.  Anomalies are few and
+// different, so they are isolated in fewer splits than other units.
+//
+// Trees are grown to the depth at which a subsample of typical units
+// would be isolated, ceil(log2(sample size)), unless configured
+// otherwise with WithMaxDepth.  WithSeed, WithNumJobs, WithSampleSize,
+// and WithContamination also apply; other options are ignored.
+type IsolationForest struct {
+	nTrees    int
+	trees     []*DecisionTreeNode
+	nFeatures int
+	schema    featureSchema
+
+	// grower holds the options with which the forest was configured.
+	grower *decisionTreeGrower
+
+	// seed is the seed with which the forest was trained.
+	seed int64
+
+	// sampleSize is the number of units sampled to grow each tree.
+	sampleSize int
+
+	// threshold is the score above which Predict flags a unit.
+	threshold float64
+}
+
+// NewIsolationForest returns an isolation forest of nTrees trees.
+func NewIsolationForest(nTrees int, options ...Option) *IsolationForest {
+	defaults := []Option{WithSampleSize(256), WithContamination(0.1)}
+	grower := newDecisionTreeGrower(nil, append(defaults, options...))
+	return &IsolationForest{nTrees: nTrees, grower: grower}
+}
+
+// Seed returns the seed with which the forest was trained.  Training
+// again with WithSeed(Seed()) reproduces the forest.
+func (rf *IsolationForest) Seed() int64 { return rf.seed }
+
+// averagePathLength returns the average length of an unsuccessful
+// search in a binary search tree of n units, which is the average
+// depth at which a tree isolates one of n units (Liu et al. 2008).
+func averagePathLength(n int) float64 {
+	switch {
+	case n <= 1:
+		return 0
+	case n == 2:
+		return 1
+	}
+	const eulerGamma = 0.5772156649015329
+	return 2*(math.Log(float64(n-1))+eulerGamma) - 2*float64(n-1)/float64(n)
+}
+
+// growIsolationTree returns an isolation tree of the units at the given
+// depth, splitting until each node holds a single unit, its units are
+// identical, or it reaches maxDepth.  The prediction of each node is
+// its depth plus the average path length of its units, which is the
+// path length of a unit that reaches it if it is a leaf.  Units with
+// missing values for a split's feature go to the larger child.
+func growIsolationTree(features []OrderedFeature, units []int, depth, maxDepth int, rng *rand.Rand) *DecisionTreeNode {
+	node := &DecisionTreeNode{
+		Metric:  Metric{size: len(units), weight: float64(len(units)), prediction: float64(depth) + averagePathLength(len(units))},
+		feature: -1,
+	}
+	if len(units) <= 1 || depth >= maxDepth {
+		return node
+	}
+
+	// Choose among the features that take at least two values in the
+	// node so that no split is wasted.
+	var candidates []int
+	min := make([]float64, len(features))
+	max := make([]float64, len(features))
+	for j, f := range features {
+		min[j], max[j] = math.Inf(1), math.Inf(-1)
+		for _, i := range units {
+			if x := f.NumericValue(i); !math.IsNaN(x) {
+				min[j], max[j] = math.Min(min[j], x), math.Max(max[j], x)
+			}
+		}
+		if min[j] < max[j] {
+			candidates = append(candidates, j)
+		}
+	}
+	if len(candidates) == 0 {
+		return node
+	}
+
+	j := candidates[rng.Intn(len(candidates))]
+	var splitter Splitter
+	if _, ok := features[j].(*CategoricalFeature); ok {
+		categories := make(map[int]bool)
+		for _, i := range units {
+			if x := features[j].NumericValue(i); !math.IsNaN(x) {
+				categories[int(x)] = true
+			}
+		}
+		splitter = randomCategorySplitter(categories, rng)
+	} else {
+		threshold := min[j] + rng.Float64()*(max[j]-min[j])
+		if !(threshold > min[j]) {
+			threshold = max[j]
+		}
+		splitter = NumericSplitter(threshold)
+	}
+
+	var left, right, missing []int
+	for _, i := range units {
+		if x := features[j].NumericValue(i); math.IsNaN(x) {
+			missing = append(missing, i)
+		} else if splitter.Split(x) {
+			left = append(left, i)
+		} else {
+			right = append(right, i)
+		}
+	}
+	node.missingLeft = len(left) > len(right)
+	if node.missingLeft {
+		left = append(left, missing...)
+	} else {
+		right = append(right, missing...)
+	}
+
+	node.feature = j
+	node.splitter = splitter
+	node.Left = growIsolationTree(features, left, depth+1, maxDepth, rng)
+	node.Right = growIsolationTree(features, right, depth+1, maxDepth, rng)
+	return node
+}
+
+// Fit grows the trees of the forest, each on its own random subsample
+// of the units of features, replacing those grown by any earlier call,
+// sets the threshold used by Predict, and returns the score of each
+// unit (see Score).
+func (rf *IsolationForest) Fit(features []OrderedFeature) []float64 {
+	n := features[0].Len()
+	if n < 2 {
+		panic(fmt.Sprintf("isolation forest requires at least two units (%d given)", n))
+	}
+	contamination := rf.grower.isolation.Contamination
+	if !(contamination >= 0 && contamination < 1) {
+		panic(fmt.Sprintf("contamination %v is not at least 0 and less than 1", contamination))
+	}
+
+	rf.nFeatures = len(features)
+	rf.schema = newFeatureSchema(features)
+	rf.sampleSize = rf.grower.isolation.SampleSize
+	if rf.sampleSize > n || rf.sampleSize < 2 {
+		rf.sampleSize = n
+	}
+	maxDepth := rf.grower.MaxDepth
+	if maxDepth == 0 {
+		maxDepth = int(math.Ceil(math.Log2(float64(rf.sampleSize))))
+	}
+
+	rf.seed = rf.grower.seed()
+	seeds := treeSeeds(rf.seed, rf.nTrees)
+	trees := make([]*DecisionTreeNode, rf.nTrees)
+	parallelRange(rf.grower.numJobs(), len(trees), func(start, end int) {
+		for t := start; t < end; t++ {
+			// Each tree's subsample is drawn without replacement.
+			rng := rand.New(rand.NewSource(seeds[t]))
+			units := rng.Perm(n)[:rf.sampleSize]
+			trees[t] = growIsolationTree(features, units, 0, maxDepth, rng)
+		}
+	})
+	rf.trees = trees
+
+	unordered := make([]Feature, len(features))
+	for j, f := range features {
+		unordered[j] = f
+	}
+	scores := rf.Score(unordered)
+	weights := make([]float64, len(scores))
+	for i := range weights {
+		weights[i] = 1
+	}
+	rf.threshold = weightedQuantile(scores, weights, 1-contamination)
+	return scores
+}
+
+// Score returns the anomaly score of each unit of features,
+// 2^(-E(h)/c), where E(h) is the mean over the trees of the path
+// length of the unit (the depth of the leaf it reaches, plus the
+// average path length of the training units in that leaf) and c is
+// the average path length of the sample size.  Scores are between 0
+// and 1.  Scores near 1 indicate anomalies; scores well below 0.5
+// indicate typical units.
+func (rf *IsolationForest) Score(features []Feature) []float64 {
+	if rf.sampleSize == 0 {
+		panic("Score() called on an untrained isolation forest")
+	}
+	if len(features) != rf.nFeatures {
+		panic(fmt.Sprintf("Argument mismatch: forest has %d features, but len(features)=%d", rf.nFeatures, len(features)))
+	}
+
+	result := make([]float64, features[0].Len())
+	c := averagePathLength(rf.sampleSize)
+	parallelRange(rf.grower.numJobs(), len(result), func(start, end int) {
+		for i := start; i < end; i++ {
+			pathLength := 0.0
+			for t, tree := range rf.trees {
+				pathLength += (tree.leaf(features, i).prediction - pathLength) / float64(t+1)
+			}
+			result[i] = math.Pow(2, -pathLength/c)
+		}
+	})
+	return result
+}
+
+// Threshold returns the score above which Predict flags a unit: the
+// quantile of the training scores that leaves the contamination
+// fraction of the training units above it.
+func (rf *IsolationForest) Threshold() float64 { return rf.threshold }
+
+// Predict returns true for each unit of features whose score exceeds
+// the threshold set by Fit (see WithContamination).
+func (rf *IsolationForest) Predict(features []Feature) []bool {
+	scores := rf.Score(features)
+	result := make([]bool, len(scores))
+	for i, s := range scores {
+		result[i] = s > rf.threshold
+	}
+	return result
+}
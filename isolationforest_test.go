@@ -0,0 +1,101 @@
+package DragonBlood_test
+
+import (
+	"math/rand"
+	"testing"
+
+	db "github.com/mawicks/DragonBlood"
+)
+
+// isolationData returns 200 typical units, whose numeric features are
+// near 0 and whose category is "a" or "b", followed by an outlying
+// numeric unit and a unit of a rare category.
+func isolationData() []db.OrderedFeature {
+	rng := rand.New(rand.NewSource(5))
+	x := db.NewNumericFeature(nil)
+	y := db.NewNumericFeature(nil)
+	c := db.NewCategoricalFeature(db.NewStringTable())
+	for i := 0; i < 200; i++ {
+		x.Add(rng.NormFloat64())
+		y.Add(rng.NormFloat64())
+		c.AddFromString([]string{"a", "b"}[i%2])
+	}
+	x.Add(8.0)
+	y.Add(-8.0)
+	c.AddFromString("a")
+
+	x.Add(0.0)
+	y.Add(0.0)
+	c.AddFromString("z")
+	return []db.OrderedFeature{x, y, c}
+}
+
+func TestIsolationForest(test *testing.T) {
+	features := isolationData()
+	unordered := []db.Feature{features[0], features[1], features[2]}
+	n := features[0].Len()
+
+	forest := db.NewIsolationForest(100, db.WithSeed(1), db.WithSampleSize(64), db.WithContamination(0.02))
+	scores := forest.Fit(features)
+	for i, s := range scores {
+		if !(s > 0 && s < 1) {
+			test.Errorf("Unit %d has score %v", i, s)
+		}
+	}
+	outlier, rare := n-2, n-1
+	above := 0
+	for i := 0; i < n-2; i++ {
+		if scores[i] >= scores[outlier] {
+			test.Errorf("Unit %d has score %v; the outlier has %v", i, scores[i], scores[outlier])
+		}
+		if scores[i] >= scores[rare] {
+			above++
+		}
+	}
+	// The rare category is isolated only by the trees whose samples
+	// include it.
+	if above >= (n-2)/2 {
+		test.Errorf("%d typical units score at least %v, the score of the rare category", above, scores[rare])
+	}
+
+	flagged := 0
+	for i, anomaly := range forest.Predict(unordered) {
+		if anomaly {
+			flagged++
+		}
+		if anomaly != (scores[i] > forest.Threshold()) {
+			test.Errorf("Unit %d with score %v was flagged %v with threshold %v", i, scores[i], anomaly, forest.Threshold())
+		}
+	}
+	if flagged < 2 || flagged > n/50 {
+		test.Errorf("%d of %d units were flagged with contamination 0.02", flagged, n)
+	}
+
+	again := db.NewIsolationForest(100, db.WithSeed(1), db.WithSampleSize(64), db.WithNumJobs(4))
+	for i, s := range again.Fit(features) {
+		if s != scores[i] {
+			test.Fatalf("Unit %d has score %v with 4 jobs and %v with 1", i, s, scores[i])
+		}
+	}
+}
+
+func TestIsolationForestRefit(test *testing.T) {
+	features := isolationData()
+	first := features[:2]
+	second := []db.OrderedFeature{features[1], features[0]}
+
+	refit := db.NewIsolationForest(50, db.WithSeed(1), db.WithSampleSize(32))
+	refit.Fit(first)
+	scores := refit.Fit(second)
+
+	fresh := db.NewIsolationForest(50, db.WithSeed(1), db.WithSampleSize(32))
+	expected := fresh.Fit(second)
+	for i := range scores {
+		if scores[i] != expected[i] {
+			test.Fatalf("Unit %d has score %v after refitting; expected %v", i, scores[i], expected[i])
+		}
+	}
+	if refit.Threshold() != fresh.Threshold() {
+		test.Errorf("Threshold after refitting is %v; expected %v", refit.Threshold(), fresh.Threshold())
+	}
+}
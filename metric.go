@@ -42,3 +42,42 @@ func MSE(score, target []float64) float64 {
 
 	return accumulator / float64(len(score))
 }
+
+// Scorer measures how well predictions match target.  Scorers are
+// used by PermutationImportance and related functions to measure the
+// degradation of a model.
+type Scorer interface {
+	Score(predictions, target []float64) float64
+
+	// GreaterIsBetter is true if larger scores are better.
+	GreaterIsBetter() bool
+}
+
+// MSEScorer scores predictions by their mean squared error.
+type MSEScorer struct{}
+
+func (MSEScorer) Score(predictions, target []float64) float64 { return MSE(predictions, target) }
+func (MSEScorer) GreaterIsBetter() bool                       { return false }
+
+// ROCAreaScorer scores predictions by the area under the ROC curve.
+// Units whose target is nonzero are positive.
+type ROCAreaScorer struct{}
+
+func (ROCAreaScorer) Score(predictions, target []float64) float64 {
+	positive := make([]bool, len(target))
+	for i, t := range target {
+		positive[i] = t != 0
+	}
+	return ROCArea(predictions, positive)
+}
+
+func (ROCAreaScorer) GreaterIsBetter() bool { return true }
+
+// degradation returns how much worse score is than baseline according
+// to scorer.
+func degradation(scorer Scorer, baseline, score float64) float64 {
+	if scorer.GreaterIsBetter() {
+		return baseline - score
+	}
+	return score - baseline
+}
@@ -0,0 +1,165 @@
+package DragonBlood
+
+import (
+	"fmt"
+	"math"
+	"sort"
+)
+
+// surrogateSplit is a split on another feature that mimics a node's
+// primary split (Breiman et al. 1984).  It routes units whose primary
+// feature value is missing.
+type surrogateSplit struct {
+	feature  int
+	splitter Splitter
+
+	// reverse is true if units satisfying splitter go right.
+	reverse bool
+
+	// agreement is the fraction of the training weight that the
+	// surrogate sends in the same direction as the primary split.
+	agreement float64
+}
+
+func (s surrogateSplit) String() string {
+	not := ""
+	if s.reverse {
+		not = "not "
+	}
+	return fmt.Sprintf("feature_%d %s%s (agreement %.3g)", s.feature, not, s.splitter, s.agreement)
+}
+
+// WithSurrogates records up to n surrogate splits for each split.
+// When the value of a split's feature is missing, the first surrogate
+// whose feature is present decides the direction.  If none are
+// present, the direction learned for missing values is used.
+func WithSurrogates(n int) Option {
+	return func(dtg *decisionTreeGrower) { dtg.Surrogates = n }
+}
+
+// splitLeft returns true if unit i of features goes to the left child of n.
+func (n *DecisionTreeNode) splitLeft(features []Feature, i int) bool {
+	if x := features[n.feature].NumericValue(i); !math.IsNaN(x) {
+		return n.splitter.Split(x)
+	}
+	for _, s := range n.surrogates {
+		if x := features[s.feature].NumericValue(i); !math.IsNaN(x) {
+			return s.splitter.Split(x) != s.reverse
+		}
+	}
+	return n.missingLeft
+}
+
+// dtSurrogateSplits finds up to maxSurrogates surrogate splits for
+// each of the splittableNodes that was split in the current
+// generation.  Only unbinned numeric features are considered
+// and a surrogate is kept only if it agrees with the primary split
+// more often than sending every unit to the primary split's majority
+// side would.
+func dtSurrogateSplits(features []OrderedFeature, splittableNodes []*DecisionTreeNode, nodeMembership []int, bag Bag, maxSurrogates int) {
+	nodeCount := len(splittableNodes)
+
+	// primary is +1 for units the primary split sends left, -1 for
+	// units it sends right, and 0 for units that don't matter.
+	primary := make([]int8, len(nodeMembership))
+	for i, nm := range nodeMembership {
+		if nm >= 0 && bag.Count(i) > 0 {
+			node := splittableNodes[nm]
+			if node.feature >= 0 {
+				if x := features[node.feature].NumericValue(i); !math.IsNaN(x) {
+					if node.splitter.Split(x) {
+						primary[i] = 1
+					} else {
+						primary[i] = -1
+					}
+				}
+			}
+		}
+	}
+
+	type candidate struct {
+		agreement float64
+		threshold float64
+		reverse   bool
+	}
+
+	candidates := make([][]surrogateSplit, nodeCount)
+	leftTotal := make([]float64, nodeCount)
+	rightTotal := make([]float64, nodeCount)
+	leftBelow := make([]float64, nodeCount)
+	rightBelow := make([]float64, nodeCount)
+	previous := make([]float64, nodeCount)
+	best := make([]candidate, nodeCount)
+
+	for fi, f := range features {
+		switch f.(type) {
+		case *CategoricalFeature, *binnedFeature:
+			continue
+		}
+
+		eligible := func(i int) bool {
+			return primary[i] != 0 && splittableNodes[nodeMembership[i]].feature != fi && !math.IsNaN(f.NumericValue(i))
+		}
+
+		for nm := range best {
+			leftTotal[nm], rightTotal[nm] = 0.0, 0.0
+			leftBelow[nm], rightBelow[nm] = 0.0, 0.0
+			previous[nm] = math.Inf(-1)
+			best[nm] = candidate{}
+		}
+
+		for i := range nodeMembership {
+			if eligible(i) {
+				if primary[i] > 0 {
+					leftTotal[nodeMembership[i]] += float64(bag.Count(i)) * bag.Weight(i)
+				} else {
+					rightTotal[nodeMembership[i]] += float64(bag.Count(i)) * bag.Weight(i)
+				}
+			}
+		}
+
+		for position := range nodeMembership {
+			i := f.InOrder(position)
+			if !eligible(i) {
+				continue
+			}
+			nm := nodeMembership[i]
+			if x := f.NumericValue(i); x != previous[nm] {
+				if leftBelow[nm]+rightBelow[nm] > 0 {
+					threshold := splitThreshold(previous[nm], x)
+					if agreement := leftBelow[nm] + rightTotal[nm] - rightBelow[nm]; agreement > best[nm].agreement {
+						best[nm] = candidate{agreement, threshold, false}
+					}
+					if agreement := rightBelow[nm] + leftTotal[nm] - leftBelow[nm]; agreement > best[nm].agreement {
+						best[nm] = candidate{agreement, threshold, true}
+					}
+				}
+				previous[nm] = x
+			}
+			if primary[i] > 0 {
+				leftBelow[nm] += float64(bag.Count(i)) * bag.Weight(i)
+			} else {
+				rightBelow[nm] += float64(bag.Count(i)) * bag.Weight(i)
+			}
+		}
+
+		for nm, b := range best {
+			if total := leftTotal[nm] + rightTotal[nm]; b.agreement > math.Max(leftTotal[nm], rightTotal[nm]) {
+				candidates[nm] = append(candidates[nm], surrogateSplit{fi, NumericSplitter(b.threshold), b.reverse, b.agreement / total})
+			}
+		}
+	}
+
+	for nm, node := range splittableNodes {
+		if node.feature >= 0 && len(candidates[nm]) > 0 {
+			nodeCandidates := candidates[nm]
+			sort.SliceStable(nodeCandidates, func(a, b int) bool {
+				return nodeCandidates[a].agreement > nodeCandidates[b].agreement
+			})
+			if len(nodeCandidates) > maxSurrogates {
+				nodeCandidates = nodeCandidates[:maxSurrogates]
+			}
+			node.surrogates = nodeCandidates
+		}
+	}
+}
@@ -0,0 +1,102 @@
+package DragonBlood_test
+
+import (
+	"bytes"
+	"math"
+	"strings"
+	"testing"
+
+	db "github.com/mawicks/DragonBlood"
+)
+
+func TestMissingDirection(test *testing.T) {
+	nan := math.NaN()
+
+	// The missing units resemble the smallest values, so they should go left.
+	x := db.NewNumericFeature([]float64{nan, nan, 1, 2, 3, 4})
+	t := db.NewNumericFeature([]float64{0, 0, 0, 0, 10, 10})
+
+	dt := db.NewDecisionTreeRegressor()
+	dt.Fit([]db.OrderedFeature{x}, t)
+
+	var dump bytes.Buffer
+	dt.Dump(&dump)
+	if strings.Count(dump.String(), "(LEAF)") != 2 || !strings.Contains(dump.String(), "missing: L") {
+		test.Errorf("Expected a single split sending missing values left; got\n%s", dump.String())
+	}
+
+	newX := db.NewNumericFeature([]float64{nan, 1.5, 3.5})
+	for i, p := range dt.Predict([]db.Feature{newX}) {
+		if expected := []float64{0, 0, 10}[i]; p != expected {
+			test.Errorf("Row %d: predicted %v; expected %v", i, p, expected)
+		}
+	}
+}
+
+func TestMissingSplitBelowMinimum(test *testing.T) {
+	nan := math.NaN()
+
+	// The only split separates the missing units from the others, so
+	// new values below the smallest training value go with the
+	// present values.
+	x := db.NewNumericFeature([]float64{nan, nan, nan, 1, 1.5, 1.5, 2})
+	t := db.NewNumericFeature([]float64{0, 0, 0, 10, 10, 10, 10})
+	newX := db.NewNumericFeature([]float64{nan, 0.5, 1, 3})
+
+	for seed := int64(0); seed < 50; seed++ {
+		dt := db.NewDecisionTreeRegressor(db.WithMaxDepth(1), db.WithSeed(seed))
+		dt.Fit([]db.OrderedFeature{x}, t)
+		for i, p := range dt.Predict([]db.Feature{newX}) {
+			if expected := []float64{0, 10, 10, 10}[i]; p != expected {
+				test.Errorf("Seed %d, row %d: predicted %v; expected %v", seed, i, p, expected)
+			}
+		}
+	}
+}
+
+func TestSurrogateSplits(test *testing.T) {
+	nan := math.NaN()
+
+	x1 := db.NewNumericFeature([]float64{1, 2, 3, 4, 5, 6, 7, 8})
+	x2 := db.NewNumericFeature([]float64{1, 2, 3, 6, 5, 6, 7, 8})
+	t := db.NewNumericFeature([]float64{0, 0, 0, 0, 10, 10, 10, 10})
+
+	dt := db.NewDecisionTreeRegressor(db.WithSurrogates(1))
+	dt.Fit([]db.OrderedFeature{x1, x2}, t)
+
+	var dump bytes.Buffer
+	dt.Dump(&dump)
+	if !strings.Contains(dump.String(), "surrogate: feature_1 < 4 ") {
+		test.Errorf("Expected surrogate split on feature_1; got\n%s", dump.String())
+	}
+
+	newX1 := db.NewNumericFeature([]float64{nan, nan})
+	newX2 := db.NewNumericFeature([]float64{2, 7})
+	for i, p := range dt.Predict([]db.Feature{newX1, newX2}) {
+		if expected := []float64{0, 10}[i]; p != expected {
+			test.Errorf("Row %d: predicted %v; expected %v", i, p, expected)
+		}
+	}
+}
+
+func TestSurrogateAdjacentValues(test *testing.T) {
+	nan := math.NaN()
+
+	// The surrogate separates 1 from the next larger float64, whose
+	// midpoint rounds to 1.
+	next := math.Nextafter(1, 2)
+	p := db.NewNumericFeature([]float64{0, 0, 0, 1, 1, nan})
+	s := db.NewNumericFeature([]float64{1, 1, next, next, next, next})
+	t := db.NewNumericFeature([]float64{0, 0, 0, 10, 10, 10})
+
+	dt := db.NewDecisionTreeRegressor(db.WithSurrogates(1), db.WithMaxDepth(1))
+	dt.Fit([]db.OrderedFeature{p, s}, t)
+
+	newP := db.NewNumericFeature([]float64{nan, nan})
+	newS := db.NewNumericFeature([]float64{1, next})
+	for i, prediction := range dt.Predict([]db.Feature{newP, newS}) {
+		if expected := []float64{0, 10}[i]; prediction != expected {
+			test.Errorf("Row %d: predicted %v; expected %v", i, prediction, expected)
+		}
+	}
+}
@@ -0,0 +1,239 @@
+package DragonBlood
+
+import (
+	"fmt"
+	"math"
+)
+
+// WithMonotonicConstraints constrains the predictions of a regression
+// tree, forest, or boosted model to be monotone in some features.
+// constraints[j] is +1 if predictions must not decrease as feature j
+// increases, -1 if they must not increase, and 0 if feature j is
+// unconstrained.  Constrained categorical features are never split.
+//
+// Splits whose children violate a constraint are rejected, and the
+// values of the leaves below each split of a constrained feature are
+// bounded by the midpoint of the values of its children, so that
+// every leaf on one side of the split is ordered with respect to
+// every leaf on the other side.  Boosted models clip the values of
+// their leaves to the same bounds.  Constraints are not supported by
+// classification trees.
+func WithMonotonicConstraints(constraints []int) Option {
+	return func(dtg *decisionTreeGrower) { dtg.MonotonicConstraints = constraints }
+}
+
+// checkConstraints panics if the monotonic constraints are malformed
+// for a model of nFeatures features.
+func (dtg *decisionTreeGrower) checkConstraints(nFeatures int) {
+	if dtg.MonotonicConstraints == nil {
+		return
+	}
+	if _, ok := dtg.criterion.(Impurity); ok {
+		panic("monotonic constraints are not supported by classification trees")
+	}
+	if len(dtg.MonotonicConstraints) != nFeatures {
+		panic(fmt.Sprintf("%d monotonic constraints given for %d features", len(dtg.MonotonicConstraints), nFeatures))
+	}
+	for j, c := range dtg.MonotonicConstraints {
+		if c < -1 || c > 1 {
+			panic(fmt.Sprintf("monotonic constraint %d on feature %d is not -1, 0, or +1", c, j))
+		}
+	}
+}
+
+// clip returns x limited to the interval [lower, upper].
+func clip(x, lower, upper float64) float64 {
+	return math.Min(math.Max(x, lower), upper)
+}
+
+// violates returns true if splitting n by split would violate the
+// monotonic constraints.  Only numeric splits of a constrained
+// feature satisfy its constraint, and only if the (bounded) values
+// of the children are ordered.
+func (n *DecisionTreeNode) violates(split *FeatureSplitInfo, constraints []int) bool {
+	if constraints == nil || constraints[split.feature] == 0 {
+		return false
+	}
+	if _, ok := split.splitter.(NumericSplitter); !ok {
+		return true
+	}
+	left := clip(split.left.prediction, n.lower, n.upper)
+	right := clip(split.right.prediction, n.lower, n.upper)
+	return float64(constraints[split.feature])*(right-left) < 0
+}
+
+// boundChildren bounds the values of the children of n, which has
+// just been split, by those of n and, if n splits a constrained
+// feature, by the midpoint of their values.
+func (n *DecisionTreeNode) boundChildren(constraints []int) {
+	for _, child := range []*DecisionTreeNode{n.Left, n.Right} {
+		child.lower, child.upper = n.lower, n.upper
+		child.prediction = clip(child.prediction, n.lower, n.upper)
+	}
+	if constraints == nil || constraints[n.feature] == 0 {
+		return
+	}
+
+	mid := 0.5 * (n.Left.prediction + n.Right.prediction)
+	if constraints[n.feature] > 0 {
+		n.Left.upper, n.Right.lower = mid, mid
+	} else {
+		n.Left.lower, n.Right.upper = mid, mid
+	}
+}
+
+// region describes the values of one feature that reach a node:
+// those in [lower, upper) for numeric splits, those in every set of
+// in and in no set of out for categorical splits, and missing values
+// if missing is true.
+type region struct {
+	lower, upper float64
+	in, out      []CategorySetSplitter
+	missing      bool
+}
+
+// overlaps returns true if some non-missing value lies in both r and
+// s.  Values split by splitters other than NumericSplitter and
+// CategorySetSplitter are not tracked, so such regions always
+// overlap.
+func (r region) overlaps(s region) bool {
+	if math.Max(r.lower, s.lower) >= math.Min(r.upper, s.upper) {
+		return false
+	}
+	in := append(append([]CategorySetSplitter(nil), r.in...), s.in...)
+	if len(in) == 0 {
+		return true // Infinitely many codes are in no set
+	}
+	out := append(append([]CategorySetSplitter(nil), r.out...), s.out...)
+	for _, code := range in[0] {
+		if memberOfAll(float64(code), in) && !memberOfAny(float64(code), out) {
+			return true
+		}
+	}
+	return false
+}
+
+func memberOfAll(x float64, sets []CategorySetSplitter) bool {
+	for _, s := range sets {
+		if !s.Split(x) {
+			return false
+		}
+	}
+	return true
+}
+
+func memberOfAny(x float64, sets []CategorySetSplitter) bool {
+	for _, s := range sets {
+		if s.Split(x) {
+			return true
+		}
+	}
+	return false
+}
+
+// leafRegion is a leaf along with the region of each feature that
+// reaches it.
+type leafRegion struct {
+	leaf    *DecisionTreeNode
+	regions []region
+}
+
+// leafRegions returns the leaves below n, which is reached by regions.
+// Surrogate splits are ignored.
+func (n *DecisionTreeNode) leafRegions(regions []region) []leafRegion {
+	if n.feature < 0 {
+		return []leafRegion{{n, regions}}
+	}
+
+	left := append([]region(nil), regions...)
+	right := append([]region(nil), regions...)
+	l, r := &left[n.feature], &right[n.feature]
+	l.missing, r.missing = l.missing && n.missingLeft, r.missing && !n.missingLeft
+	switch s := n.splitter.(type) {
+	case NumericSplitter:
+		l.upper = math.Min(l.upper, float64(s))
+		r.lower = math.Max(r.lower, float64(s))
+	case CategorySetSplitter:
+		l.in = append(append([]CategorySetSplitter(nil), l.in...), s)
+		r.out = append(append([]CategorySetSplitter(nil), r.out...), s)
+	}
+	return append(n.Left.leafRegions(left), n.Right.leafRegions(right)...)
+}
+
+// checkMonotonic returns an error describing a violation of the
+// monotonic constraints by one of trees, or nil if every tree is
+// monotone (which makes any weighted sum of the trees monotone).
+// Two leaves of a tree must be ordered by their values if some unit
+// could reach either one by changing only the (non-missing) value of
+// a constrained feature.  Units routed by surrogate splits are not
+// considered.
+func checkMonotonic(trees []*DecisionTreeNode, nFeatures int, constraints []int) error {
+	if len(constraints) != nFeatures {
+		return fmt.Errorf("%d monotonic constraints given for %d features", len(constraints), nFeatures)
+	}
+
+	root := make([]region, nFeatures)
+	for j := range root {
+		root[j] = region{lower: math.Inf(-1), upper: math.Inf(1), missing: true}
+	}
+
+	for t, tree := range trees {
+		if tree == nil {
+			continue
+		}
+		leaves := tree.leafRegions(root)
+		for f, c := range constraints {
+			if c == 0 {
+				continue
+			}
+			for _, a := range leaves {
+				for _, b := range leaves {
+					// a must not exceed b (c > 0) or b must not
+					// exceed a (c < 0) if a lies below b in f.
+					if a.regions[f].upper > b.regions[f].lower || float64(c)*(b.leaf.prediction-a.leaf.prediction) >= 0 {
+						continue
+					}
+					comparable := true
+					for j := range a.regions {
+						if j != f && !a.regions[j].overlaps(b.regions[j]) && !(a.regions[j].missing && b.regions[j].missing) {
+							comparable = false
+							break
+						}
+					}
+					if comparable {
+						return fmt.Errorf("tree %d: constraint %+d on feature %d is violated by leaf values %v (feature %d < %v) and %v (feature %d >= %v)",
+							t, c, f, a.leaf.prediction, f, a.regions[f].upper, b.leaf.prediction, f, b.regions[f].lower)
+					}
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// CheckMonotonic returns nil if the tree satisfies the monotonic
+// constraints (as described by WithMonotonicConstraints) or an error
+// describing a violation.  The check is exact for numeric features
+// and for units routed without surrogate splits.
+func (dtr *DecisionTree) CheckMonotonic(constraints []int) error {
+	return checkMonotonic([]*DecisionTreeNode{dtr.root}, dtr.nFeatures, constraints)
+}
+
+// CheckMonotonic returns nil if every tree of the forest satisfies
+// the monotonic constraints, which makes the forest satisfy them, or
+// an error describing a violation.
+func (rf *randomForest) CheckMonotonic(constraints []int) error {
+	return checkMonotonic(rf.trees, rf.nFeatures, constraints)
+}
+
+// CheckMonotonic returns nil if every tree of the model satisfies the
+// monotonic constraints, which makes the predictions (and, for
+// classifiers, the class scores) satisfy them, or an error describing
+// a violation.
+func (gb *gradientBoosting) CheckMonotonic(constraints []int) error {
+	var trees []*DecisionTreeNode
+	for _, iterationTrees := range gb.trees {
+		trees = append(trees, iterationTrees...)
+	}
+	return checkMonotonic(trees, gb.nFeatures, constraints)
+}
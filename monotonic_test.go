@@ -0,0 +1,79 @@
+package DragonBlood_test
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+
+	db "github.com/mawicks/DragonBlood"
+)
+
+func TestMonotonicConstraints(test *testing.T) {
+	// The target increases with x, but noise makes unconstrained
+	// trees non-monotone.  y is unconstrained.
+	rng := rand.New(rand.NewSource(11))
+	x := db.NewNumericFeature(nil)
+	y := db.NewNumericFeature(nil)
+	t := db.NewNumericFeature(nil)
+	for i := 0; i < 300; i++ {
+		xi, yi := rng.Float64(), rng.Float64()
+		x.Add(xi)
+		y.Add(yi)
+		t.Add(3*xi + math.Sin(6*yi) + rng.NormFloat64())
+	}
+	features := []db.OrderedFeature{x, y}
+
+	unconstrained := db.NewDecisionTreeRegressor(db.WithSeed(1))
+	unconstrained.Fit(features, t)
+	if unconstrained.CheckMonotonic([]int{1, 0}) == nil {
+		test.Errorf("Unconstrained tree is unexpectedly monotone")
+	}
+
+	constraints := []int{1, 0}
+	dt := db.NewDecisionTreeRegressor(db.WithSeed(1), db.WithMonotonicConstraints(constraints))
+	dt.Fit(features, t)
+	rf := db.NewRandomForestRegressor(10, db.WithSeed(1), db.WithMonotonicConstraints(constraints))
+	rf.Fit(features, t)
+	gb := db.NewGradientBoostingRegressor(20, db.WithSeed(1), db.WithLoss(db.AbsoluteLoss{}), db.WithMonotonicConstraints(constraints))
+	gb.Fit(features, t)
+
+	for _, model := range []interface {
+		Predict([]db.Feature) []float64
+		CheckMonotonic([]int) error
+	}{dt, rf, gb} {
+		if err := model.CheckMonotonic(constraints); err != nil {
+			test.Errorf("%T: CheckMonotonic() returned %v", model, err)
+		}
+
+		// Predictions increase along x for every value of y
+		for _, yi := range []float64{0.1, 0.5, 0.9} {
+			gridX := db.NewNumericFeature(nil)
+			gridY := db.NewNumericFeature(nil)
+			for i := 0; i <= 100; i++ {
+				gridX.Add(float64(i) / 100)
+				gridY.Add(yi)
+			}
+			p := model.Predict([]db.Feature{gridX, gridY})
+			for i := 1; i < len(p); i++ {
+				if p[i] < p[i-1] {
+					test.Errorf("%T: prediction decreases from %v to %v at x=%v, y=%v", model, p[i-1], p[i], gridX.Value(i), yi)
+					break
+				}
+			}
+		}
+	}
+
+	// A decreasing constraint on the negated feature
+	negX := db.NewNumericFeature(nil)
+	for i := 0; i < x.Len(); i++ {
+		negX.Add(-x.NumericValue(i))
+	}
+	decreasing := db.NewDecisionTreeRegressor(db.WithSeed(1), db.WithMonotonicConstraints([]int{-1, 0}))
+	decreasing.Fit([]db.OrderedFeature{negX, y}, t)
+	if err := decreasing.CheckMonotonic([]int{-1, 0}); err != nil {
+		test.Errorf("CheckMonotonic() returned %v", err)
+	}
+	if decreasing.CheckMonotonic([]int{1, 0}) == nil {
+		test.Errorf("Decreasing tree satisfies an increasing constraint")
+	}
+}
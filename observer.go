@@ -0,0 +1,113 @@
+package DragonBlood
+
+import (
+	"context"
+	"log/slog"
+)
+
+// TrainingObserver receives events as trees are grown.  Training is
+// silent unless an observer is configured with WithObserver.  The
+// trees of a forest grown with NumJobs > 1 are grown concurrently, so
+// an observer of such a forest must be safe for concurrent use.
+//
+// Embed NopObserver to implement only some of the methods.
+type TrainingObserver interface {
+	// Iteration is called after each generation of splittable nodes
+	// has been evaluated and split.
+	Iteration(IterationEvent)
+
+	// Split is called for each split applied to a node.
+	Split(SplitEvent)
+
+	// Tree is called when a tree is complete.
+	Tree(TreeEvent)
+}
+
+// IterationEvent describes one generation of the growth of a tree.
+type IterationEvent struct {
+	// Tree is the index of the tree within its forest (0 for a
+	// single tree).
+	Tree int
+
+	// Iteration counts the generations of the tree from 0.
+	Iteration int
+
+	// Nodes is the number of splittable nodes in the generation
+	// and Splits is the number of them that were split.
+	Nodes, Splits int
+}
+
+// SplitEvent describes a split applied to a node.
+type SplitEvent struct {
+	Tree, Iteration int
+
+	// Depth is the depth of the node that was split (the root has
+	// depth 0).
+	Depth int
+
+	Feature   int
+	Splitter  Splitter
+	Reduction float64
+
+	// Left and Right describe the children created by the split.
+	Left, Right Metric
+}
+
+// TreeEvent describes a completed tree.
+type TreeEvent struct {
+	Tree       int
+	Iterations int
+	Leaves     int
+	Root       *DecisionTreeNode
+}
+
+// NopObserver is a TrainingObserver that ignores all events.
+type NopObserver struct{}
+
+func (NopObserver) Iteration(IterationEvent) {}
+func (NopObserver) Split(SplitEvent)         {}
+func (NopObserver) Tree(TreeEvent)           {}
+
+// WithObserver sends training events to observer.
+func WithObserver(observer TrainingObserver) Option {
+	return func(dtg *decisionTreeGrower) { dtg.observer = observer }
+}
+
+// slogObserver is a TrainingObserver that writes events to a
+// structured logger.
+type slogObserver struct {
+	logger *slog.Logger
+}
+
+// NewSlogObserver returns a TrainingObserver that logs completed trees
+// at slog.LevelInfo and iterations and splits at slog.LevelDebug.
+func NewSlogObserver(logger *slog.Logger) TrainingObserver {
+	return slogObserver{logger}
+}
+
+func (o slogObserver) Iteration(e IterationEvent) {
+	o.logger.LogAttrs(context.Background(), slog.LevelDebug, "iteration",
+		slog.Int("tree", e.Tree),
+		slog.Int("iteration", e.Iteration),
+		slog.Int("nodes", e.Nodes),
+		slog.Int("splits", e.Splits))
+}
+
+func (o slogObserver) Split(e SplitEvent) {
+	o.logger.LogAttrs(context.Background(), slog.LevelDebug, "split",
+		slog.Int("tree", e.Tree),
+		slog.Int("iteration", e.Iteration),
+		slog.Int("depth", e.Depth),
+		slog.Int("feature", e.Feature),
+		slog.String("splitter", e.Splitter.String()),
+		slog.Float64("reduction", e.Reduction),
+		slog.Int("leftSize", e.Left.Size()),
+		slog.Int("rightSize", e.Right.Size()))
+}
+
+func (o slogObserver) Tree(e TreeEvent) {
+	o.logger.LogAttrs(context.Background(), slog.LevelInfo, "tree",
+		slog.Int("tree", e.Tree),
+		slog.Int("iterations", e.Iterations),
+		slog.Int("leaves", e.Leaves))
+}
@@ -0,0 +1,59 @@
+package DragonBlood_test
+
+import (
+	"bytes"
+	"log/slog"
+	"strings"
+	"sync"
+	"testing"
+
+	db "github.com/mawicks/DragonBlood"
+)
+
+// countingObserver counts splits and leaves by tree.
+type countingObserver struct {
+	db.NopObserver
+	sync.Mutex
+	splits map[int]int
+	leaves map[int]int
+}
+
+func (o *countingObserver) Split(e db.SplitEvent) {
+	o.Lock()
+	defer o.Unlock()
+	o.splits[e.Tree] += 1
+}
+
+func (o *countingObserver) Tree(e db.TreeEvent) {
+	o.Lock()
+	defer o.Unlock()
+	o.leaves[e.Tree] = e.Leaves
+}
+
+func TestTrainingObserver(test *testing.T) {
+	x := db.NewNumericFeature([]float64{0, 1, 2, 3, 4, 5, 6, 7})
+	t := db.NewNumericFeature([]float64{3, 0, 3, 1, 7, 6, 5, -1})
+
+	observer := &countingObserver{splits: make(map[int]int), leaves: make(map[int]int)}
+	rf := db.NewRandomForestRegressor(5, db.WithObserver(observer), db.WithNumJobs(2))
+	rf.Fit([]db.OrderedFeature{x}, t)
+
+	if len(observer.leaves) != 5 {
+		test.Errorf("Observed %d trees; expected 5", len(observer.leaves))
+	}
+	for tree, leaves := range observer.leaves {
+		if observer.splits[tree] != leaves-1 {
+			test.Errorf("Tree %d: observed %d splits and %d leaves", tree, observer.splits[tree], leaves)
+		}
+	}
+
+	var output bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&output, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	dt := db.NewDecisionTreeRegressor(db.WithObserver(db.NewSlogObserver(logger)))
+	dt.Fit([]db.OrderedFeature{x}, t)
+	for _, message := range []string{"msg=iteration", "msg=split", "msg=tree"} {
+		if !strings.Contains(output.String(), message) {
+			test.Errorf("Log lacks %q:\n%s", message, output.String())
+		}
+	}
+}
@@ -0,0 +1,106 @@
+package DragonBlood
+
+import (
+	"math"
+
+	"github.com/mawicks/DragonBlood/stats"
+)
+
+// OOBReport holds out-of-bag diagnostics of the trees of a forest.  A
+// unit is out of bag for a tree if it is not in the tree's bootstrap
+// sample.
+type OOBReport struct {
+	// Prediction is the mean prediction of each unit by the trees for
+	// which it was out of bag, as returned by Fit, or NaN if it was
+	// never out of bag.
+	Prediction []float64
+
+	// Count is the number of trees for which each unit was out of bag.
+	Count []int
+
+	// Variance is the variance of the predictions of each unit by the
+	// trees for which it was out of bag, or NaN if it was never out of
+	// bag.
+	Variance []float64
+
+	// ScoreCurve[t] is the score of the out-of-bag predictions of the
+	// first t+1 trees, over the units that were out of bag for at
+	// least one of them (NaN if there are none).  The score levels off
+	// once the forest has enough trees.
+	ScoreCurve []float64
+
+	// Bags holds the sample on which each tree was grown.  Unit i was
+	// out of bag for tree t if Bags[t].Count(i) is zero.
+	Bags []Bag
+}
+
+// OOBReport returns out-of-bag diagnostics of the trees of the forest,
+// with scores computed by scorer.  features and target must be those
+// with which the forest was trained, since each tree's sample is
+// redrawn from the forest's seed.  OOBReport panics if the forest
+// wasn't trained on bootstrap samples, even if it was loaded into a
+// forest whose options select them.
+func (rf *RandomForestRegressor) OOBReport(features []Feature, target Feature, scorer Scorer) *OOBReport {
+	rf.checkOOB("OOBReport", features)
+
+	n := target.Len()
+	trees := rf.trees
+	seeds := rf.treeSeeds()
+	report := &OOBReport{
+		Prediction: make([]float64, n),
+		Count:      make([]int, n),
+		Variance:   make([]float64, n),
+		ScoreCurve: make([]float64, len(trees)),
+		Bags:       make([]Bag, len(trees)),
+	}
+
+	// oob[t] are the out-of-bag units of tree t and predictions[t]
+	// are their predictions by tree t.
+	oob := make([][]int, len(trees))
+	predictions := make([][]float64, len(trees))
+	rf.parallelRange(len(trees), func(start, end int) {
+		for t := start; t < end; t++ {
+			_, report.Bags[t] = rf.treeBag(seeds[t], n)
+			if trees[t] == nil {
+				continue
+			}
+			for i := 0; i < n; i++ {
+				if report.Bags[t].Count(i) == 0 {
+					oob[t] = append(oob[t], i)
+					predictions[t] = append(predictions[t], trees[t].leaf(features, i).prediction)
+				}
+			}
+		}
+	})
+
+	targetValues := featureValues(target)
+	accumulators := make([]*stats.VarianceAccumulator, n)
+	for i := range accumulators {
+		accumulators[i] = stats.NewVarianceAccumulator()
+	}
+	for t := range trees {
+		for k, i := range oob[t] {
+			accumulators[i].Add(predictions[t][k])
+		}
+		var p, y []float64
+		for i, a := range accumulators {
+			if a.Count() > 0 {
+				p = append(p, a.Mean())
+				y = append(y, targetValues[i])
+			}
+		}
+		report.ScoreCurve[t] = math.NaN()
+		if len(p) > 0 {
+			report.ScoreCurve[t] = scorer.Score(p, y)
+		}
+	}
+
+	for i, a := range accumulators {
+		report.Count[i] = a.Count()
+		report.Prediction[i], report.Variance[i] = math.NaN(), math.NaN()
+		if a.Count() > 0 {
+			report.Prediction[i], report.Variance[i] = a.Mean(), a.Variance()
+		}
+	}
+	return report
+}
@@ -0,0 +1,114 @@
+package DragonBlood_test
+
+import (
+	"bytes"
+	"math"
+	"math/rand"
+	"testing"
+
+	db "github.com/mawicks/DragonBlood"
+)
+
+func TestOOBReport(test *testing.T) {
+	rng := rand.New(rand.NewSource(6))
+	x := db.NewNumericFeature(nil)
+	t := db.NewNumericFeature(nil)
+	for i := 0; i < 100; i++ {
+		xi := rng.Float64()
+		x.Add(xi)
+		t.Add(math.Sin(6*xi) + 0.1*rng.NormFloat64())
+	}
+
+	rf := db.NewRandomForestRegressor(30, db.WithSeed(2), db.WithNumJobs(3))
+	oob := rf.Fit([]db.OrderedFeature{x}, t)
+	report := rf.OOBReport([]db.Feature{x}, t, db.MSEScorer{})
+
+	if len(report.Bags) != 30 || len(report.ScoreCurve) != 30 {
+		test.Fatalf("Report has %d bags and %d scores; expected 30", len(report.Bags), len(report.ScoreCurve))
+	}
+	for i := range oob {
+		count := 0
+		for _, bag := range report.Bags {
+			if bag.Count(i) == 0 {
+				count++
+			}
+		}
+		if report.Count[i] != count {
+			test.Errorf("Unit %d: OOB count %d; bags leave it out %d times", i, report.Count[i], count)
+		}
+		if count == 0 {
+			if !math.IsNaN(report.Prediction[i]) || !math.IsNaN(report.Variance[i]) || !math.IsNaN(oob[i]) {
+				test.Errorf("Unit %d was never out of bag but has prediction %v and variance %v", i, report.Prediction[i], report.Variance[i])
+			}
+			continue
+		}
+		if math.Abs(report.Prediction[i]-oob[i]) > 1e-12 {
+			test.Errorf("Unit %d: report predicts %v; Fit predicted %v", i, report.Prediction[i], oob[i])
+		}
+		if report.Variance[i] < 0 || (count == 1 && report.Variance[i] != 0) {
+			test.Errorf("Unit %d: variance %v over %d trees", i, report.Variance[i], count)
+		}
+	}
+
+	var p, y []float64
+	for i, prediction := range report.Prediction {
+		if !math.IsNaN(prediction) {
+			p = append(p, prediction)
+			y = append(y, t.NumericValue(i))
+		}
+	}
+	last := report.ScoreCurve[len(report.ScoreCurve)-1]
+	if math.Abs(last-db.MSE(p, y)) > 1e-12 {
+		test.Errorf("Final OOB score is %v; the MSE of the OOB predictions is %v", last, db.MSE(p, y))
+	}
+	if !(last < report.ScoreCurve[0]) {
+		test.Errorf("OOB error of 30 trees %v is not less than that of one tree %v", last, report.ScoreCurve[0])
+	}
+}
+
+func TestOOBReportOfLoadedForest(test *testing.T) {
+	rng := rand.New(rand.NewSource(7))
+	x := db.NewNumericFeature(nil)
+	t := db.NewNumericFeature(nil)
+	for i := 0; i < 50; i++ {
+		xi := rng.Float64()
+		x.Add(xi)
+		t.Add(xi + 0.1*rng.NormFloat64())
+	}
+
+	// The loaded forest's options don't change the bags it reports.
+	rf := db.NewRandomForestRegressor(10, db.WithSeed(3))
+	rf.Fit([]db.OrderedFeature{x}, t)
+	report := rf.OOBReport([]db.Feature{x}, t, db.MSEScorer{})
+	var buffer bytes.Buffer
+	if err := rf.Save(&buffer); err != nil {
+		test.Fatalf("Save returned %v", err)
+	}
+	loaded := db.NewRandomForestRegressor(0, db.WithBootstrap(false))
+	if err := loaded.Load(&buffer); err != nil {
+		test.Fatalf("Load returned %v", err)
+	}
+	loadedReport := loaded.OOBReport([]db.Feature{x}, t, db.MSEScorer{})
+	for i, count := range report.Count {
+		if loadedReport.Count[i] != count {
+			test.Errorf("Unit %d: loaded forest has OOB count %d; expected %d", i, loadedReport.Count[i], count)
+		}
+	}
+
+	unbagged := db.NewRandomForestRegressor(10, db.WithSeed(3), db.WithBootstrap(false))
+	unbagged.Fit([]db.OrderedFeature{x}, t)
+	buffer.Reset()
+	if err := unbagged.SaveJSON(&buffer); err != nil {
+		test.Fatalf("SaveJSON returned %v", err)
+	}
+	loaded = db.NewRandomForestRegressor(0)
+	if err := loaded.Load(&buffer); err != nil {
+		test.Fatalf("Load returned %v", err)
+	}
+	defer func() {
+		if recover() == nil {
+			test.Errorf("OOBReport() didn't panic for a forest grown without bootstrap samples")
+		}
+	}()
+	loaded.OOBReport([]db.Feature{x}, t, db.MSEScorer{})
+}
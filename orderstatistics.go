@@ -0,0 +1,369 @@
+package DragonBlood
+
+import (
+	"math"
+	"sort"
+)
+
+// MAECriterion grows regression trees that minimize absolute error.
+// Leaves predict the median of their targets.
+type MAECriterion struct{}
+
+func (MAECriterion) NewAccumulator(minLeafSize float64) SplitAccumulator {
+	return newRankAccumulator(minLeafSize, MAECriterion{})
+}
+
+func (MAECriterion) LeafMetric(targets, weights []float64) Metric {
+	weights = unitWeights(targets, weights)
+	return Metric{size: len(targets), weight: sum(weights), prediction: MAECriterion{}.location(targets, weights)}
+}
+
+func (MAECriterion) impurity(targets, weights []float64) float64 {
+	return rankImpurity(MAECriterion{}, targets, weights)
+}
+
+func (MAECriterion) location(targets, weights []float64) float64 {
+	return weightedMedian(targets, weights)
+}
+
+// loss is the weighted sum of absolute deviations about the median.
+func (MAECriterion) loss(f *fenwickTree, values []float64) float64 {
+	count, sum, _ := f.prefix(len(values))
+	if count == 0 {
+		return 0.0
+	}
+	r := f.search(0.5 * count)
+	m := values[r]
+	below, belowSum, _ := f.prefix(r + 1)
+	return m*below - belowSum + (sum - belowSum) - m*(count-below)
+}
+
+// HuberCriterion grows regression trees that minimize the Huber loss,
+// which is quadratic for residuals smaller than Delta and linear
+// beyond it.  Splits are scored by the Huber loss of the residuals
+// about the node median.  Leaves predict the median plus the mean of
+// the residuals clipped to [-Delta, Delta] (a one-step Huber
+// M-estimate).  Delta must be positive.
+type HuberCriterion struct {
+	Delta float64
+}
+
+func (h HuberCriterion) NewAccumulator(minLeafSize float64) SplitAccumulator {
+	return newRankAccumulator(minLeafSize, h)
+}
+
+func (h HuberCriterion) LeafMetric(targets, weights []float64) Metric {
+	weights = unitWeights(targets, weights)
+	return Metric{size: len(targets), weight: sum(weights), prediction: h.location(targets, weights)}
+}
+
+func (h HuberCriterion) impurity(targets, weights []float64) float64 {
+	return rankImpurity(h, targets, weights)
+}
+
+func (h HuberCriterion) location(targets, weights []float64) float64 {
+	m := weightedMedian(targets, weights)
+	if math.IsNaN(m) {
+		return m
+	}
+	clipped, total := 0.0, 0.0
+	for i, t := range targets {
+		clipped += weights[i] * math.Max(-h.Delta, math.Min(h.Delta, t-m))
+		total += weights[i]
+	}
+	return m + clipped/total
+}
+
+func (h HuberCriterion) loss(f *fenwickTree, values []float64) float64 {
+	count, sum, _ := f.prefix(len(values))
+	if count == 0 {
+		return 0.0
+	}
+	m := values[f.search(0.5*count)]
+
+	lo := sort.SearchFloat64s(values, m-h.Delta)
+	hi := sort.Search(len(values), func(i int) bool { return values[i] > m+h.Delta })
+
+	loCount, loSum, loSumSquares := f.prefix(lo)
+	hiCount, hiSum, hiSumSquares := f.prefix(hi)
+
+	innerCount := hiCount - loCount
+	innerSum := hiSum - loSum
+	innerSumSquares := hiSumSquares - loSumSquares
+	inner := 0.5 * (innerSumSquares - 2.0*m*innerSum + m*m*innerCount)
+
+	lower := h.Delta*(m*loCount-loSum) - 0.5*h.Delta*h.Delta*loCount
+
+	upperCount := count - hiCount
+	upper := h.Delta*((sum-hiSum)-m*upperCount) - 0.5*h.Delta*h.Delta*upperCount
+
+	return math.Max(inner, 0.0) + lower + upper
+}
+
+// rankLoss is a loss that can be evaluated from the order statistics
+// of a node's targets.
+type rankLoss interface {
+	// loss returns the loss of the targets tallied in f, whose ranks
+	// index the sorted distinct target values.
+	loss(f *fenwickTree, values []float64) float64
+
+	// location returns the prediction of a node containing targets
+	// with the corresponding weights.
+	location(targets, weights []float64) float64
+}
+
+type featureTarget struct {
+	feature, target, weight float64
+}
+
+// rankAccumulator is a SplitAccumulator for losses, such as absolute
+// error, that depend on order statistics of the targets and so cannot
+// be updated by simply adding and subtracting values.  Move() records
+// the units in feature order and BestSplit() evaluates every split
+// with two passes over the recorded units, maintaining the order
+// statistics of each side in a Fenwick tree.
+type rankAccumulator struct {
+	minLeafSize float64
+	rankLoss    rankLoss
+	added       int
+	moved       []featureTarget
+}
+
+func newRankAccumulator(minLeafSize float64, rankLoss rankLoss) *rankAccumulator {
+	return &rankAccumulator{minLeafSize: minLeafSize, rankLoss: rankLoss}
+}
+
+func (a *rankAccumulator) Add(targetValue, weight float64) {
+	a.added += 1
+}
+
+func (a *rankAccumulator) Move(featureValue, targetValue, weight float64) {
+	a.moved = append(a.moved, featureTarget{featureValue, targetValue, weight})
+}
+
+func (a *rankAccumulator) BestSplit() *SplitInfo {
+	if len(a.moved) != a.added {
+		panic("BestSplit() called prematurely (fewer Move() calls than Add() calls)")
+	}
+
+	n := len(a.moved)
+	values := make([]float64, n)
+	for i, m := range a.moved {
+		values[i] = m.target
+	}
+	sort.Float64s(values)
+	distinct := values[:0]
+	for i, v := range values {
+		if i == 0 || v != distinct[len(distinct)-1] {
+			distinct = append(distinct, v)
+		}
+	}
+
+	ranks := make([]int, n)
+	for i, m := range a.moved {
+		ranks[i] = sort.SearchFloat64s(distinct, m.target)
+	}
+
+	// rightLoss[i] is the loss of units i through n-1
+	rightLoss := make([]float64, n+1)
+	right := newFenwickTree(len(distinct))
+	for i := n - 1; i >= 0; i-- {
+		right.add(ranks[i], a.moved[i].weight, a.moved[i].target)
+		rightLoss[i] = a.rankLoss.loss(right, distinct)
+	}
+	totalWeight, _, _ := right.prefix(len(distinct))
+
+	initialMetric := rightLoss[0]
+	bestMetric := initialMetric
+	bestIndex := -1
+
+	left := newFenwickTree(len(distinct))
+	leftWeight := 0.0
+	for i := 0; i < n; i++ {
+		if i > 0 && a.moved[i].feature != a.moved[i-1].feature && leftWeight >= a.minLeafSize && totalWeight-leftWeight >= a.minLeafSize {
+			if metric := a.rankLoss.loss(left, distinct) + rightLoss[i]; metric < bestMetric {
+				bestMetric = metric
+				bestIndex = i
+			}
+		}
+		left.add(ranks[i], a.moved[i].weight, a.moved[i].target)
+		leftWeight += a.moved[i].weight
+	}
+
+	var result *SplitInfo
+	if bestIndex > 0 {
+		result = &SplitInfo{
+			splitter:  NumericSplitter(splitThreshold(a.moved[bestIndex-1].feature, a.moved[bestIndex].feature)),
+			reduction: initialMetric - bestMetric,
+			left:      a.metric(a.moved[:bestIndex]),
+			right:     a.metric(a.moved[bestIndex:]),
+		}
+	}
+	return result
+}
+
+// metric returns the Metric of a node containing the units moved.
+func (a *rankAccumulator) metric(moved []featureTarget) Metric {
+	targets := make([]float64, len(moved))
+	weights := make([]float64, len(moved))
+	for i, m := range moved {
+		targets[i] = m.target
+		weights[i] = m.weight
+	}
+	return Metric{size: len(moved), weight: sum(weights), prediction: a.rankLoss.location(targets, weights)}
+}
+
+// rankImpurity returns the loss of a node containing targets with the
+// corresponding weights.
+func rankImpurity(rankLoss rankLoss, targets, weights []float64) float64 {
+	weights = unitWeights(targets, weights)
+	values := make([]float64, len(targets))
+	copy(values, targets)
+	sort.Float64s(values)
+	distinct := values[:0]
+	for i, v := range values {
+		if i == 0 || v != distinct[len(distinct)-1] {
+			distinct = append(distinct, v)
+		}
+	}
+
+	f := newFenwickTree(len(distinct))
+	for i, t := range targets {
+		f.add(sort.SearchFloat64s(distinct, t), weights[i], t)
+	}
+	return rankLoss.loss(f, distinct)
+}
+
+// fenwickTree tallies the count (total weight), sum, and sum of
+// squares of values by rank and supports prefix queries in
+// logarithmic time.
+type fenwickTree struct {
+	count, sum, sumSquares []float64
+}
+
+func newFenwickTree(n int) *fenwickTree {
+	return &fenwickTree{
+		make([]float64, n+1),
+		make([]float64, n+1),
+		make([]float64, n+1),
+	}
+}
+
+// add tallies count units of value x at rank r.
+func (f *fenwickTree) add(r int, count, x float64) {
+	for i := r + 1; i < len(f.count); i += i & -i {
+		f.count[i] += count
+		f.sum[i] += count * x
+		f.sumSquares[i] += count * x * x
+	}
+}
+
+// prefix returns the tallies of all ranks less than r.
+func (f *fenwickTree) prefix(r int) (count, sum, sumSquares float64) {
+	for i := r; i > 0; i -= i & -i {
+		count += f.count[i]
+		sum += f.sum[i]
+		sumSquares += f.sumSquares[i]
+	}
+	return count, sum, sumSquares
+}
+
+// search returns the smallest rank r such that the count of ranks
+// less than or equal to r is at least target.
+func (f *fenwickTree) search(target float64) int {
+	step := 1
+	for step*2 < len(f.count) {
+		step *= 2
+	}
+	position := 0
+	for ; step > 0; step /= 2 {
+		if position+step < len(f.count) && f.count[position+step] < target {
+			position += step
+			target -= f.count[position]
+		}
+	}
+	return position
+}
+
+// weightedMedian returns the weighted median of x, which is the
+// midpoint of the two middle values when the cumulative weight falls
+// exactly on one half, or NaN if the total weight is not positive.
+// With equal weights it is the ordinary median.  x and w are not
+// modified.
+func weightedMedian(x, w []float64) float64 {
+	order := make([]int, len(x))
+	for i := range order {
+		order[i] = i
+	}
+	sort.Slice(order, func(a, b int) bool { return x[order[a]] < x[order[b]] })
+
+	half := 0.5 * sum(w)
+	if !(half > 0) {
+		return math.NaN()
+	}
+	cumulative := 0.0
+	for k, i := range order {
+		cumulative += w[i]
+		if cumulative > half {
+			return x[i]
+		}
+		if cumulative == half {
+			for _, j := range order[k+1:] {
+				if w[j] > 0 {
+					return 0.5 * (x[i] + x[j])
+				}
+			}
+			return x[i]
+		}
+	}
+	return x[order[len(order)-1]]
+}
+
+// weightedQuantile returns the smallest value of x at which the
+// cumulative weight reaches alpha times the total weight, or NaN if
+// the total weight is not positive.  x and w are not modified.
+func weightedQuantile(x, w []float64, alpha float64) float64 {
+	return weightedQuantiles(x, w, []float64{alpha})[0]
+}
+
+// weightedQuantiles returns weightedQuantile(x, w, alpha) for each
+// alpha in alphas, sorting x only once.
+func weightedQuantiles(x, w []float64, alphas []float64) []float64 {
+	result := make([]float64, len(alphas))
+
+	total := sum(w)
+	if !(total > 0) {
+		for k := range result {
+			result[k] = math.NaN()
+		}
+		return result
+	}
+
+	order := make([]int, len(x))
+	for i := range order {
+		order[i] = i
+	}
+	sort.Slice(order, func(a, b int) bool { return x[order[a]] < x[order[b]] })
+
+	for k, alpha := range alphas {
+		result[k] = x[order[len(order)-1]]
+		cumulative := 0.0
+		for _, i := range order {
+			cumulative += w[i]
+			if w[i] > 0 && cumulative >= alpha*total {
+				result[k] = x[i]
+				break
+			}
+		}
+	}
+	return result
+}
+
+// sum returns the sum of the elements of x.
+func sum(x []float64) float64 {
+	result := 0.0
+	for _, v := range x {
+		result += v
+	}
+	return result
+}
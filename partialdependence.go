@@ -0,0 +1,256 @@
+package DragonBlood
+
+import (
+	"fmt"
+	"math"
+	"sort"
+)
+
+// Partial dependence (Friedman 2001) is the mean prediction of a model
+// as a function of some features, averaging over the values of the
+// others.  Individual conditional expectation (ICE) curves (Goldstein
+// et al. 2015) show the prediction for each unit separately, so their
+// mean is the partial dependence.
+
+// PartialDependenceGrid returns the values at which to evaluate the
+// partial dependence on feature: every category code of a
+// CategoricalFeature, or, for other features, the distinct
+// non-missing values if there are at most n of them and otherwise n
+// quantiles evenly spaced from the minimum to the maximum.  It panics
+// if n is less than 2.
+func PartialDependenceGrid(feature Feature, n int) []float64 {
+	if n < 2 {
+		panic(fmt.Sprintf("a partial dependence grid requires at least 2 values (%d requested)", n))
+	}
+	if cf, ok := feature.(*CategoricalFeature); ok {
+		grid := make([]float64, cf.Categories())
+		for code := range grid {
+			grid[code] = float64(code)
+		}
+		return grid
+	}
+
+	var values []float64
+	for i := 0; i < feature.Len(); i++ {
+		if x := feature.NumericValue(i); !math.IsNaN(x) {
+			values = append(values, x)
+		}
+	}
+	sort.Float64s(values)
+	var distinct []float64
+	for k, x := range values {
+		if k == 0 || x != values[k-1] {
+			distinct = append(distinct, x)
+		}
+	}
+	if len(distinct) <= n {
+		return distinct
+	}
+
+	levels := make([]float64, n)
+	for k := range levels {
+		levels[k] = float64(k) / float64(n-1)
+	}
+	weights := make([]float64, len(values))
+	for i := range weights {
+		weights[i] = 1
+	}
+	var grid []float64
+	for _, x := range weightedQuantiles(values, weights, levels) {
+		if len(grid) == 0 || x != grid[len(grid)-1] {
+			grid = append(grid, x)
+		}
+	}
+	return grid
+}
+
+// fixedFeature presents a feature whose values are all value.
+type fixedFeature struct {
+	Feature
+	value float64
+}
+
+func (ff *fixedFeature) NumericValue(int) float64 { return ff.value }
+func (ff *fixedFeature) Value(int) interface{}    { return ff.Decode(ff.value) }
+
+// recursivePartialDependence is implemented by tree models whose
+// partial dependence can be computed by traversing their trees.
+type recursivePartialDependence interface {
+	partialDependence(featureIndexes []int, values []float64) float64
+}
+
+// partialDependence returns the partial dependence of the tree below n
+// on the features with the given indexes at the given values.  Splits
+// of those features send the values to one child; other splits send
+// them to both children, weighted by the fraction of the training
+// units that reached each child (Friedman 2001).
+func (n *DecisionTreeNode) partialDependence(featureIndexes []int, values []float64) float64 {
+	if n.feature < 0 {
+		return n.prediction
+	}
+	for k, j := range featureIndexes {
+		if j == n.feature {
+			if n.splitter.Split(values[k]) {
+				return n.Left.partialDependence(featureIndexes, values)
+			}
+			return n.Right.partialDependence(featureIndexes, values)
+		}
+	}
+	left, right := n.coverFractions()
+	return left*n.Left.partialDependence(featureIndexes, values) + right*n.Right.partialDependence(featureIndexes, values)
+}
+
+func (dtr *DecisionTree) partialDependence(featureIndexes []int, values []float64) float64 {
+	return dtr.root.partialDependence(featureIndexes, values)
+}
+
+func (rf *RandomForestRegressor) partialDependence(featureIndexes []int, values []float64) float64 {
+	result := 0.0
+	for t, tree := range rf.trees {
+		if tree != nil {
+			result += (tree.partialDependence(featureIndexes, values) - result) / float64(t+1)
+		}
+	}
+	return result
+}
+
+func (gb *GradientBoostingRegressor) partialDependence(featureIndexes []int, values []float64) float64 {
+	result := gb.initial[0]
+	for _, iterationTrees := range gb.trees {
+		result += gb.grower.boosting.LearningRate * iterationTrees[0].partialDependence(featureIndexes, values)
+	}
+	return result
+}
+
+// gridPoints calls f with each combination of the values of grids, in
+// row-major order, along with the position of the combination in each
+// grid.
+func gridPoints(grids [][]float64, f func(position []int, values []float64)) {
+	position := make([]int, len(grids))
+	values := make([]float64, len(grids))
+	var visit func(k int)
+	visit = func(k int) {
+		if k == len(grids) {
+			f(position, values)
+			return
+		}
+		for position[k], values[k] = range grids[k] {
+			visit(k + 1)
+		}
+	}
+	visit(0)
+}
+
+// checkFeatureIndexes panics if featureIndexes are not distinct
+// indexes of features.
+func checkFeatureIndexes(features []Feature, featureIndexes []int) {
+	for k, j := range featureIndexes {
+		if j < 0 || j >= len(features) {
+			panic(fmt.Sprintf("Argument mismatch: feature index %d with %d features", j, len(features)))
+		}
+		for _, other := range featureIndexes[:k] {
+			if other == j {
+				panic(fmt.Sprintf("feature index %d given twice", j))
+			}
+		}
+	}
+}
+
+// conditionalExpectations calls f with the predictions of model for
+// every unit of features when the features with the given indexes are
+// set to each combination of the values of grids.
+func conditionalExpectations(model Predictor, features []Feature, featureIndexes []int, grids [][]float64, f func(position []int, predictions []float64)) {
+	checkFeatureIndexes(features, featureIndexes)
+	fixed := make([]Feature, len(features))
+	copy(fixed, features)
+	gridPoints(grids, func(position []int, values []float64) {
+		for k, j := range featureIndexes {
+			fixed[j] = &fixedFeature{features[j], values[k]}
+		}
+		f(position, model.Predict(fixed))
+	})
+}
+
+// partialDependence returns the partial dependence of model on the
+// features with the given indexes at each combination of the values
+// of grids, in row-major order.
+func partialDependence(model Predictor, features []Feature, featureIndexes []int, grids [][]float64) []float64 {
+	var result []float64
+	if tree, ok := model.(recursivePartialDependence); ok {
+		checkFeatureIndexes(features, featureIndexes)
+		gridPoints(grids, func(_ []int, values []float64) {
+			result = append(result, tree.partialDependence(featureIndexes, values))
+		})
+		return result
+	}
+
+	conditionalExpectations(model, features, featureIndexes, grids, func(_ []int, predictions []float64) {
+		result = append(result, mean(predictions))
+	})
+	return result
+}
+
+func mean(x []float64) float64 {
+	return sum(x) / float64(len(x))
+}
+
+// PartialDependence returns the mean prediction of model when feature
+// featureIndex of every unit of features is set to each value of grid
+// (see PartialDependenceGrid).  For decision trees, regression
+// forests, and gradient boosted regressors, it is computed by
+// traversing the trees, weighting the children of splits of other
+// features by the fraction of the training units that reached them,
+// which averages over the training data rather than over features
+// (only len(features) is used).  For other models, the mean is taken
+// over the units of features.
+func PartialDependence(model Predictor, features []Feature, featureIndex int, grid []float64) []float64 {
+	return partialDependence(model, features, []int{featureIndex}, [][]float64{grid})
+}
+
+// PartialDependence2D returns the partial dependence of model on two
+// features, indexed by the position of their values in their grids.
+// See PartialDependence.
+func PartialDependence2D(model Predictor, features []Feature, featureIndexes [2]int, grids [2][]float64) [][]float64 {
+	flat := partialDependence(model, features, featureIndexes[:], grids[:])
+	result := make([][]float64, len(grids[0]))
+	for k := range result {
+		result[k] = flat[k*len(grids[1]) : (k+1)*len(grids[1])]
+	}
+	return result
+}
+
+// ICE returns the individual conditional expectation curve of each
+// unit of features: the prediction of model for the unit when feature
+// featureIndex is set to each value of grid.  The mean of the curves
+// is the partial dependence over features.
+func ICE(model Predictor, features []Feature, featureIndex int, grid []float64) [][]float64 {
+	result := make([][]float64, features[0].Len())
+	for i := range result {
+		result[i] = make([]float64, len(grid))
+	}
+	conditionalExpectations(model, features, []int{featureIndex}, [][]float64{grid}, func(position []int, predictions []float64) {
+		for i, p := range predictions {
+			result[i][position[0]] = p
+		}
+	})
+	return result
+}
+
+// ICE2D returns the individual conditional expectation surface of
+// each unit of features for two features, indexed by unit and by the
+// position of the features' values in their grids.  See ICE.
+func ICE2D(model Predictor, features []Feature, featureIndexes [2]int, grids [2][]float64) [][][]float64 {
+	result := make([][][]float64, features[0].Len())
+	for i := range result {
+		result[i] = make([][]float64, len(grids[0]))
+		for k := range result[i] {
+			result[i][k] = make([]float64, len(grids[1]))
+		}
+	}
+	conditionalExpectations(model, features, featureIndexes[:], grids[:], func(position []int, predictions []float64) {
+		for i, p := range predictions {
+			result[i][position[0]][position[1]] = p
+		}
+	})
+	return result
+}
@@ -0,0 +1,121 @@
+package DragonBlood_test
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+
+	db "github.com/mawicks/DragonBlood"
+)
+
+func TestPartialDependenceGrid(test *testing.T) {
+	x := db.NewNumericFeature(nil)
+	for i := 0; i < 101; i++ {
+		x.Add(float64(100 - i))
+	}
+	x.Add(math.NaN())
+	grid := db.PartialDependenceGrid(x, 5)
+	want := []float64{0, 25, 50, 75, 100}
+	if len(grid) != len(want) {
+		test.Fatalf("Grid is %v; expected %v", grid, want)
+	}
+	for k := range want {
+		if grid[k] != want[k] {
+			test.Errorf("Grid is %v; expected %v", grid, want)
+			break
+		}
+	}
+
+	if grid := db.PartialDependenceGrid(x, 1000); len(grid) != 101 {
+		test.Errorf("Grid of 101 distinct values has %d points", len(grid))
+	}
+
+	c := db.NewCategoricalFeature(db.NewStringTable())
+	c.AddFromString("a", "b", "a", "c")
+	if grid := db.PartialDependenceGrid(c, 2); len(grid) != 3 || grid[0] != 0 || grid[2] != 2 {
+		test.Errorf("Grid of categorical feature is %v; expected [0 1 2]", grid)
+	}
+
+	for _, n := range []int{-1, 0, 1} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					test.Errorf("PartialDependenceGrid(x, %d) didn't panic", n)
+				}
+			}()
+			db.PartialDependenceGrid(x, n)
+		}()
+	}
+}
+
+func TestPartialDependenceOfProduct(test *testing.T) {
+	x1, x2, t := binaryFeatures(func(x1, x2 float64) float64 { return 4 * x1 * x2 })
+	features := []db.Feature{x1, x2}
+	dt := db.NewDecisionTreeRegressor()
+	dt.Fit([]db.OrderedFeature{x1, x2}, t)
+	gb := db.NewGradientBoostingRegressor(20, db.WithSeed(1))
+	gb.Fit([]db.OrderedFeature{x1, x2}, t)
+
+	grid := []float64{0, 1}
+	for _, model := range []db.Predictor{dt, gb} {
+		// The training units are a full factorial design, so
+		// traversing the trees averages over the same values of
+		// the other feature as evaluating every unit does.
+		recursion := db.PartialDependence(model, features, 0, grid)
+		bruteForce := db.PartialDependence(db.PredictorFunc(model.Predict), features, 0, grid)
+		for k := range grid {
+			if math.Abs(recursion[k]-bruteForce[k]) > 1e-9 {
+				test.Errorf("%T: traversal gives %v; brute force gives %v", model, recursion, bruteForce)
+				break
+			}
+		}
+	}
+
+	pd := db.PartialDependence(dt, features, 0, grid)
+	if pd[0] != 0 || pd[1] != 2 {
+		test.Errorf("Partial dependence is %v; expected [0 2]", pd)
+	}
+	pd2 := db.PartialDependence2D(dt, features, [2]int{1, 0}, [2][]float64{grid, grid})
+	if pd2[0][0] != 0 || pd2[0][1] != 0 || pd2[1][0] != 0 || pd2[1][1] != 4 {
+		test.Errorf("Two-way partial dependence is %v; expected [[0 0] [0 4]]", pd2)
+	}
+}
+
+func TestICE(test *testing.T) {
+	rng := rand.New(rand.NewSource(5))
+	x, t := importanceData(200, rng)
+	features := []db.Feature{x[0], x[1], x[2]}
+	rf := db.NewRandomForestRegressor(10, db.WithSeed(1))
+	rf.Fit([]db.OrderedFeature{x[0], x[1], x[2]}, t)
+
+	grid := db.PartialDependenceGrid(x[0], 10)
+	ice := db.ICE(rf, features, 0, grid)
+	pd := db.PartialDependence(db.PredictorFunc(rf.Predict), features, 0, grid)
+	for k := range grid {
+		mean := 0.0
+		for i := range ice {
+			mean += ice[i][k] / float64(len(ice))
+		}
+		if math.Abs(mean-pd[k]) > 1e-9 {
+			test.Errorf("Mean of ICE curves at %v is %v; partial dependence is %v", grid[k], mean, pd[k])
+		}
+	}
+	if !(pd[len(pd)-1]-pd[0] > 2) {
+		test.Errorf("Partial dependence %v does not increase with the feature", pd)
+	}
+
+	// The surface of the first unit at its own values is its prediction.
+	grids := [2][]float64{{x[1].NumericValue(0)}, {0, x[2].NumericValue(0)}}
+	ice2 := db.ICE2D(rf, features, [2]int{1, 2}, grids)
+	if prediction := rf.Predict(features)[0]; ice2[0][0][1] != prediction {
+		test.Errorf("ICE surface of unit 0 at its own values is %v; prediction is %v", ice2[0][0][1], prediction)
+	}
+
+	recursion := db.PartialDependence(rf, features, 0, grid)
+	for k := range grid {
+		if math.Abs(recursion[k]-pd[k]) > 0.3 {
+			test.Errorf("Traversal gives %v; brute force gives %v", recursion, pd)
+			break
+		}
+	}
+}
@@ -0,0 +1,294 @@
+package DragonBlood
+
+import (
+	"fmt"
+	"math"
+	"sort"
+)
+
+// The proximity of two units is the fraction of the trees of a forest
+// in which they reach the same leaf (Breiman 2001).  Proximities are
+// computed from the leaves reached by the given units, whether or not
+// they were in the bag of each tree.
+
+// leafMembers records the leaf reached by each unit in each tree, and
+// the units that reach each leaf.
+type leafMembers struct {
+	leaves  [][]int         // leaves[i][t] is the leaf reached by unit i in tree t
+	members []map[int][]int // members[t][leaf] are the units reaching leaf of tree t
+	nTrees  int             // number of trees that were grown
+}
+
+func (rf *randomForest) leafMembers(features []Feature) *leafMembers {
+	lm := &leafMembers{leaves: rf.Apply(features), members: make([]map[int][]int, len(rf.trees))}
+	for t, tree := range rf.trees {
+		if tree == nil {
+			continue
+		}
+		lm.nTrees++
+		lm.members[t] = make(map[int][]int)
+		for i, leaves := range lm.leaves {
+			lm.members[t][leaves[t]] = append(lm.members[t][leaves[t]], i)
+		}
+	}
+	return lm
+}
+
+// row returns the nonzero proximities of unit i, indexed by unit.
+func (lm *leafMembers) row(i int) map[int]float64 {
+	row := make(map[int]float64)
+	for t, members := range lm.members {
+		if members != nil {
+			for _, j := range members[lm.leaves[i][t]] {
+				row[j]++
+			}
+		}
+	}
+	for j := range row {
+		row[j] /= float64(lm.nTrees)
+	}
+	return row
+}
+
+// Proximity returns the proximity of every pair of units of features,
+// as an n by n matrix.  Its size grows with the square of the number
+// of units; see ProximityNeighbors for large data.
+func (rf *randomForest) Proximity(features []Feature) [][]float64 {
+	lm := rf.leafMembers(features)
+	result := make([][]float64, features[0].Len())
+	rf.parallelRange(len(result), func(start, end int) {
+		for i := start; i < end; i++ {
+			result[i] = make([]float64, len(result))
+			for j, p := range lm.row(i) {
+				result[i][j] = p
+			}
+		}
+	})
+	return result
+}
+
+// Neighbor is a unit and its proximity to another unit.
+type Neighbor struct {
+	Index     int
+	Proximity float64
+}
+
+// ProximityNeighbors returns, for each unit of features, the (at most)
+// k other units with the largest proximities to it, in decreasing
+// order of proximity.  Units with zero proximity are omitted.  Unlike
+// Proximity, it uses memory proportional to the number of units.  It
+// panics if k is negative.
+func (rf *randomForest) ProximityNeighbors(features []Feature, k int) [][]Neighbor {
+	if k < 0 {
+		panic(fmt.Sprintf("ProximityNeighbors requires a non-negative number of neighbors (%d requested)", k))
+	}
+	lm := rf.leafMembers(features)
+	result := make([][]Neighbor, features[0].Len())
+	rf.parallelRange(len(result), func(start, end int) {
+		for i := start; i < end; i++ {
+			var neighbors []Neighbor
+			for j, p := range lm.row(i) {
+				if j != i {
+					neighbors = append(neighbors, Neighbor{j, p})
+				}
+			}
+			sort.Slice(neighbors, func(a, b int) bool {
+				if neighbors[a].Proximity != neighbors[b].Proximity {
+					return neighbors[a].Proximity > neighbors[b].Proximity
+				}
+				return neighbors[a].Index < neighbors[b].Index
+			})
+			if len(neighbors) > k {
+				neighbors = neighbors[:k]
+			}
+			result[i] = neighbors
+		}
+	})
+	return result
+}
+
+// median returns the (lower) median of x.
+func median(x []float64) float64 {
+	w := make([]float64, len(x))
+	for i := range w {
+		w[i] = 1
+	}
+	return weightedQuantile(x, w, 0.5)
+}
+
+// outlierScores returns the outlier score of each unit of features
+// relative to the units of the same group (Breiman 2001).  The raw
+// score of a unit is the size of its group divided by the sum of its
+// squared proximities to the other units of the group (or the size of
+// the group if they are all zero).  Raw scores are standardized within
+// each group by subtracting their median and dividing by their median
+// absolute deviation (if it is nonzero).
+func (rf *randomForest) outlierScores(features []Feature, group func(i int) int) []float64 {
+	lm := rf.leafMembers(features)
+	n := features[0].Len()
+	groupSize := make(map[int]int)
+	for i := 0; i < n; i++ {
+		groupSize[group(i)]++
+	}
+
+	result := make([]float64, n)
+	rf.parallelRange(n, func(start, end int) {
+		for i := start; i < end; i++ {
+			total := 0.0
+			for j, p := range lm.row(i) {
+				if j != i && group(j) == group(i) {
+					total += p * p
+				}
+			}
+			if total == 0 {
+				total = 1
+			}
+			result[i] = float64(groupSize[group(i)]) / total
+		}
+	})
+
+	for g := range groupSize {
+		var raw []float64
+		for i := range result {
+			if group(i) == g {
+				raw = append(raw, result[i])
+			}
+		}
+		center := median(raw)
+		deviations := make([]float64, len(raw))
+		for k, r := range raw {
+			deviations[k] = math.Abs(r - center)
+		}
+		scale := median(deviations)
+		if scale == 0 {
+			scale = 1
+		}
+		for i := range result {
+			if group(i) == g {
+				result[i] = (result[i] - center) / scale
+			}
+		}
+	}
+	return result
+}
+
+// OutlierScores returns the outlier score of each unit of features.
+// Units with large scores have small proximities to the other units.
+// See Proximity.
+func (rf *RandomForestRegressor) OutlierScores(features []Feature) []float64 {
+	return rf.outlierScores(features, func(int) int { return 0 })
+}
+
+// OutlierScores returns the outlier score of each unit of features
+// relative to the other units of its class in target.  Units with
+// large scores have small proximities to the other units of their
+// class.  See Proximity.
+func (rf *RandomForestClassifier) OutlierScores(features []Feature, target *CategoricalFeature) []float64 {
+	return rf.outlierScores(features, func(i int) int { return int(target.NumericValue(i)) })
+}
+
+// impute fills the missing values of the numeric features by
+// proximity-weighted averages (Breiman 2001), calling fit to train
+// the forest on the current values.  Missing values are first filled
+// with the median of the present values of their feature.  Each
+// iteration trains the forest and replaces each missing value with
+// the mean of the present values of its feature, weighted by their
+// units' proximities to the unit.  The trees grown by each iteration
+// replace those of the previous one.
+func (rf *randomForest) impute(features []OrderedFeature, iterations int, fit func(features []OrderedFeature)) []OrderedFeature {
+	if iterations < 1 {
+		panic(fmt.Sprintf("imputation requires at least one iteration (%d requested)", iterations))
+	}
+
+	n := features[0].Len()
+	result := make([]OrderedFeature, len(features))
+	copy(result, features)
+	missing := make(map[int][]int) // missing[j] are the units missing feature j
+	values := make(map[int][]float64)
+	for j, f := range features {
+		if _, ok := f.(*CategoricalFeature); ok {
+			continue
+		}
+		var present []float64
+		for i := 0; i < n; i++ {
+			if x := f.NumericValue(i); math.IsNaN(x) {
+				missing[j] = append(missing[j], i)
+			} else {
+				present = append(present, x)
+			}
+		}
+		if missing[j] == nil || present == nil {
+			continue
+		}
+		values[j] = featureValues(f)
+		fill := median(present)
+		for _, i := range missing[j] {
+			values[j][i] = fill
+		}
+	}
+	if len(values) == 0 {
+		return result
+	}
+
+	for iteration := 0; iteration < iterations; iteration++ {
+		for j, v := range values {
+			result[j] = NewNumericFeature(append([]float64(nil), v...))
+		}
+
+		fit(result)
+
+		unordered := make([]Feature, len(result))
+		for j, f := range result {
+			unordered[j] = f
+		}
+		lm := rf.leafMembers(unordered)
+		rf.parallelRange(n, func(start, end int) {
+			for i := start; i < end; i++ {
+				var row map[int]float64
+				for j, units := range missing {
+					if values[j] == nil {
+						continue
+					}
+					k := sort.SearchInts(units, i)
+					if k == len(units) || units[k] != i {
+						continue
+					}
+					if row == nil {
+						row = lm.row(i)
+					}
+					total, weight := 0.0, 0.0
+					for other, p := range row {
+						if x := features[j].NumericValue(other); !math.IsNaN(x) {
+							total += p * x
+							weight += p
+						}
+					}
+					if weight > 0 {
+						values[j][i] = total / weight
+					}
+				}
+			}
+		})
+	}
+
+	for j, v := range values {
+		result[j] = NewNumericFeature(v)
+	}
+	return result
+}
+
+// Impute returns features with the missing values of numeric features
+// filled by proximity-weighted averages over iterations iterations of
+// training the forest on target, leaving the forest as trained by the
+// last iteration.  Features with missing values are replaced by new
+// NumericFeatures; other features are returned unchanged.
+func (rf *RandomForestRegressor) Impute(features []OrderedFeature, target Feature, iterations int) []OrderedFeature {
+	return rf.impute(features, iterations, func(features []OrderedFeature) { rf.Fit(features, target) })
+}
+
+// Impute returns features with the missing values of numeric features
+// filled by proximity-weighted averages.  See
+// RandomForestRegressor.Impute.
+func (rf *RandomForestClassifier) Impute(features []OrderedFeature, target *CategoricalFeature, iterations int) []OrderedFeature {
+	return rf.impute(features, iterations, func(features []OrderedFeature) { rf.Fit(features, target) })
+}
@@ -0,0 +1,137 @@
+package DragonBlood_test
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+
+	db "github.com/mawicks/DragonBlood"
+)
+
+// clusters returns units in two well separated clusters of a single
+// feature, with a target equal to the feature, and one unit between
+// them.
+func clusters(rng *rand.Rand) (*db.NumericFeature, *db.NumericFeature) {
+	x := db.NewNumericFeature(nil)
+	for i := 0; i < 40; i++ {
+		x.Add(float64(10*(i%2)) + rng.Float64())
+	}
+	x.Add(5.0)
+	return x, x
+}
+
+func TestProximity(test *testing.T) {
+	x, t := clusters(rand.New(rand.NewSource(1)))
+	rf := db.NewRandomForestRegressor(50, db.WithSeed(1), db.WithMinLeafSize(4))
+	rf.Fit([]db.OrderedFeature{x}, t)
+	features := []db.Feature{x}
+
+	proximity := rf.Proximity(features)
+	for i := range proximity {
+		if proximity[i][i] != 1 {
+			test.Errorf("Proximity of unit %d to itself is %v", i, proximity[i][i])
+		}
+		for j := range proximity {
+			if proximity[i][j] != proximity[j][i] {
+				test.Errorf("Proximities of %d and %d differ", i, j)
+			}
+		}
+	}
+	// Units 0 and 2 are in the same cluster, units 0 and 1 are not.
+	if !(proximity[0][2] > proximity[0][1]) {
+		test.Errorf("Proximity within a cluster %v is not greater than across clusters %v", proximity[0][2], proximity[0][1])
+	}
+
+	neighbors := rf.ProximityNeighbors(features, 5)
+	for i, n := range neighbors {
+		if len(n) != 5 {
+			test.Fatalf("Unit %d has %d neighbors; expected 5", i, len(n))
+		}
+		for k, neighbor := range n {
+			if neighbor.Index == i || neighbor.Proximity != proximity[i][neighbor.Index] || (k > 0 && neighbor.Proximity > n[k-1].Proximity) {
+				test.Errorf("Unit %d has neighbors %v", i, n)
+				break
+			}
+		}
+	}
+
+	// Standardized scores have median zero.
+	scores := rf.OutlierScores(features)
+	above := 0
+	for _, s := range scores {
+		if s > 0 {
+			above++
+		}
+	}
+	if above > len(scores)/2 {
+		test.Errorf("%d of %d outlier scores are positive", above, len(scores))
+	}
+
+	defer func() {
+		if recover() == nil {
+			test.Errorf("ProximityNeighbors(-1) didn't panic")
+		}
+	}()
+	rf.ProximityNeighbors(features, -1)
+}
+
+func TestImpute(test *testing.T) {
+	rng := rand.New(rand.NewSource(2))
+	x := db.NewNumericFeature(nil)
+	y := db.NewNumericFeature(nil)
+	t := db.NewNumericFeature(nil)
+	var missing []int
+	for i := 0; i < 200; i++ {
+		xi := float64(10 * (i % 2))
+		t.Add(xi + rng.Float64())
+		y.Add(xi + rng.Float64())
+		if i%10 < 2 {
+			missing = append(missing, i)
+			x.Add(math.NaN())
+		} else {
+			x.Add(xi)
+		}
+	}
+
+	rf := db.NewRandomForestRegressor(20, db.WithSeed(3), db.WithMinLeafSize(5))
+	imputed := rf.Impute([]db.OrderedFeature{x, y}, t, 3)
+	if imputed[1] != y {
+		test.Errorf("Feature without missing values was replaced")
+	}
+	for _, i := range missing {
+		want := float64(10 * (i % 2))
+		if got := imputed[0].NumericValue(i); math.Abs(got-want) > 2 {
+			test.Errorf("Unit %d: imputed %v; expected about %v", i, got, want)
+		}
+	}
+	if !math.IsNaN(x.NumericValue(missing[0])) {
+		test.Errorf("Impute modified its argument")
+	}
+	if n := len(rf.Apply([]db.Feature{imputed[0], y})[0]); n != 20 {
+		test.Errorf("Forest has %d trees after imputation; expected 20", n)
+	}
+}
+
+func TestClassifierOutlierScores(test *testing.T) {
+	x := db.NewNumericFeature(nil)
+	class := db.NewCategoricalFeature(db.NewStringTable())
+	for i := 0; i < 30; i++ {
+		x.Add(float64(i % 3))
+		class.AddFromString("a")
+		x.Add(float64(10 + i%3))
+		class.AddFromString("b")
+	}
+	// A unit labeled "a" among those labeled "b".
+	x.Add(11.0)
+	class.AddFromString("a")
+
+	rf := db.NewRandomForestClassifier(30, db.Gini, db.WithSeed(4))
+	rf.Fit([]db.OrderedFeature{x}, class)
+	scores := rf.OutlierScores([]db.Feature{x}, class)
+	mislabeled := x.Len() - 1
+	for i, s := range scores {
+		if i != mislabeled && s >= scores[mislabeled] {
+			test.Errorf("Unit %d has outlier score %v; the mislabeled unit has %v", i, s, scores[mislabeled])
+		}
+	}
+}
@@ -0,0 +1,241 @@
+package DragonBlood
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+)
+
+// Minimal cost-complexity pruning (Breiman et al. 1984) trades the
+// loss of a tree against its number of leaves.  A tree pruned at
+// alpha minimizes R(T) + alpha*|leaves(T)|, where R is the total
+// size-weighted impurity of its leaves (in the units of the split
+// reductions, e.g., the sum of squared errors) divided by the weight
+// of the root, as in CART's R(t)/N.  Dividing by the weight makes
+// alphas comparable between trees grown on different numbers of units,
+// such as those grown for cross validation.  Collapsing an interior
+// node t increases R by the sum of the reductions of the splits below
+// t, so the effective alpha of t is that sum divided by the number of
+// leaves removed.  Weakest-link pruning repeatedly collapses the node
+// with the smallest effective alpha.
+
+// pruningSequence applies weakest-link pruning to the tree below root
+// without modifying it.  It returns the alpha at which each interior
+// node is collapsed (directly or with an ancestor), and the
+// non-decreasing alphas at which the successive collapses occur along
+// with R of each resulting tree.  The first entry of alphas is zero
+// and the first entry of impurities is R of the unpruned tree.
+func pruningSequence(root *DecisionTreeNode) (nodeAlphas map[*DecisionTreeNode]float64, alphas, impurities []float64) {
+	nodeAlphas = make(map[*DecisionTreeNode]float64)
+	alphas = []float64{0}
+
+	var weakest *DecisionTreeNode
+	var weakestAlpha float64
+
+	scale := 1.0
+	if root.weight > 0 {
+		scale = 1 / root.weight
+	}
+
+	// evaluate returns the increase in R from collapsing n, the
+	// number of leaves below n, and their contribution to R,
+	// recording the weakest link.
+	var evaluate func(n *DecisionTreeNode) (float64, int, float64)
+	evaluate = func(n *DecisionTreeNode) (float64, int, float64) {
+		if _, collapsed := nodeAlphas[n]; n.feature < 0 || collapsed {
+			return 0, 1, scale * n.impurity
+		}
+		leftIncrease, leftLeaves, leftImpurity := evaluate(n.Left)
+		rightIncrease, rightLeaves, rightImpurity := evaluate(n.Right)
+		increase, leaves := scale*n.reduction+leftIncrease+rightIncrease, leftLeaves+rightLeaves
+		if alpha := increase / float64(leaves-1); weakest == nil || alpha < weakestAlpha {
+			weakest, weakestAlpha = n, alpha
+		}
+		return increase, leaves, leftImpurity + rightImpurity
+	}
+
+	var collapse func(n *DecisionTreeNode, alpha float64)
+	collapse = func(n *DecisionTreeNode, alpha float64) {
+		if _, collapsed := nodeAlphas[n]; n.feature >= 0 && !collapsed {
+			nodeAlphas[n] = alpha
+			collapse(n.Left, alpha)
+			collapse(n.Right, alpha)
+		}
+	}
+
+	for {
+		weakest = nil
+		_, _, impurity := evaluate(root)
+		impurities = append(impurities, impurity)
+		if weakest == nil {
+			break
+		}
+		alpha := math.Max(weakestAlpha, alphas[len(alphas)-1])
+		collapse(weakest, alpha)
+		alphas = append(alphas, alpha)
+	}
+	return nodeAlphas, alphas, impurities
+}
+
+// CostComplexityPath returns the effective alphas at which successive
+// subtrees are pruned by minimal cost-complexity pruning, in
+// increasing order, and R of each pruned tree: the total
+// size-weighted impurity of its leaves divided by the weight of the
+// root, on the same scale as the alphas.  The first entries describe
+// the unpruned tree, whose alpha is zero, and the last the root
+// alone.  Pruning with any alpha between alphas[k] and alphas[k+1]
+// gives the kth tree.  Impurities are NaN for trees grown with a
+// custom SplitCriterion, which doesn't report the impurities of
+// nodes.
+func (dtr *DecisionTree) CostComplexityPath() (alphas, impurities []float64) {
+	_, alphas, impurities = pruningSequence(dtr.root)
+	return alphas, impurities
+}
+
+// Prune collapses the subtrees that minimal cost-complexity pruning
+// removes at the given alpha.  Prune(0) removes only splits that
+// don't reduce the loss.
+func (dtr *DecisionTree) Prune(alpha float64) {
+	nodeAlphas, _, _ := pruningSequence(dtr.root)
+	dtr.root.prune(nodeAlphas, alpha)
+}
+
+// prune collapses each node below n whose alpha in nodeAlphas is at
+// most alpha.
+func (n *DecisionTreeNode) prune(nodeAlphas map[*DecisionTreeNode]float64, alpha float64) {
+	if n.feature < 0 {
+		return
+	}
+	if nodeAlpha, ok := nodeAlphas[n]; !ok || nodeAlpha > alpha {
+		n.Left.prune(nodeAlphas, alpha)
+		n.Right.prune(nodeAlphas, alpha)
+		return
+	}
+
+	// Retained leaf targets move to the new leaf
+	for _, child := range []*DecisionTreeNode{n.Left, n.Right} {
+		child.prune(nodeAlphas, math.Inf(1))
+		n.targets = append(n.targets, child.targets...)
+		n.targetWeights = append(n.targetWeights, child.targetWeights...)
+	}
+
+	n.feature = -1
+	n.Left, n.Right = nil, nil
+	n.splitter = nil
+	n.reduction = 0
+	n.missingLeft = false
+	n.surrogates = nil
+}
+
+// prunedLeaf returns the leaf reached by unit i of features in the
+// tree below n pruned at alpha, where nodeAlphas is as returned by
+// pruningSequence().
+func (n *DecisionTreeNode) prunedLeaf(features []Feature, i int, nodeAlphas map[*DecisionTreeNode]float64, alpha float64) *DecisionTreeNode {
+	node := n
+	for node.feature >= 0 {
+		if nodeAlpha, ok := nodeAlphas[node]; ok && nodeAlpha <= alpha {
+			break
+		}
+		if node.splitLeft(features, i) {
+			node = node.Left
+		} else {
+			node = node.Right
+		}
+	}
+	return node
+}
+
+// fitPruned trains the tree on all units and prunes it at the alpha
+// that minimizes the loss of folds-fold cross validation, which it
+// returns.  loss returns the loss of predicting unit i with leaf.
+//
+// The candidate alphas are the geometric means of successive alphas of
+// the cost-complexity path of the tree (Breiman et al. 1984).  For
+// each fold, a tree is grown on the other folds and its loss on the
+// fold is evaluated for each candidate.  Ties favor the larger alpha.
+func (dtr *DecisionTree) fitPruned(features []OrderedFeature, target Feature, folds int, loss func(leaf *DecisionTreeNode, i int) float64) float64 {
+	if folds < 2 {
+		panic(fmt.Sprintf("cross validation requires at least 2 folds (%d requested)", folds))
+	}
+
+	dtr.Fit(features, target)
+
+	_, alphas, _ := pruningSequence(dtr.root)
+	candidates := make([]float64, len(alphas))
+	for k := range alphas {
+		if k+1 < len(alphas) {
+			candidates[k] = math.Sqrt(alphas[k] * alphas[k+1])
+		} else {
+			candidates[k] = alphas[k]
+		}
+	}
+
+	prepared := dtr.grower.prepare(features)
+	unorderedFeatures := make([]Feature, len(features))
+	for j, f := range features {
+		unorderedFeatures[j] = f
+	}
+
+	n := features[0].Len()
+	rng := rand.New(rand.NewSource(dtr.seed))
+	fold := make([]int, n)
+	for k, i := range rng.Perm(n) {
+		fold[i] = k % folds
+	}
+
+	cvLoss := make([]float64, len(candidates))
+	for k := 0; k < folds; k++ {
+		training := bag(make([]int, n))
+		for i := range training {
+			if fold[i] != k {
+				training[i] = 1
+			}
+		}
+		root := dtr.grower.grow(prepared, target, training, rng, k+1, nil)
+		nodeAlphas, _, _ := pruningSequence(root)
+		for i := range fold {
+			if fold[i] == k {
+				for c, alpha := range candidates {
+					cvLoss[c] += loss(root.prunedLeaf(unorderedFeatures, i, nodeAlphas, alpha), i)
+				}
+			}
+		}
+	}
+
+	best := 0
+	for c := range candidates {
+		if cvLoss[c] <= cvLoss[best] {
+			best = c
+		}
+	}
+
+	dtr.Prune(candidates[best])
+	return candidates[best]
+}
+
+// FitPruned trains the tree and prunes it by minimal cost-complexity
+// pruning at an alpha chosen by folds-fold cross validation of the
+// squared error, which it returns.  Fold assignments and the trees
+// grown for cross validation draw from the tree's seed, which
+// observers see as trees 1 through folds.
+func (dtr *DecisionTree) FitPruned(features []OrderedFeature, target Feature, folds int) float64 {
+	return dtr.fitPruned(features, target, folds, func(leaf *DecisionTreeNode, i int) float64 {
+		e := leaf.prediction - target.NumericValue(i)
+		return e * e
+	})
+}
+
+// FitPruned trains the tree and prunes it by minimal cost-complexity
+// pruning at an alpha chosen by folds-fold cross validation of the
+// misclassification rate, which it returns.  See
+// DecisionTree.FitPruned.
+func (dtc *DecisionTreeClassifier) FitPruned(features []OrderedFeature, target *CategoricalFeature, folds int) float64 {
+	dtc.classes = target.stringTable
+	dtc.nClasses = target.Categories()
+	return dtc.DecisionTree.fitPruned(features, target, folds, func(leaf *DecisionTreeNode, i int) float64 {
+		if argmax(leaf.probabilities(dtc.nClasses)) != int(target.NumericValue(i)) {
+			return 1
+		}
+		return 0
+	})
+}
@@ -0,0 +1,136 @@
+package DragonBlood_test
+
+import (
+	"bytes"
+	"math"
+	"math/rand"
+	"strings"
+	"testing"
+
+	db "github.com/mawicks/DragonBlood"
+)
+
+func countLeaves(dt *db.DecisionTree) int {
+	var dump bytes.Buffer
+	dt.Dump(&dump)
+	return strings.Count(dump.String(), "(LEAF)")
+}
+
+func TestCostComplexityPath(test *testing.T) {
+	x := db.NewNumericFeature([]float64{0, 1, 2, 3})
+	t := db.NewNumericFeature([]float64{0, 0, 10, 11})
+
+	dt := db.NewDecisionTreeRegressor()
+	dt.Fit([]db.OrderedFeature{x}, t)
+
+	// Splitting {10, 11} reduces the squared error by 0.5 and the
+	// root split reduces it by 110.25, which are divided by the 4
+	// units at the root.  The leaves of the unpruned tree are pure.
+	// Growing only the root split leaves the squared error of {10, 11}.
+	classes := db.NewCategoricalFeature(db.NewStringTable())
+	for _, class := range []string{"a", "a", "b", "a"} {
+		classes.AddFromString(class)
+	}
+	classifier := db.NewDecisionTreeClassifier(db.Gini)
+	classifier.Fit([]db.OrderedFeature{x}, classes)
+	stump := db.NewDecisionTreeRegressor(db.WithMaxDepth(1))
+	stump.Fit([]db.OrderedFeature{x}, t)
+	for _, c := range []struct {
+		name                               string
+		tree                               *db.DecisionTree
+		expectedAlphas, expectedImpurities []float64
+	}{
+		{"regressor", dt, []float64{0, 0.125, 27.5625}, []float64{0, 0.125, 27.6875}},
+		{"stump", stump, []float64{0, 27.5625}, []float64{0.125, 27.6875}},
+		// The Gini impurity of {a, a, b, a} is 4 - 10/4 = 1.5 and
+		// that of {b, a} is 1, so collapsing the root removes the
+		// most impurity per leaf.
+		{"classifier", &classifier.DecisionTree, []float64{0, 0.1875}, []float64{0, 0.375}},
+	} {
+		alphas, impurities := c.tree.CostComplexityPath()
+		if len(alphas) != len(c.expectedAlphas) || len(impurities) != len(c.expectedImpurities) {
+			test.Errorf("%s: CostComplexityPath() returned %v, %v; expected %v, %v", c.name, alphas, impurities, c.expectedAlphas, c.expectedImpurities)
+			continue
+		}
+		for k := range alphas {
+			if math.Abs(alphas[k]-c.expectedAlphas[k]) > 1e-9 || math.Abs(impurities[k]-c.expectedImpurities[k]) > 1e-9 {
+				test.Errorf("%s: step %d: alpha %v and impurity %v; expected %v and %v", c.name, k, alphas[k], impurities[k], c.expectedAlphas[k], c.expectedImpurities[k])
+			}
+		}
+	}
+	alphas, _ := dt.CostComplexityPath()
+
+	// Alphas don't depend on the number of units.
+	doubled := db.NewDecisionTreeRegressor()
+	doubled.Fit([]db.OrderedFeature{db.NewNumericFeature([]float64{0, 1, 2, 3, 0, 1, 2, 3})}, db.NewNumericFeature([]float64{0, 0, 10, 11, 0, 0, 10, 11}))
+	if doubledAlphas, _ := doubled.CostComplexityPath(); len(doubledAlphas) != len(alphas) || math.Abs(doubledAlphas[2]-alphas[2]) > 1e-9 {
+		test.Errorf("Alphas with each unit doubled are %v; expected %v", doubledAlphas, alphas)
+	}
+
+	for _, c := range []struct {
+		alpha  float64
+		leaves int
+	}{
+		{0, 3},
+		{0.1, 3},
+		{0.125, 2},
+		{25, 2},
+		{27.5625, 1},
+	} {
+		pruned := db.NewDecisionTreeRegressor()
+		pruned.Fit([]db.OrderedFeature{x}, t)
+		pruned.Prune(c.alpha)
+		if n := countLeaves(pruned); n != c.leaves {
+			test.Errorf("Prune(%v) left %d leaves; expected %d", c.alpha, n, c.leaves)
+		}
+	}
+
+	dt.Prune(0.25)
+	if p := dt.Predict([]db.Feature{x}); p[2] != 10.5 || p[3] != 10.5 {
+		test.Errorf("Pruned tree predicted %v; expected 10.5 for the last two units", p)
+	}
+}
+
+func TestFitPruned(test *testing.T) {
+	// A noisy step function
+	rng := rand.New(rand.NewSource(7))
+	x := db.NewNumericFeature(nil)
+	t := db.NewNumericFeature(nil)
+	c := db.NewCategoricalFeature(db.NewStringTable())
+	for i := 0; i < 400; i++ {
+		xi := rng.Float64()
+		x.Add(xi)
+		step := 0.0
+		if xi > 0.5 {
+			step = 5
+		}
+		t.Add(step + rng.NormFloat64())
+		if step > 0 != (rng.Intn(10) == 0) {
+			c.AddFromString("high")
+		} else {
+			c.AddFromString("low")
+		}
+	}
+
+	dt := db.NewDecisionTreeRegressor(db.WithSeed(1))
+	alpha := dt.FitPruned([]db.OrderedFeature{x}, t, 5)
+	if alpha <= 0 {
+		test.Errorf("FitPruned() chose alpha %v; expected a positive alpha", alpha)
+	}
+	if n := countLeaves(dt); n < 2 || n > 10 {
+		test.Errorf("Pruned tree has %d leaves; expected a few", n)
+	}
+	for i, p := range dt.Predict([]db.Feature{db.NewNumericFeature([]float64{0.25, 0.75})}) {
+		if expected := []float64{0, 5}[i]; math.Abs(p-expected) > 0.5 {
+			test.Errorf("Row %d: pruned tree predicted %v; expected about %v", i, p, expected)
+		}
+	}
+
+	dtc := db.NewDecisionTreeClassifier(db.Gini, db.WithSeed(1))
+	dtc.FitPruned([]db.OrderedFeature{x}, c, 5)
+	for i, p := range dtc.Predict([]db.Feature{db.NewNumericFeature([]float64{0.25, 0.75})}) {
+		if expected := []string{"low", "high"}[i]; p != expected {
+			test.Errorf("Row %d: pruned classifier predicted %v; expected %v", i, p, expected)
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package DragonBlood
+
+import "fmt"
+
+// WithLeafTargets makes each leaf retain the training targets that
+// reach it, along with their weights, which enables
+// RandomForestRegressor.PredictQuantiles.  The retained targets are
+// saved with the model, which increases the size of trained and saved
+// models.
+func WithLeafTargets() Option {
+	return func(dtg *decisionTreeGrower) { dtg.LeafTargets = true }
+}
+
+// PredictQuantiles returns, for each unit, the conditional quantiles
+// of the target at each of the given levels (each between 0 and 1),
+// as estimated by a quantile regression forest (Meinshausen 2006).
+// The training targets in the leaf the unit reaches in each tree are
+// weighted by their share of the weight of that leaf, and these
+// weights are averaged over the trees to form the conditional
+// distribution of the target.  The forest must have been trained
+// with WithLeafTargets.  Tails are estimated from the targets of the
+// leaves, so leaves should be large enough (see WithMinLeafSize) to
+// hold a sample of the conditional distribution.
+func (rf *RandomForestRegressor) PredictQuantiles(features []Feature, quantiles []float64) [][]float64 {
+	for _, alpha := range quantiles {
+		if !(alpha >= 0 && alpha <= 1) {
+			panic(fmt.Sprintf("quantile level %v is not between 0 and 1", alpha))
+		}
+	}
+	for _, tree := range rf.trees {
+		if tree != nil && !tree.hasLeafTargets() {
+			panic("PredictQuantiles() called on a forest trained without WithLeafTargets()")
+		}
+	}
+
+	result := make([][]float64, features[0].Len())
+	rf.parallelRange(len(result), func(start, end int) {
+		var targets, weights []float64
+		for i := start; i < end; i++ {
+			targets, weights = targets[:0], weights[:0]
+			for _, tree := range rf.trees {
+				if tree == nil {
+					continue
+				}
+				leaf := tree.leaf(features, i)
+				total := sum(leaf.targetWeights)
+				if !(total > 0) {
+					continue
+				}
+				for k, t := range leaf.targets {
+					targets = append(targets, t)
+					weights = append(weights, leaf.targetWeights[k]/total)
+				}
+			}
+			result[i] = weightedQuantiles(targets, weights, quantiles)
+		}
+	})
+	return result
+}
+
+// PredictInterval returns, for each unit, the bounds of a central
+// prediction interval covering the given fraction of the conditional
+// distribution of the target.  For example, a coverage of 0.9 gives
+// the 0.05 and 0.95 quantiles.  See PredictQuantiles.
+func (rf *RandomForestRegressor) PredictInterval(features []Feature, coverage float64) (lower, upper []float64) {
+	if !(coverage >= 0 && coverage <= 1) {
+		panic(fmt.Sprintf("coverage %v is not between 0 and 1", coverage))
+	}
+
+	quantiles := rf.PredictQuantiles(features, []float64{0.5 * (1 - coverage), 0.5 * (1 + coverage)})
+	lower = make([]float64, len(quantiles))
+	upper = make([]float64, len(quantiles))
+	for i, q := range quantiles {
+		lower[i], upper[i] = q[0], q[1]
+	}
+	return lower, upper
+}
+
+// hasLeafTargets returns true if every non-empty leaf below n retains
+// its training targets.
+func (n *DecisionTreeNode) hasLeafTargets() bool {
+	if n.feature < 0 {
+		return n.size == 0 || n.targetWeights != nil
+	}
+	return n.Left.hasLeafTargets() && n.Right.hasLeafTargets()
+}
@@ -0,0 +1,77 @@
+package DragonBlood_test
+
+import (
+	"bytes"
+	"math/rand"
+	"testing"
+
+	db "github.com/mawicks/DragonBlood"
+)
+
+func TestRandomForestQuantiles(test *testing.T) {
+	// The spread of the target is ten times larger for x >= 0.5
+	rng := rand.New(rand.NewSource(5))
+	x := db.NewNumericFeature(nil)
+	t := db.NewNumericFeature(nil)
+	for i := 0; i < 1000; i++ {
+		xi := rng.Float64()
+		x.Add(xi)
+		if xi < 0.5 {
+			t.Add(rng.Float64())
+		} else {
+			t.Add(10 * rng.Float64())
+		}
+	}
+
+	rf := db.NewRandomForestRegressor(50, db.WithLeafTargets(), db.WithMinLeafSize(100), db.WithSeed(1))
+	rf.Fit([]db.OrderedFeature{x}, t)
+
+	newX := db.NewNumericFeature([]float64{0.25, 0.75})
+	quantiles := rf.PredictQuantiles([]db.Feature{newX}, []float64{0.05, 0.5, 0.95})
+	for i, q := range quantiles {
+		if !(q[0] <= q[1] && q[1] <= q[2]) {
+			test.Errorf("Row %d: quantiles %v are not ordered", i, q)
+		}
+	}
+	for i, expected := range [][]float64{{0.05, 0.5, 0.95}, {0.5, 5, 9.5}} {
+		for k, q := range quantiles[i] {
+			if q < 0.7*expected[k]-0.05 || q > 1.3*expected[k]+0.05 {
+				test.Errorf("Row %d: quantile %d is %v; expected about %v", i, k, q, expected[k])
+			}
+		}
+	}
+
+	lower, upper := rf.PredictInterval([]db.Feature{newX}, 0.9)
+	for i := range lower {
+		if lower[i] != quantiles[i][0] || upper[i] != quantiles[i][2] {
+			test.Errorf("Row %d: interval [%v, %v]; expected [%v, %v]", i, lower[i], upper[i], quantiles[i][0], quantiles[i][2])
+		}
+	}
+
+	// Saved forests retain their leaf targets
+	var buffer bytes.Buffer
+	if err := rf.Save(&buffer); err != nil {
+		test.Fatalf("Save returned %v", err)
+	}
+	loaded := db.NewRandomForestRegressor(0)
+	if err := loaded.Load(&buffer); err != nil {
+		test.Fatalf("Load returned %v", err)
+	}
+	for i, q := range loaded.PredictQuantiles([]db.Feature{newX}, []float64{0.05, 0.5, 0.95}) {
+		for k := range q {
+			if q[k] != quantiles[i][k] {
+				test.Errorf("Row %d: loaded forest predicted quantiles %v; expected %v", i, q, quantiles[i])
+				break
+			}
+		}
+	}
+
+	defer func() {
+		if recover() == nil {
+			test.Errorf("PredictQuantiles() didn't panic without leaf targets")
+		}
+	}()
+	plain := db.NewRandomForestRegressor(5)
+	plain.Fit([]db.OrderedFeature{x}, t)
+	plain.PredictQuantiles([]db.Feature{newX}, []float64{0.5})
+}
@@ -2,71 +2,219 @@ package DragonBlood
 
 import (
 	"fmt"
-	"log"
+	"math/rand"
+	"runtime"
+	"sync"
 
 	"github.com/mawicks/DragonBlood/stats"
 )
 
-type RandomForestRegressor struct {
+// randomForest holds the trees and the grower shared by the random
+// forest regressor and classifier.
+type randomForest struct {
 	nTrees    int
 	trees     []*DecisionTreeNode
 	nFeatures int
 	grower    *decisionTreeGrower
+	featureSchema
+
+	// seed is the seed with which the forest was trained.
+	seed int64
+
+	// bootstrap is true if the trees were grown on bootstrap samples.
+	bootstrap bool
 }
 
-func NewRandomForestRegressor(nTrees int) *RandomForestRegressor {
-	return &RandomForestRegressor{
+func newRandomForest(nTrees int, grower *decisionTreeGrower) randomForest {
+	return randomForest{
 		nTrees,
 		make([]*DecisionTreeNode, 0, nTrees),
 		0,
-		&decisionTreeGrower{MaxFeatures: 10, MinLeafSize: 1},
+		grower,
+		featureSchema{},
+		0,
+		false,
 	}
 }
 
-func (rf *RandomForestRegressor) Fit(features []OrderedFeature, target Feature) []float64 {
+// WithNumJobs sets the number of trees a forest grows concurrently
+// and the number of goroutines its predictions use (default 1).  A
+// value less than 1 uses runtime.GOMAXPROCS(0).  Each tree draws from
+// its own random source, so the trained forest doesn't depend on the
+// number of jobs.  WithNumJobs has no effect on a single tree.
+func WithNumJobs(n int) Option {
+	return func(dtg *decisionTreeGrower) { dtg.NumJobs = n }
+}
+
+// numJobs returns the number of goroutines configured by WithNumJobs.
+func (dtg *decisionTreeGrower) numJobs() int {
+	if dtg.NumJobs >= 1 {
+		return dtg.NumJobs
+	}
+	return runtime.GOMAXPROCS(0)
+}
+
+func (rf *randomForest) numJobs() int { return rf.grower.numJobs() }
+
+// oobVisit records the leaf reached by out-of-bag unit i.
+type oobVisit struct {
+	i    int
+	leaf *DecisionTreeNode
+}
+
+// grownTree is a tree grown by a worker in fit().
+type grownTree struct {
+	index int
+	root  *DecisionTreeNode
+	oob   []oobVisit
+}
+
+// fit grows nTrees trees, each on its own bootstrap sample (or on
+// every unit if the grower doesn't bootstrap), which replace the trees
+// grown by any earlier call.  Each occurrence of unit i in a sample
+// has weight weights[i] (unit weight if weights is nil).  visitOOB is
+// called for each out-of-bag unit of each tree once the unit reaches
+// its leaf in that tree.
+//
+// Trees are grown by numJobs() workers, but visitOOB is called only
+// from the calling goroutine, for one tree at a time, in the order of
+// the trees.
+func (rf *randomForest) fit(features []OrderedFeature, target Feature, weights []float64, visitOOB func(i int, leaf *DecisionTreeNode)) {
 	rf.nFeatures = len(features)
+	rf.featureSchema = newFeatureSchema(features)
 
-	oobPrediction := make([]stats.Accumulator, features[0].Len())
-	for i := range oobPrediction {
-		oobPrediction[i] = stats.NewMeanAccumulator()
+	features = rf.grower.prepare(features)
+
+	rf.seed = rf.grower.seed()
+	rf.bootstrap = rf.grower.Bootstrap
+	seeds := rf.treeSeeds()
+
+	indexes := make(chan int)
+	grown := make(chan grownTree)
+	var workers sync.WaitGroup
+	for w := 0; w < rf.numJobs(); w++ {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			for t := range indexes {
+				rng, bag := rf.treeBag(seeds[t], features[0].Len())
+				if weights != nil {
+					bag = NewWeightedBag(bag, weights)
+				}
+				var oob []oobVisit
+				visit := func(i int, leaf *DecisionTreeNode) {
+					if bag.Count(i) == 0 {
+						oob = append(oob, oobVisit{i, leaf})
+					}
+				}
+				root := rf.grower.grow(features, target, bag, rng, t, visit)
+				grown <- grownTree{t, root, oob}
+			}
+		}()
 	}
+	go func() {
+		for t := range seeds {
+			indexes <- t
+		}
+		close(indexes)
+		workers.Wait()
+		close(grown)
+	}()
 
-	for _, f := range features {
-		f.Prepare()
+	// Merge the trees in order, regardless of the order in which
+	// they finish, so that out-of-bag accumulation is reproducible.
+	rf.trees = make([]*DecisionTreeNode, rf.nTrees)
+	pending := make(map[int]grownTree)
+	next := 0
+	for g := range grown {
+		pending[g.index] = g
+		for g, ok := pending[next]; ok; g, ok = pending[next] {
+			delete(pending, next)
+			rf.trees[next] = g.root
+			for _, v := range g.oob {
+				visitOOB(v.i, v.leaf)
+			}
+			next++
+		}
 	}
+}
 
-	for i := 0; i < rf.nTrees; i++ {
-		bag := NewBag(features[0].Len())
-		log.Printf("bag: %v", bag)
+// treeSeeds returns the seed of each tree grown by fit(), which are
+// drawn in advance from the forest's seed so that the random stream
+// used by each tree doesn't depend on scheduling.
+func (rf *randomForest) treeSeeds() []int64 { return treeSeeds(rf.seed, rf.nTrees) }
 
-		rf.trees = append(rf.trees, rf.grower.grow(features, target, bag, oobPrediction))
+// treeSeeds returns nTrees seeds drawn from a source seeded with seed.
+func treeSeeds(seed int64, nTrees int) []int64 {
+	forestRng := rand.New(rand.NewSource(seed))
+	seeds := make([]int64, nTrees)
+	for t := range seeds {
+		seeds[t] = forestRng.Int63()
 	}
+	return seeds
+}
 
-	result := make([]float64, len(oobPrediction))
-	for i, p := range oobPrediction {
-		result[i] = p.Value()
+// treeBag returns the random source of the tree with the given seed,
+// and the sample of n units on which it was grown, which is the first
+// draw from that source.  The sample depends on whether the forest was
+// trained on bootstrap samples, not on the grower's current options.
+func (rf *randomForest) treeBag(seed int64, n int) (*rand.Rand, Bag) {
+	rng := rand.New(rand.NewSource(seed))
+	var bag Bag = FullBag(n)
+	if rf.bootstrap {
+		bag = NewBagFromSource(n, rng)
 	}
+	return rng, bag
+}
 
-	return result
+// checkOOB panics unless the forest was trained on bootstrap samples
+// of units with the given features, so that caller can redraw the
+// samples of its trees.
+func (rf *randomForest) checkOOB(caller string, features []Feature) {
+	if !rf.bootstrap {
+		panic(fmt.Sprintf("%s() called on a forest grown without bootstrap samples", caller))
+	}
+	if len(features) != rf.nFeatures {
+		panic(fmt.Sprintf("Argument mismatch: forest has %d features, but len(features)=%d", rf.nFeatures, len(features)))
+	}
+	if len(rf.trees) < rf.nTrees {
+		panic(fmt.Sprintf("%s() called on an untrained forest", caller))
+	}
 }
 
-func (rf *RandomForestRegressor) Predict(features []Feature) []float64 {
-	result := make([]float64, features[0].Len())
+// Seed returns the seed with which the forest was trained.  Training
+// again with WithSeed(Seed()) reproduces the forest.
+func (rf *randomForest) Seed() int64 { return rf.seed }
 
-	for i, tree := range rf.trees {
-		if tree != nil {
-			for j, p := range tree.Predict(features) {
-				result[j] += (p - result[j]) / float64(i+1)
-			}
-		}
+// parallelRange partitions [0, n) into contiguous ranges and calls f
+// for each range using up to numJobs() goroutines.
+func (rf *randomForest) parallelRange(n int, f func(start, end int)) {
+	parallelRange(rf.numJobs(), n, f)
+}
+
+// parallelRange partitions [0, n) into contiguous ranges and calls f
+// for each range using up to jobs goroutines.
+func parallelRange(jobs, n int, f func(start, end int)) {
+	if jobs > n {
+		jobs = n
+	}
+	if jobs <= 1 {
+		f(0, n)
+		return
 	}
 
-	return result
+	var wg sync.WaitGroup
+	for j := 0; j < jobs; j++ {
+		wg.Add(1)
+		go func(start, end int) {
+			defer wg.Done()
+			f(start, end)
+		}(j*n/jobs, (j+1)*n/jobs)
+	}
+	wg.Wait()
 }
 
-func (rf *RandomForestRegressor) Importances() []float64 {
-	fmt.Printf("Importances(): nFeatures: %d\n", rf.nFeatures)
-
+func (rf *randomForest) Importances() []float64 {
 	forestImportances := make([]float64, rf.nFeatures)
 	treeImportances := make([]float64, rf.nFeatures)
 
@@ -84,3 +232,63 @@ func (rf *RandomForestRegressor) Importances() []float64 {
 	}
 	return forestImportances
 }
+
+type RandomForestRegressor struct {
+	randomForest
+}
+
+// NewRandomForestRegressor returns a forest of nTrees regression
+// trees.  Unless configured otherwise, the trees minimize squared
+// error (MSECriterion).
+func NewRandomForestRegressor(nTrees int, options ...Option) *RandomForestRegressor {
+	return &RandomForestRegressor{
+		newRandomForest(nTrees, newDecisionTreeGrower(MSECriterion{}, options)),
+	}
+}
+
+// Fit trains the forest, replacing the trees of any earlier call, and
+// returns the out-of-bag prediction for each unit.  Units that were
+// never out of bag have NaN predictions.  See OOBReport for further
+// out-of-bag diagnostics.
+func (rf *RandomForestRegressor) Fit(features []OrderedFeature, target Feature) []float64 {
+	return rf.FitWeighted(features, target, nil)
+}
+
+// FitWeighted is like Fit but weights unit i by weights[i] when
+// growing the trees.  Leaf predictions are weighted means of their
+// in-bag targets, so the out-of-bag predictions reflect the weights.
+// A nil weights is equivalent to unit weights.
+func (rf *RandomForestRegressor) FitWeighted(features []OrderedFeature, target Feature, weights []float64) []float64 {
+	oobPrediction := make([]stats.Accumulator, features[0].Len())
+	for i := range oobPrediction {
+		oobPrediction[i] = stats.NewMeanAccumulator()
+	}
+
+	rf.fit(features, target, weights, func(i int, leaf *DecisionTreeNode) {
+		oobPrediction[i].Add(leaf.prediction)
+	})
+
+	result := make([]float64, len(oobPrediction))
+	for i, p := range oobPrediction {
+		result[i] = p.Value()
+	}
+
+	return result
+}
+
+func (rf *RandomForestRegressor) Predict(features []Feature) []float64 {
+	result := make([]float64, features[0].Len())
+
+	rf.parallelRange(len(result), func(start, end int) {
+		for i, tree := range rf.trees {
+			if tree != nil {
+				for j := start; j < end; j++ {
+					p := tree.leaf(features, j).prediction
+					result[j] += (p - result[j]) / float64(i+1)
+				}
+			}
+		}
+	})
+
+	return result
+}
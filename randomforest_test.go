@@ -2,6 +2,7 @@ package DragonBlood_test
 
 import (
 	"fmt"
+	"math"
 	"testing"
 
 	db "github.com/mawicks/DragonBlood"
@@ -46,3 +47,97 @@ func TestRandomForest(test *testing.T) {
 
 	fmt.Printf("feature importances (forest): %v\n", rf.Importances())
 }
+
+func TestRandomForestParallel(test *testing.T) {
+	x := db.NewNumericFeature(nil)
+	x.Add(0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11)
+
+	t := db.NewNumericFeature(nil)
+	t.Add(0, 0, 0, 0, 0, 0, 1, 1, 1, 1, 1, 1)
+
+	rf := db.NewRandomForestRegressor(50, db.WithNumJobs(4))
+	oob := rf.Fit([]db.OrderedFeature{x}, t)
+	if len(oob) != t.Len() {
+		test.Errorf("Fit() returned %d OOB predictions; expected %d", len(oob), t.Len())
+	}
+
+	for i, p := range rf.Predict([]db.Feature{x}) {
+		if (p < 0.5) != (t.Value(i) == 0.0) {
+			test.Errorf("Row %d: predicted %v; actual %v", i, p, t.Value(i))
+		}
+	}
+}
+
+func TestRandomForestSeed(test *testing.T) {
+	x := db.NewNumericFeature(nil)
+	x.Add(3, 1, 4, 1, 5, 9, 2, 6, 5, 3, 5, 8)
+
+	y := db.NewNumericFeature(nil)
+	y.Add(2, 7, 1, 8, 2, 8, 1, 8, 2, 8, 4, 5)
+
+	t := db.NewNumericFeature(nil)
+	t.Add(1, 4, 1, 4, 2, 1, 3, 5, 6, 2, 3, 7)
+
+	features := []db.OrderedFeature{x, y}
+
+	// The same seed gives identical forests regardless of the number of jobs
+	first := db.NewRandomForestRegressor(20, db.WithSeed(42), db.WithMaxFeatures(1))
+	firstOOB := first.Fit(features, t)
+	second := db.NewRandomForestRegressor(20, db.WithSeed(42), db.WithMaxFeatures(1), db.WithNumJobs(3))
+	secondOOB := second.Fit(features, t)
+
+	if first.Seed() != 42 || second.Seed() != 42 {
+		test.Errorf("Seed() returned %d and %d; expected 42", first.Seed(), second.Seed())
+	}
+
+	firstPrediction := first.Predict([]db.Feature{x, y})
+	secondPrediction := second.Predict([]db.Feature{x, y})
+	for i := range firstPrediction {
+		sameOOB := firstOOB[i] == secondOOB[i] || math.IsNaN(firstOOB[i]) && math.IsNaN(secondOOB[i])
+		if firstPrediction[i] != secondPrediction[i] || !sameOOB {
+			test.Errorf("Row %d: forests with the same seed differ (%v/%v and %v/%v)", i, firstPrediction[i], firstOOB[i], secondPrediction[i], secondOOB[i])
+		}
+	}
+
+	// A forest trained without a seed can be reproduced from its Seed()
+	third := db.NewRandomForestRegressor(20, db.WithMaxFeatures(1))
+	third.Fit(features, t)
+	fourth := db.NewRandomForestRegressor(20, db.WithMaxFeatures(1), db.WithSeed(third.Seed()))
+	fourth.Fit(features, t)
+	thirdPrediction := third.Predict([]db.Feature{x, y})
+	for i, p := range fourth.Predict([]db.Feature{x, y}) {
+		if p != thirdPrediction[i] {
+			test.Errorf("Row %d: forest retrained from Seed() predicted %v; expected %v", i, p, thirdPrediction[i])
+		}
+	}
+}
+
+func TestRandomForestRefit(test *testing.T) {
+	x := db.NewNumericFeature(nil)
+	x.Add(3, 1, 4, 1, 5, 9, 2, 6, 5, 3, 5, 8)
+
+	t := db.NewNumericFeature(nil)
+	t.Add(1, 4, 1, 4, 2, 1, 3, 5, 6, 2, 3, 7)
+
+	other := db.NewNumericFeature(nil)
+	other.Add(0, 0, 0, 0, 0, 0, 9, 9, 9, 9, 9, 9)
+
+	// Refitting replaces the trees, so the forest matches one trained
+	// only on the second target.
+	refit := db.NewRandomForestRegressor(10, db.WithSeed(3))
+	refit.Fit([]db.OrderedFeature{x}, other)
+	oob := refit.Fit([]db.OrderedFeature{x}, t)
+	fresh := db.NewRandomForestRegressor(10, db.WithSeed(3))
+	fresh.Fit([]db.OrderedFeature{x}, t)
+
+	expected := fresh.Predict([]db.Feature{x})
+	report := refit.OOBReport([]db.Feature{x}, t, db.MSEScorer{})
+	for i, p := range refit.Predict([]db.Feature{x}) {
+		if p != expected[i] {
+			test.Errorf("Row %d: refit forest predicted %v; expected %v", i, p, expected[i])
+		}
+		if report.Prediction[i] != oob[i] && !(math.IsNaN(oob[i]) && math.IsNaN(report.Prediction[i])) {
+			test.Errorf("Row %d: OOB report predicts %v; Fit predicted %v", i, report.Prediction[i], oob[i])
+		}
+	}
+}
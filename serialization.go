@@ -0,0 +1,599 @@
+package DragonBlood
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"reflect"
+	"sync"
+)
+
+// Trained models are saved as a single document, either as JSON
+// (SaveJSON) for inspection or in a compact binary encoding (Save).
+// Load reads either encoding.
+//
+// The JSON encoding is an object with the fields
+//
+//	format    always "DragonBlood"
+//	version   the format version (currently 1)
+//	kind      "DecisionTree", "DecisionTreeClassifier",
+//	          "RandomForestRegressor", or "RandomForestClassifier"
+//	features  for each feature, its "name" and, for categorical
+//	          features, "categorical": true and its "categories" in
+//	          code order
+//	classes   the class labels in code order (classifiers only)
+//	seed      the seed with which the model was trained
+//	bootstrap true if the trees of a forest were grown on bootstrap
+//	          samples (omitted otherwise)
+//	trees     the root node of each tree
+//
+// Each node has the fields "size", "weight", "prediction",
+// "distribution" (classifiers only), "impurity", and "feature", which
+// is -1 for a leaf.  Leaves of models trained with WithLeafTargets also have
+// "targets" and "targetWeights".  Interior nodes also have
+// "reduction", "splitter", "missingLeft", "surrogates", "left", and
+// "right".  A splitter is an object whose "type" is the name with
+// which its Go type was registered by RegisterSplitter and whose
+// "value" is the JSON encoding of the splitter.  Non-finite numbers
+// are encoded as the strings "NaN", "+Inf", and "-Inf".
+//
+// The binary encoding is the four bytes binaryMagic followed by the
+// same document encoded with encoding/gob.
+const (
+	modelFormat  = "DragonBlood"
+	modelVersion = 1
+	binaryMagic  = "\x00DBM"
+)
+
+var splitterRegistry = struct {
+	sync.RWMutex
+	types map[string]reflect.Type
+	names map[reflect.Type]string
+}{
+	types: make(map[string]reflect.Type),
+	names: make(map[reflect.Type]string),
+}
+
+// RegisterSplitter records the concrete type of value under name so
+// that trees containing splitters of that type can be saved and
+// loaded.  Splitters are encoded with encoding/json, so the type's
+// state must survive json.Marshal and json.Unmarshal.  NumericSplitter
+// and CategorySetSplitter are registered by this package.
+// RegisterSplitter panics if name or the type is already registered
+// differently.
+func RegisterSplitter(name string, value Splitter) {
+	t := reflect.TypeOf(value)
+
+	splitterRegistry.Lock()
+	defer splitterRegistry.Unlock()
+
+	if previous, ok := splitterRegistry.types[name]; ok && previous != t {
+		panic(fmt.Sprintf("RegisterSplitter: name %q already registered for %v", name, previous))
+	}
+	if previous, ok := splitterRegistry.names[t]; ok && previous != name {
+		panic(fmt.Sprintf("RegisterSplitter: type %v already registered as %q", t, previous))
+	}
+	splitterRegistry.types[name] = t
+	splitterRegistry.names[t] = name
+}
+
+func init() {
+	RegisterSplitter("numeric", NumericSplitter(0))
+	RegisterSplitter("category-set", CategorySetSplitter{})
+}
+
+// featureSchema describes the features with which a model was trained.
+type featureSchema struct {
+	names []string
+
+	// tables holds the StringTable of each categorical feature and
+	// nil for other features.
+	tables []StringTable
+}
+
+func newFeatureSchema(features []OrderedFeature) featureSchema {
+	schema := featureSchema{
+		make([]string, len(features)),
+		make([]StringTable, len(features)),
+	}
+	for j, f := range features {
+		schema.names[j] = fmt.Sprintf("feature_%d", j)
+		if named, ok := f.(interface{ Name() string }); ok {
+			schema.names[j] = named.Name()
+		}
+		if cf, ok := f.(*CategoricalFeature); ok {
+			schema.tables[j] = cf.stringTable
+		}
+	}
+	return schema
+}
+
+// FeatureNames returns the names of the features with which the model
+// was trained.  Features that have a Name() method are named by it;
+// other features are named feature_0, feature_1, ...
+func (s *featureSchema) FeatureNames() []string {
+	return s.names
+}
+
+// SetFeatureNames replaces the names of the features with which the
+// model was trained.
+func (s *featureSchema) SetFeatureNames(names []string) {
+	if len(names) != len(s.names) {
+		panic(fmt.Sprintf("Argument mismatch: model has %d features, but len(names)=%d", len(s.names), len(names)))
+	}
+	s.names = names
+}
+
+// FeatureStringTable returns the StringTable of categorical feature j
+// or nil if feature j is not categorical.  Categorical features
+// presented to a loaded model should be created with
+// NewCategoricalFeature(model.FeatureStringTable(j)) so that their
+// codes match those seen in training.
+func (s *featureSchema) FeatureStringTable(j int) StringTable {
+	return s.tables[j]
+}
+
+// jsonFloat is a float64 whose JSON encoding allows NaN and infinities.
+type jsonFloat float64
+
+func (f jsonFloat) MarshalJSON() ([]byte, error) {
+	switch x := float64(f); {
+	case math.IsNaN(x):
+		return []byte(`"NaN"`), nil
+	case math.IsInf(x, 1):
+		return []byte(`"+Inf"`), nil
+	case math.IsInf(x, -1):
+		return []byte(`"-Inf"`), nil
+	}
+	return json.Marshal(float64(f))
+}
+
+func (f *jsonFloat) UnmarshalJSON(data []byte) error {
+	switch string(data) {
+	case `"NaN"`:
+		*f = jsonFloat(math.NaN())
+		return nil
+	case `"+Inf"`:
+		*f = jsonFloat(math.Inf(1))
+		return nil
+	case `"-Inf"`:
+		*f = jsonFloat(math.Inf(-1))
+		return nil
+	}
+	return json.Unmarshal(data, (*float64)(f))
+}
+
+// A NumericSplitter is encoded as a jsonFloat, since splits that
+// separate missing values from the others have infinite thresholds.
+
+func (s NumericSplitter) MarshalJSON() ([]byte, error) { return jsonFloat(s).MarshalJSON() }
+
+func (s *NumericSplitter) UnmarshalJSON(data []byte) error {
+	return (*jsonFloat)(s).UnmarshalJSON(data)
+}
+
+type splitterRecord struct {
+	Type  string          `json:"type"`
+	Value json.RawMessage `json:"value"`
+}
+
+type surrogateRecord struct {
+	Feature   int            `json:"feature"`
+	Splitter  splitterRecord `json:"splitter"`
+	Reverse   bool           `json:"reverse,omitempty"`
+	Agreement jsonFloat      `json:"agreement"`
+}
+
+type nodeRecord struct {
+	Size          int               `json:"size"`
+	Weight        jsonFloat         `json:"weight"`
+	Prediction    jsonFloat         `json:"prediction"`
+	Distribution  []float64         `json:"distribution,omitempty"`
+	Impurity      jsonFloat         `json:"impurity,omitempty"`
+	Targets       []float64         `json:"targets,omitempty"`
+	TargetWeights []float64         `json:"targetWeights,omitempty"`
+	Feature       int               `json:"feature"`
+	Reduction     jsonFloat         `json:"reduction,omitempty"`
+	Splitter      *splitterRecord   `json:"splitter,omitempty"`
+	MissingLeft   bool              `json:"missingLeft,omitempty"`
+	Surrogates    []surrogateRecord `json:"surrogates,omitempty"`
+	Left          *nodeRecord       `json:"left,omitempty"`
+	Right         *nodeRecord       `json:"right,omitempty"`
+}
+
+type featureRecord struct {
+	Name        string   `json:"name"`
+	Categorical bool     `json:"categorical,omitempty"`
+	Categories  []string `json:"categories,omitempty"`
+}
+
+type modelRecord struct {
+	Format    string          `json:"format"`
+	Version   int             `json:"version"`
+	Kind      string          `json:"kind"`
+	Features  []featureRecord `json:"features"`
+	Classes   []string        `json:"classes,omitempty"`
+	Seed      int64           `json:"seed"`
+	Bootstrap bool            `json:"bootstrap,omitempty"`
+	Trees     []*nodeRecord   `json:"trees"`
+}
+
+func encodeSplitter(s Splitter) (splitterRecord, error) {
+	splitterRegistry.RLock()
+	name, ok := splitterRegistry.names[reflect.TypeOf(s)]
+	splitterRegistry.RUnlock()
+	if !ok {
+		return splitterRecord{}, fmt.Errorf("splitter type %T is not registered", s)
+	}
+	value, err := json.Marshal(s)
+	return splitterRecord{name, value}, err
+}
+
+func decodeSplitter(r splitterRecord) (Splitter, error) {
+	splitterRegistry.RLock()
+	t, ok := splitterRegistry.types[r.Type]
+	splitterRegistry.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("splitter type %q is not registered", r.Type)
+	}
+	value := reflect.New(t)
+	if err := json.Unmarshal(r.Value, value.Interface()); err != nil {
+		return nil, err
+	}
+	return value.Elem().Interface().(Splitter), nil
+}
+
+// record returns the serializable representation of the tree rooted at n.
+func (n *DecisionTreeNode) record() (*nodeRecord, error) {
+	r := &nodeRecord{
+		Size:         n.size,
+		Weight:       jsonFloat(n.weight),
+		Prediction:   jsonFloat(n.prediction),
+		Distribution: n.distribution,
+		Impurity:     jsonFloat(n.impurity),
+		Feature:      n.feature,
+	}
+	if n.feature < 0 {
+		r.Targets, r.TargetWeights = n.targets, n.targetWeights
+		return r, nil
+	}
+
+	splitter, err := encodeSplitter(n.splitter)
+	if err != nil {
+		return nil, err
+	}
+	r.Splitter = &splitter
+	r.Reduction = jsonFloat(n.reduction)
+	r.MissingLeft = n.missingLeft
+	for _, s := range n.surrogates {
+		splitter, err := encodeSplitter(s.splitter)
+		if err != nil {
+			return nil, err
+		}
+		r.Surrogates = append(r.Surrogates, surrogateRecord{s.feature, splitter, s.reverse, jsonFloat(s.agreement)})
+	}
+	if r.Left, err = n.Left.record(); err != nil {
+		return nil, err
+	}
+	r.Right, err = n.Right.record()
+	return r, err
+}
+
+// node returns the tree represented by r.  Feature indexes must be
+// less than nFeatures.
+func (r *nodeRecord) node(nFeatures int) (*DecisionTreeNode, error) {
+	n := &DecisionTreeNode{
+		Metric: Metric{
+			size:         r.Size,
+			weight:       float64(r.Weight),
+			prediction:   float64(r.Prediction),
+			distribution: r.Distribution,
+		},
+		feature:  r.Feature,
+		impurity: float64(r.Impurity),
+	}
+	if r.Feature < 0 {
+		if len(r.Targets) != len(r.TargetWeights) {
+			return nil, fmt.Errorf("malformed leaf (%d targets and %d weights)", len(r.Targets), len(r.TargetWeights))
+		}
+		n.feature = -1
+		n.targets, n.targetWeights = r.Targets, r.TargetWeights
+		return n, nil
+	}
+
+	if r.Feature >= nFeatures || r.Splitter == nil || r.Left == nil || r.Right == nil {
+		return nil, fmt.Errorf("malformed node (feature %d of %d)", r.Feature, nFeatures)
+	}
+	var err error
+	if n.splitter, err = decodeSplitter(*r.Splitter); err != nil {
+		return nil, err
+	}
+	n.reduction = float64(r.Reduction)
+	n.missingLeft = r.MissingLeft
+	for _, s := range r.Surrogates {
+		if s.Feature < 0 || s.Feature >= nFeatures {
+			return nil, fmt.Errorf("malformed surrogate (feature %d of %d)", s.Feature, nFeatures)
+		}
+		splitter, err := decodeSplitter(s.Splitter)
+		if err != nil {
+			return nil, err
+		}
+		n.surrogates = append(n.surrogates, surrogateSplit{s.Feature, splitter, s.Reverse, float64(s.Agreement)})
+	}
+	if n.Left, err = r.Left.node(nFeatures); err != nil {
+		return nil, err
+	}
+	n.Right, err = r.Right.node(nFeatures)
+	return n, err
+}
+
+func stringTableRecord(st StringTable) []string {
+	result := make([]string, st.Len())
+	for i := range result {
+		result[i] = st.Decode(i)
+	}
+	return result
+}
+
+func stringTableFromRecord(strings []string) StringTable {
+	st := NewStringTable()
+	for _, s := range strings {
+		st.Encode(s)
+	}
+	return st
+}
+
+// newModelRecord returns the document for a model of the given kind.
+func newModelRecord(kind string, schema featureSchema, classes StringTable, seed int64, trees []*DecisionTreeNode) (*modelRecord, error) {
+	m := &modelRecord{
+		Format:   modelFormat,
+		Version:  modelVersion,
+		Kind:     kind,
+		Seed:     seed,
+		Features: make([]featureRecord, len(schema.names)),
+		Trees:    make([]*nodeRecord, 0, len(trees)),
+	}
+	for j, name := range schema.names {
+		m.Features[j].Name = name
+		if st := schema.tables[j]; st != nil {
+			m.Features[j].Categorical = true
+			m.Features[j].Categories = stringTableRecord(st)
+		}
+	}
+	if classes != nil {
+		m.Classes = stringTableRecord(classes)
+	}
+	for _, tree := range trees {
+		if tree != nil {
+			r, err := tree.record()
+			if err != nil {
+				return nil, err
+			}
+			m.Trees = append(m.Trees, r)
+		}
+	}
+	return m, nil
+}
+
+// schema returns the featureSchema described by m.
+func (m *modelRecord) schema() featureSchema {
+	schema := featureSchema{
+		make([]string, len(m.Features)),
+		make([]StringTable, len(m.Features)),
+	}
+	for j, f := range m.Features {
+		schema.names[j] = f.Name
+		if f.Categorical {
+			schema.tables[j] = stringTableFromRecord(f.Categories)
+		}
+	}
+	return schema
+}
+
+// trees returns the trees described by m.
+func (m *modelRecord) trees() ([]*DecisionTreeNode, error) {
+	result := make([]*DecisionTreeNode, len(m.Trees))
+	for i, r := range m.Trees {
+		if r == nil {
+			return nil, fmt.Errorf("tree %d is missing", i)
+		}
+		var err error
+		if result[i], err = r.node(len(m.Features)); err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+func (m *modelRecord) writeJSON(w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", " ")
+	return encoder.Encode(m)
+}
+
+func (m *modelRecord) writeBinary(w io.Writer) error {
+	if _, err := io.WriteString(w, binaryMagic); err != nil {
+		return err
+	}
+	return gob.NewEncoder(w).Encode(m)
+}
+
+// readModelRecord reads a document in either encoding and checks that
+// it describes a model of the given kind.
+func readModelRecord(r io.Reader, kind string) (*modelRecord, error) {
+	m := &modelRecord{}
+
+	br := bufio.NewReader(r)
+	magic, err := br.Peek(len(binaryMagic))
+	if err == nil && bytes.Equal(magic, []byte(binaryMagic)) {
+		br.Discard(len(binaryMagic))
+		err = gob.NewDecoder(br).Decode(m)
+	} else {
+		err = json.NewDecoder(br).Decode(m)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case m.Format != modelFormat:
+		return nil, fmt.Errorf("not a %s model (format %q)", modelFormat, m.Format)
+	case m.Version < 1 || m.Version > modelVersion:
+		return nil, fmt.Errorf("unsupported model version %d (expected at most %d)", m.Version, modelVersion)
+	case m.Kind != kind:
+		return nil, fmt.Errorf("cannot load %s model as %s", m.Kind, kind)
+	}
+	return m, nil
+}
+
+func (dtr *DecisionTree) save(w io.Writer, kind string, classes StringTable, binary bool) error {
+	m, err := newModelRecord(kind, dtr.featureSchema, classes, dtr.seed, []*DecisionTreeNode{dtr.root})
+	if err != nil {
+		return err
+	}
+	if binary {
+		return m.writeBinary(w)
+	}
+	return m.writeJSON(w)
+}
+
+// load replaces the tree with one read from r.  A tree without a
+// grower, such as a zero value, gets a default grower that splits by
+// criterion.
+func (dtr *DecisionTree) load(r io.Reader, kind string, criterion SplitCriterion) (*modelRecord, error) {
+	m, err := readModelRecord(r, kind)
+	if err != nil {
+		return nil, err
+	}
+	trees, err := m.trees()
+	if err != nil {
+		return nil, err
+	}
+	if len(trees) != 1 {
+		return nil, fmt.Errorf("%s model has %d trees", kind, len(trees))
+	}
+	if dtr.grower == nil {
+		dtr.grower = newDecisionTreeGrower(criterion, nil)
+	}
+	dtr.root = trees[0]
+	dtr.nFeatures = len(m.Features)
+	dtr.featureSchema = m.schema()
+	dtr.seed = m.Seed
+	return m, nil
+}
+
+// Save writes the tree to w in the binary model format.
+func (dtr *DecisionTree) Save(w io.Writer) error {
+	return dtr.save(w, "DecisionTree", nil, true)
+}
+
+// SaveJSON writes the tree to w in the JSON model format.
+func (dtr *DecisionTree) SaveJSON(w io.Writer) error {
+	return dtr.save(w, "DecisionTree", nil, false)
+}
+
+// Load replaces the tree with one read from r in either model format.
+// The tree may be a zero value.
+func (dtr *DecisionTree) Load(r io.Reader) error {
+	_, err := dtr.load(r, "DecisionTree", MSECriterion{})
+	return err
+}
+
+// Save writes the tree to w in the binary model format.
+func (dtc *DecisionTreeClassifier) Save(w io.Writer) error {
+	return dtc.DecisionTree.save(w, "DecisionTreeClassifier", dtc.classes, true)
+}
+
+// SaveJSON writes the tree to w in the JSON model format.
+func (dtc *DecisionTreeClassifier) SaveJSON(w io.Writer) error {
+	return dtc.DecisionTree.save(w, "DecisionTreeClassifier", dtc.classes, false)
+}
+
+// Load replaces the tree with one read from r in either model format.
+// The tree may be a zero value.
+func (dtc *DecisionTreeClassifier) Load(r io.Reader) error {
+	m, err := dtc.DecisionTree.load(r, "DecisionTreeClassifier", Gini)
+	if err == nil {
+		dtc.classes = stringTableFromRecord(m.Classes)
+		dtc.nClasses = len(m.Classes)
+	}
+	return err
+}
+
+func (rf *randomForest) save(w io.Writer, kind string, classes StringTable, binary bool) error {
+	m, err := newModelRecord(kind, rf.featureSchema, classes, rf.seed, rf.trees)
+	if err != nil {
+		return err
+	}
+	m.Bootstrap = rf.bootstrap
+	if binary {
+		return m.writeBinary(w)
+	}
+	return m.writeJSON(w)
+}
+
+// load replaces the forest with one read from r.  A forest without a
+// grower, such as a zero value, gets a default grower that splits by
+// criterion.
+func (rf *randomForest) load(r io.Reader, kind string, criterion SplitCriterion) (*modelRecord, error) {
+	m, err := readModelRecord(r, kind)
+	if err != nil {
+		return nil, err
+	}
+	trees, err := m.trees()
+	if err != nil {
+		return nil, err
+	}
+	if rf.grower == nil {
+		rf.grower = newDecisionTreeGrower(criterion, nil)
+	}
+	rf.trees = trees
+	rf.nTrees = len(trees)
+	rf.nFeatures = len(m.Features)
+	rf.featureSchema = m.schema()
+	rf.seed = m.Seed
+	rf.bootstrap = m.Bootstrap
+	return m, nil
+}
+
+// Save writes the forest to w in the binary model format.
+func (rf *RandomForestRegressor) Save(w io.Writer) error {
+	return rf.save(w, "RandomForestRegressor", nil, true)
+}
+
+// SaveJSON writes the forest to w in the JSON model format.
+func (rf *RandomForestRegressor) SaveJSON(w io.Writer) error {
+	return rf.save(w, "RandomForestRegressor", nil, false)
+}
+
+// Load replaces the forest with one read from r in either model format.
+// The forest may be a zero value.
+func (rf *RandomForestRegressor) Load(r io.Reader) error {
+	_, err := rf.load(r, "RandomForestRegressor", MSECriterion{})
+	return err
+}
+
+// Save writes the forest to w in the binary model format.
+func (rf *RandomForestClassifier) Save(w io.Writer) error {
+	return rf.save(w, "RandomForestClassifier", rf.classes, true)
+}
+
+// SaveJSON writes the forest to w in the JSON model format.
+func (rf *RandomForestClassifier) SaveJSON(w io.Writer) error {
+	return rf.save(w, "RandomForestClassifier", rf.classes, false)
+}
+
+// Load replaces the forest with one read from r in either model format.
+// The forest may be a zero value.
+func (rf *RandomForestClassifier) Load(r io.Reader) error {
+	m, err := rf.load(r, "RandomForestClassifier", Gini)
+	if err == nil {
+		rf.classes = stringTableFromRecord(m.Classes)
+		rf.nClasses = len(m.Classes)
+	}
+	return err
+}
@@ -0,0 +1,232 @@
+package DragonBlood
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math"
+	"strings"
+	"testing"
+)
+
+// paritySplitter sends even codes left.
+type paritySplitter struct {
+	Offset int
+}
+
+func (s paritySplitter) Split(x float64) bool { return (int(x)+s.Offset)%2 == 0 }
+func (s paritySplitter) String() string       { return fmt.Sprintf("even (offset %d)", s.Offset) }
+
+func TestSaveLoadDecisionTree(test *testing.T) {
+	nan := math.NaN()
+
+	c := NewCategoricalFeature(NewStringTable())
+	c.AddFromString("a", "b", "c", "d", "a", "b", "c", "d")
+
+	x := NewNumericFeature([]float64{nan, 1, 2, 3, 4, 5, 6, nan})
+	t := NewNumericFeature([]float64{0, 10, 0, 10, 1, 11, 1, 11})
+
+	dt := NewDecisionTreeRegressor(WithSurrogates(1))
+	dt.Fit([]OrderedFeature{c, x}, t)
+	expected := dt.Predict([]Feature{c, x})
+	alphas, impurities := dt.CostComplexityPath()
+
+	for _, save := range []func(*bytes.Buffer) error{
+		func(b *bytes.Buffer) error { return dt.Save(b) },
+		func(b *bytes.Buffer) error { return dt.SaveJSON(b) },
+	} {
+		var buffer bytes.Buffer
+		if err := save(&buffer); err != nil {
+			test.Fatalf("Save returned %v", err)
+		}
+
+		loaded := NewDecisionTreeRegressor()
+		if err := loaded.Load(&buffer); err != nil {
+			test.Fatalf("Load returned %v", err)
+		}
+
+		if names := loaded.FeatureNames(); len(names) != 2 || names[1] != "feature_1" {
+			test.Errorf("FeatureNames() returned %v", names)
+		}
+		if loaded.FeatureStringTable(1) != nil {
+			test.Errorf("Numeric feature has a StringTable")
+		}
+
+		// Present the categories in a different order than in training
+		newC := NewCategoricalFeature(loaded.FeatureStringTable(0))
+		newC.AddFromString("d", "c", "b", "a", "d", "c", "b", "a")
+		newX := NewNumericFeature([]float64{nan, 6, 5, 4, 3, 2, 1, nan})
+		for i, p := range loaded.Predict([]Feature{newC, newX}) {
+			if p != expected[7-i] {
+				test.Errorf("Row %d: loaded tree predicted %v; expected %v", i, p, expected[7-i])
+			}
+		}
+
+		loadedAlphas, loadedImpurities := loaded.CostComplexityPath()
+		if fmt.Sprint(loadedAlphas, loadedImpurities) != fmt.Sprint(alphas, impurities) {
+			test.Errorf("Loaded tree has cost-complexity path %v, %v; expected %v, %v", loadedAlphas, loadedImpurities, alphas, impurities)
+		}
+	}
+}
+
+func TestSaveLoadRandomForestClassifier(test *testing.T) {
+	x := NewNumericFeature([]float64{0, 1, 2, 3, 4, 5, 6, 7})
+	t := NewCategoricalFeature(NewStringTable())
+	t.AddFromString("no", "no", "no", "no", "yes", "yes", "yes", "yes")
+
+	rf := NewRandomForestClassifier(10, Gini)
+	rf.Fit([]OrderedFeature{x}, t)
+
+	var buffer bytes.Buffer
+	if err := rf.SaveJSON(&buffer); err != nil {
+		test.Fatalf("SaveJSON returned %v", err)
+	}
+	if !strings.Contains(buffer.String(), `"kind": "RandomForestClassifier"`) {
+		test.Errorf("Unexpected JSON:\n%s", buffer.String())
+	}
+
+	loaded := NewRandomForestClassifier(0, Gini)
+	if err := loaded.Load(&buffer); err != nil {
+		test.Fatalf("Load returned %v", err)
+	}
+	expected := rf.Predict([]Feature{x})
+	for i, p := range loaded.Predict([]Feature{x}) {
+		if p != expected[i] {
+			test.Errorf("Row %d: loaded forest predicted %v; expected %v", i, p, expected[i])
+		}
+	}
+
+	// A classifier can't be loaded as a regressor
+	buffer.Reset()
+	rf.Save(&buffer)
+	if err := NewRandomForestRegressor(0).Load(&buffer); err == nil {
+		test.Errorf("Loading a classifier as a regressor succeeded")
+	}
+}
+
+func TestLoadZeroValue(test *testing.T) {
+	x := NewNumericFeature([]float64{0, 1, 2, 3, 4, 5, 6, 7})
+	t := NewNumericFeature([]float64{0, 0, 1, 1, 4, 4, 5, 5})
+	c := NewCategoricalFeature(NewStringTable())
+	c.AddFromString("no", "no", "no", "no", "yes", "yes", "yes", "yes")
+	features := []OrderedFeature{x}
+
+	rfr := NewRandomForestRegressor(5, WithNumJobs(2))
+	rfr.Fit(features, t)
+	rfc := NewRandomForestClassifier(5, Gini)
+	rfc.Fit(features, c)
+	dt := NewDecisionTreeRegressor()
+	dt.Fit(features, t)
+	dtc := NewDecisionTreeClassifier(Gini)
+	dtc.Fit(features, c)
+
+	var (
+		loadedRFR RandomForestRegressor
+		loadedRFC RandomForestClassifier
+		loadedDT  DecisionTree
+		loadedDTC DecisionTreeClassifier
+	)
+	unordered := []Feature{x}
+	for _, model := range []struct {
+		name            string
+		save            func(io.Writer) error
+		load            func(io.Reader) error
+		predict, loaded func() string
+	}{
+		{"RandomForestRegressor", rfr.Save, loadedRFR.Load,
+			func() string { return fmt.Sprint(rfr.Predict(unordered)) },
+			func() string { return fmt.Sprint(loadedRFR.Predict(unordered)) }},
+		{"RandomForestClassifier", rfc.Save, loadedRFC.Load,
+			func() string { return fmt.Sprint(rfc.Predict(unordered)) },
+			func() string { return fmt.Sprint(loadedRFC.Predict(unordered)) }},
+		{"DecisionTree", dt.Save, loadedDT.Load,
+			func() string { return fmt.Sprint(dt.Predict(unordered)) },
+			func() string { return fmt.Sprint(loadedDT.Predict(unordered)) }},
+		{"DecisionTreeClassifier", dtc.Save, loadedDTC.Load,
+			func() string { return fmt.Sprint(dtc.Predict(unordered)) },
+			func() string { return fmt.Sprint(loadedDTC.Predict(unordered)) }},
+	} {
+		var buffer bytes.Buffer
+		if err := model.save(&buffer); err != nil {
+			test.Fatalf("%s: Save returned %v", model.name, err)
+		}
+		if err := model.load(&buffer); err != nil {
+			test.Fatalf("%s: Load returned %v", model.name, err)
+		}
+		if expected, p := model.predict(), model.loaded(); p != expected {
+			test.Errorf("%s: zero value loaded predicted %v; expected %v", model.name, p, expected)
+		}
+	}
+
+	// A loaded zero value can be trained again.
+	loadedRFR.Fit(features, t)
+}
+
+func TestSaveLoadCustomSplitter(test *testing.T) {
+	RegisterSplitter("parity", paritySplitter{})
+
+	dt := NewDecisionTreeRegressor()
+	dt.nFeatures = 1
+	dt.featureSchema = featureSchema{[]string{"code"}, []StringTable{nil}}
+	dt.root = &DecisionTreeNode{
+		Metric:   NewMetric(4, 5),
+		feature:  0,
+		splitter: paritySplitter{1},
+		Left:     &DecisionTreeNode{Metric: NewMetric(2, 10), feature: -1},
+		Right:    &DecisionTreeNode{Metric: NewMetric(2, 0), feature: -1},
+	}
+
+	var buffer bytes.Buffer
+	if err := dt.SaveJSON(&buffer); err != nil {
+		test.Fatalf("SaveJSON returned %v", err)
+	}
+	loaded := &DecisionTree{}
+	if err := loaded.Load(&buffer); err != nil {
+		test.Fatalf("Load returned %v", err)
+	}
+	if s, ok := loaded.root.splitter.(paritySplitter); !ok || s.Offset != 1 {
+		test.Errorf("Loaded splitter %#v; expected paritySplitter{1}", loaded.root.splitter)
+	}
+
+	x := NewNumericFeature([]float64{1, 2})
+	for i, p := range loaded.Predict([]Feature{x}) {
+		if expected := []float64{10, 0}[i]; p != expected {
+			test.Errorf("Row %d: predicted %v; expected %v", i, p, expected)
+		}
+	}
+}
+
+func TestSaveLoadSplitOnMissingValues(test *testing.T) {
+	nan := math.NaN()
+	x := NewNumericFeature([]float64{nan, nan, nan, 1, 2, 3})
+	t := NewNumericFeature([]float64{10, 10, 10, 0, 0, 0})
+
+	dt := NewDecisionTreeRegressor()
+	dt.Fit([]OrderedFeature{x}, t)
+	if s, ok := dt.root.splitter.(NumericSplitter); !ok || !math.IsInf(float64(s), 1) {
+		test.Fatalf("Root splitter is %v; expected < +Inf", dt.root.splitter)
+	}
+
+	for _, save := range []func(*bytes.Buffer) error{
+		func(b *bytes.Buffer) error { return dt.Save(b) },
+		func(b *bytes.Buffer) error { return dt.SaveJSON(b) },
+	} {
+		var buffer bytes.Buffer
+		if err := save(&buffer); err != nil {
+			test.Fatalf("Save returned %v", err)
+		}
+		loaded := NewDecisionTreeRegressor()
+		if err := loaded.Load(&buffer); err != nil {
+			test.Fatalf("Load returned %v", err)
+		}
+		if s := loaded.root.splitter; s != dt.root.splitter {
+			test.Errorf("Loaded splitter %v; expected %v", s, dt.root.splitter)
+		}
+		newX := NewNumericFeature([]float64{nan, 0.5, 5})
+		for i, p := range loaded.Predict([]Feature{newX}) {
+			if expected := []float64{10, 0, 0}[i]; p != expected {
+				test.Errorf("Row %d: predicted %v; expected %v", i, p, expected)
+			}
+		}
+	}
+}
@@ -0,0 +1,322 @@
+package DragonBlood
+
+// TreeSHAP (Lundberg et al. 2018) computes exact SHAP values of a tree
+// in time proportional to the number of leaves times the square of the
+// depth.  The value of a set S of features for a unit x is the expected
+// prediction when the features in S take their values in x and the
+// others are unknown: at a split of a feature outside S, both children
+// are followed, weighted by the fraction of the training units (the
+// cover, here the node size) that reached each.  TreeSHAP tracks, for
+// each leaf, the unique features on the path to it along with the
+// fraction of the cover that reaches the leaf when each is outside S
+// (zero) and whether x reaches the leaf when it is in S (one).
+
+// shapPathElement is an element of the unique feature path of TreeSHAP.
+type shapPathElement struct {
+	feature   int
+	zero, one float64
+
+	// weight is the proportion of the subsets of the features on the
+	// path that have the size of this element's index.
+	weight float64
+}
+
+// extendPath appends feature to path, which holds depth elements.
+func extendPath(path []shapPathElement, depth int, zero, one float64, feature int) {
+	path[depth] = shapPathElement{feature, zero, one, 0}
+	if depth == 0 {
+		path[depth].weight = 1
+	}
+	for i := depth - 1; i >= 0; i-- {
+		path[i+1].weight += one * path[i].weight * float64(i+1) / float64(depth+1)
+		path[i].weight = zero * path[i].weight * float64(depth-i) / float64(depth+1)
+	}
+}
+
+// unwindPath undoes the extension of path, which holds depth+1
+// elements, by its element at index.
+func unwindPath(path []shapPathElement, depth, index int) {
+	one, zero := path[index].one, path[index].zero
+	next := path[depth].weight
+	for i := depth - 1; i >= 0; i-- {
+		if one != 0 {
+			weight := path[i].weight
+			path[i].weight = next * float64(depth+1) / (float64(i+1) * one)
+			next = weight - path[i].weight*zero*float64(depth-i)/float64(depth+1)
+		} else {
+			path[i].weight = path[i].weight * float64(depth+1) / (zero * float64(depth-i))
+		}
+	}
+	// Weights belong to positions, not features
+	for i := index; i < depth; i++ {
+		path[i].feature, path[i].zero, path[i].one = path[i+1].feature, path[i+1].zero, path[i+1].one
+	}
+}
+
+// unwoundPathSum returns the total weight of path, which holds depth+1
+// elements, had it not been extended by its element at index.
+func unwoundPathSum(path []shapPathElement, depth, index int) float64 {
+	one, zero := path[index].one, path[index].zero
+	next := path[depth].weight
+	total := 0.0
+	for i := depth - 1; i >= 0; i-- {
+		if one != 0 {
+			weight := next * float64(depth+1) / (float64(i+1) * one)
+			total += weight
+			next = path[i].weight - weight*zero*float64(depth-i)/float64(depth+1)
+		} else if zero != 0 {
+			total += path[i].weight * float64(depth+1) / (zero * float64(depth-i))
+		}
+	}
+	return total
+}
+
+// coverFractions returns the fractions of the cover of n that reach
+// its children.
+func (n *DecisionTreeNode) coverFractions() (left, right float64) {
+	if n.size == 0 {
+		return 0.5, 0.5
+	}
+	return float64(n.Left.size) / float64(n.size), float64(n.Right.size) / float64(n.size)
+}
+
+// expectedValue returns the mean prediction of the leaves below n
+// weighted by their cover.
+func (n *DecisionTreeNode) expectedValue() float64 {
+	if n.feature < 0 {
+		return n.prediction
+	}
+	left, right := n.coverFractions()
+	return left*n.Left.expectedValue() + right*n.Right.expectedValue()
+}
+
+// treeSHAP accumulates in phi the SHAP values of unit i of features.
+// If condition is nonzero, the values are instead those of the other
+// features given that conditionFeature is known (condition > 0) or
+// unknown (condition < 0), as needed for interaction values.
+type treeSHAP struct {
+	features         []Feature
+	i                int
+	phi              []float64
+	condition        int
+	conditionFeature int
+}
+
+// recurse visits n, which is reached from the node splitting feature
+// with the given zero and one fractions.  parent is the unique path
+// to that node.
+func (s *treeSHAP) recurse(n *DecisionTreeNode, parent []shapPathElement, depth int, zero, one float64, feature int, conditionFraction float64) {
+	if conditionFraction == 0 {
+		return
+	}
+
+	path := make([]shapPathElement, depth+1)
+	copy(path, parent)
+	if s.condition == 0 || s.conditionFeature != feature {
+		if zero == 0 && one == 0 {
+			return // No subset of features reaches n
+		}
+		extendPath(path, depth, zero, one, feature)
+	}
+
+	if n.feature < 0 {
+		for k := 1; k <= depth; k++ {
+			e := path[k]
+			s.phi[e.feature] += unwoundPathSum(path, depth, k) * (e.one - e.zero) * n.prediction * conditionFraction
+		}
+		return
+	}
+
+	hot, cold := n.Left, n.Right
+	hotZero, coldZero := n.coverFractions()
+	if !n.splitLeft(s.features, s.i) {
+		hot, cold = cold, hot
+		hotZero, coldZero = coldZero, hotZero
+	}
+
+	// A feature split again on the path is unwound so that it
+	// appears only once, with its fractions combined.
+	incomingZero, incomingOne := 1.0, 1.0
+	for k := 0; k <= depth; k++ {
+		if path[k].feature == n.feature {
+			incomingZero, incomingOne = path[k].zero, path[k].one
+			unwindPath(path, depth, k)
+			depth--
+			break
+		}
+	}
+
+	hotCondition, coldCondition := conditionFraction, conditionFraction
+	if s.condition > 0 && n.feature == s.conditionFeature {
+		coldCondition = 0
+		depth--
+	} else if s.condition < 0 && n.feature == s.conditionFeature {
+		hotCondition *= hotZero
+		coldCondition *= coldZero
+		depth--
+	}
+
+	s.recurse(hot, path, depth+1, hotZero*incomingZero, incomingOne, n.feature, hotCondition)
+	s.recurse(cold, path, depth+1, coldZero*incomingZero, 0, n.feature, coldCondition)
+}
+
+// shapValues adds the SHAP values of unit i of features for the tree
+// below n to phi.  See treeSHAP for condition and conditionFeature.
+func (n *DecisionTreeNode) shapValues(features []Feature, i int, phi []float64, condition, conditionFeature int) {
+	s := &treeSHAP{features, i, phi, condition, conditionFeature}
+	s.recurse(n, nil, 0, 1, 1, -1, 1)
+}
+
+// splitFeatures adds the features split below n to used and returns
+// it.
+func (n *DecisionTreeNode) splitFeatures(used map[int]bool) map[int]bool {
+	if n.feature >= 0 {
+		used[n.feature] = true
+		n.Left.splitFeatures(used)
+		n.Right.splitFeatures(used)
+	}
+	return used
+}
+
+// shapInteractionValues adds the SHAP interaction values of unit i of
+// features for the tree below n to phi, an nFeatures by nFeatures
+// matrix.  The interaction of features j and k is
+// split equally between phi[j][k] and phi[k][j], and phi[j][j] is the
+// SHAP value of j less its interactions.
+func (n *DecisionTreeNode) shapInteractionValues(features []Feature, i int, phi [][]float64) {
+	nFeatures := len(phi)
+	main := make([]float64, nFeatures)
+	n.shapValues(features, i, main, 0, 0)
+
+	known := make([]float64, nFeatures)
+	unknown := make([]float64, nFeatures)
+	for j := range n.splitFeatures(map[int]bool{}) {
+		for k := range known {
+			known[k], unknown[k] = 0, 0
+		}
+		n.shapValues(features, i, known, 1, j)
+		n.shapValues(features, i, unknown, -1, j)
+		for k := range known {
+			interaction := (known[k] - unknown[k]) / 2
+			if k != j {
+				phi[j][k] += interaction
+				main[j] -= interaction
+			}
+		}
+	}
+	for j, v := range main {
+		phi[j][j] += v
+	}
+}
+
+// SHAPValues returns the SHAP value of each feature for each unit,
+// computed exactly by TreeSHAP (Lundberg et al. 2018) with node sizes
+// as cover, and the expected value of the tree.  For each unit, the
+// expected value plus the unit's SHAP values equals its prediction.
+// A split routed by a surrogate or by the direction for missing
+// values is attributed to the split's own feature.
+func (dtr *DecisionTree) SHAPValues(features []Feature) (values [][]float64, expected float64) {
+	values = make([][]float64, features[0].Len())
+	for i := range values {
+		values[i] = make([]float64, dtr.nFeatures)
+		dtr.root.shapValues(features, i, values[i], 0, 0)
+	}
+	return values, dtr.root.expectedValue()
+}
+
+// SHAPInteractionValues returns, for each unit, the matrix of SHAP
+// interaction values (Lundberg et al. 2018) of each pair of features,
+// and the expected value of the tree.  The interaction of features j
+// and k is divided equally between values[i][j][k] and values[i][k][j],
+// and values[i][j][j] is the main effect of feature j, so that row j
+// sums to the SHAP value of feature j.  Computing interactions takes
+// about twice the number of features split in the tree times as long
+// as SHAPValues.
+func (dtr *DecisionTree) SHAPInteractionValues(features []Feature) (values [][][]float64, expected float64) {
+	values = make([][][]float64, features[0].Len())
+	for i := range values {
+		values[i] = newMatrix(dtr.nFeatures)
+		dtr.root.shapInteractionValues(features, i, values[i])
+	}
+	return values, dtr.root.expectedValue()
+}
+
+// newMatrix returns an n by n matrix of zeros.
+func newMatrix(n int) [][]float64 {
+	result := make([][]float64, n)
+	for j := range result {
+		result[j] = make([]float64, n)
+	}
+	return result
+}
+
+// forestMean returns the mean over the trees of the forest of the
+// values computed by f for each tree and unit, with the same weighting
+// as Predict.  f adds the values of unit i for tree to sum.
+func (rf *RandomForestRegressor) forestMean(nUnits int, zero func() []float64, add func(tree *DecisionTreeNode, i int, sum []float64)) [][]float64 {
+	result := make([][]float64, nUnits)
+	rf.parallelRange(nUnits, func(start, end int) {
+		for i := start; i < end; i++ {
+			result[i] = zero()
+			treeValues := zero()
+			for t, tree := range rf.trees {
+				if tree == nil {
+					continue
+				}
+				for k := range treeValues {
+					treeValues[k] = 0
+				}
+				add(tree, i, treeValues)
+				for k, v := range treeValues {
+					result[i][k] += (v - result[i][k]) / float64(t+1)
+				}
+			}
+		}
+	})
+	return result
+}
+
+// expectedValue returns the mean expected value of the trees.
+func (rf *RandomForestRegressor) expectedValue() float64 {
+	expected := 0.0
+	for t, tree := range rf.trees {
+		if tree != nil {
+			expected += (tree.expectedValue() - expected) / float64(t+1)
+		}
+	}
+	return expected
+}
+
+// SHAPValues returns the SHAP value of each feature for each unit,
+// the mean of those of the trees, and the expected value of the
+// forest.  See DecisionTree.SHAPValues.
+func (rf *RandomForestRegressor) SHAPValues(features []Feature) (values [][]float64, expected float64) {
+	values = rf.forestMean(features[0].Len(), func() []float64 { return make([]float64, rf.nFeatures) },
+		func(tree *DecisionTreeNode, i int, phi []float64) { tree.shapValues(features, i, phi, 0, 0) })
+	return values, rf.expectedValue()
+}
+
+// SHAPInteractionValues returns, for each unit, the matrix of SHAP
+// interaction values of each pair of features, the mean of those of
+// the trees, and the expected value of the forest.  See
+// DecisionTree.SHAPInteractionValues.
+func (rf *RandomForestRegressor) SHAPInteractionValues(features []Feature) (values [][][]float64, expected float64) {
+	nFeatures := rf.nFeatures
+	flat := rf.forestMean(features[0].Len(), func() []float64 { return make([]float64, nFeatures*nFeatures) },
+		func(tree *DecisionTreeNode, i int, sum []float64) {
+			phi := newMatrix(nFeatures)
+			tree.shapInteractionValues(features, i, phi)
+			for j := range phi {
+				copy(sum[j*nFeatures:], phi[j])
+			}
+		})
+
+	values = make([][][]float64, len(flat))
+	for i, v := range flat {
+		values[i] = make([][]float64, nFeatures)
+		for j := range values[i] {
+			values[i][j] = v[j*nFeatures : (j+1)*nFeatures]
+		}
+	}
+	return values, rf.expectedValue()
+}
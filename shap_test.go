@@ -0,0 +1,141 @@
+package DragonBlood_test
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+
+	db "github.com/mawicks/DragonBlood"
+)
+
+// binaryFeatures returns two features holding each combination of 0
+// and 1 twice and the target f(x1, x2) of each unit.
+func binaryFeatures(f func(x1, x2 float64) float64) (x1, x2, t *db.NumericFeature) {
+	x1, x2, t = db.NewNumericFeature(nil), db.NewNumericFeature(nil), db.NewNumericFeature(nil)
+	for copy := 0; copy < 2; copy++ {
+		for _, v := range [][2]float64{{0, 0}, {0, 1}, {1, 0}, {1, 1}} {
+			x1.Add(v[0])
+			x2.Add(v[1])
+			t.Add(f(v[0], v[1]))
+		}
+	}
+	return x1, x2, t
+}
+
+func TestSHAPValuesOfAdditiveTree(test *testing.T) {
+	x1, x2, t := binaryFeatures(func(x1, x2 float64) float64 { return 10*x1 + 5*x2 })
+	dt := db.NewDecisionTreeRegressor()
+	dt.Fit([]db.OrderedFeature{x1, x2}, t)
+
+	values, expected := dt.SHAPValues([]db.Feature{x1, x2})
+	if expected != 7.5 {
+		test.Errorf("Expected value is %v; expected 7.5", expected)
+	}
+	for i, phi := range values {
+		want := []float64{10 * (x1.NumericValue(i) - 0.5), 5 * (x2.NumericValue(i) - 0.5)}
+		for j := range want {
+			if math.Abs(phi[j]-want[j]) > 1e-12 {
+				test.Errorf("Unit %d: SHAP values %v; expected %v", i, phi, want)
+				break
+			}
+		}
+	}
+}
+
+func TestSHAPInteractionValuesOfProduct(test *testing.T) {
+	x1, x2, t := binaryFeatures(func(x1, x2 float64) float64 { return 4 * x1 * x2 })
+	dt := db.NewDecisionTreeRegressor()
+	dt.Fit([]db.OrderedFeature{x1, x2}, t)
+
+	// For x1 = x2 = 1, the Shapley interaction of the product is
+	// (f(1,1) - f(1,.) - f(.,1) + f(.,.)) / 2 = (4 - 2 - 2 + 1) / 2.
+	unit := 3
+	values, expected := dt.SHAPValues([]db.Feature{x1, x2})
+	interactions, _ := dt.SHAPInteractionValues([]db.Feature{x1, x2})
+	if expected != 1 {
+		test.Errorf("Expected value is %v; expected 1", expected)
+	}
+	want := [][]float64{{1, 0.5}, {0.5, 1}}
+	for j := range want {
+		if math.Abs(values[unit][j]-1.5) > 1e-12 {
+			test.Errorf("SHAP value of feature %d is %v; expected 1.5", j, values[unit][j])
+		}
+		for k := range want[j] {
+			if math.Abs(interactions[unit][j][k]-want[j][k]) > 1e-12 {
+				test.Errorf("SHAP interaction values are %v; expected %v", interactions[unit], want)
+			}
+		}
+	}
+}
+
+// checkSHAP checks that the SHAP values of each unit and the expected
+// value sum to its prediction, and that the interaction values are
+// symmetric with rows summing to the SHAP values.
+func checkSHAP(test *testing.T, name string, predictions []float64, values [][]float64, interactions [][][]float64, expected float64) {
+	for i, phi := range values {
+		total := expected
+		for j, v := range phi {
+			total += v
+			rowTotal := 0.0
+			for k, interaction := range interactions[i][j] {
+				rowTotal += interaction
+				if math.Abs(interaction-interactions[i][k][j]) > 1e-9 {
+					test.Errorf("%s unit %d: interaction of %d and %d is %v but that of %d and %d is %v", name, i, j, k, interaction, k, j, interactions[i][k][j])
+				}
+			}
+			if math.Abs(rowTotal-v) > 1e-9 {
+				test.Errorf("%s unit %d: interactions of feature %d sum to %v; SHAP value is %v", name, i, j, rowTotal, v)
+			}
+		}
+		if math.Abs(total-predictions[i]) > 1e-9 {
+			test.Errorf("%s unit %d: SHAP values sum to %v; prediction is %v", name, i, total, predictions[i])
+		}
+	}
+}
+
+func TestSHAPValuesSumToPredictions(test *testing.T) {
+	rng := rand.New(rand.NewSource(3))
+	x := db.NewNumericFeature(nil)
+	y := db.NewNumericFeature(nil)
+	c := db.NewCategoricalFeature(db.NewStringTable())
+	unused := db.NewNumericFeature(nil)
+	t := db.NewNumericFeature(nil)
+	for i := 0; i < 100; i++ {
+		xi, yi := rng.Float64(), rng.Float64()
+		ci := []string{"a", "b", "c"}[rng.Intn(3)]
+		ti := math.Sin(6*xi) + xi*yi
+		if ci == "b" {
+			ti += yi
+		}
+		if rng.Intn(10) == 0 {
+			xi = math.NaN()
+		}
+		x.Add(xi)
+		y.Add(yi)
+		c.AddFromString(ci)
+		unused.Add(0)
+		t.Add(ti)
+	}
+	features := []db.OrderedFeature{x, y, c, unused}
+	unordered := []db.Feature{x, y, c, unused}
+
+	dt := db.NewDecisionTreeRegressor(db.WithSurrogates(1), db.WithMinLeafSize(3))
+	dt.Fit(features, t)
+	values, expected := dt.SHAPValues(unordered)
+	interactions, interactionsExpected := dt.SHAPInteractionValues(unordered)
+	if interactionsExpected != expected {
+		test.Errorf("Expected values differ: %v and %v", expected, interactionsExpected)
+	}
+	checkSHAP(test, "tree", dt.Predict(unordered), values, interactions, expected)
+	for i := range values {
+		if values[i][3] != 0 {
+			test.Errorf("Unit %d: SHAP value of an unsplit feature is %v", i, values[i][3])
+		}
+	}
+
+	rf := db.NewRandomForestRegressor(10, db.WithSeed(1), db.WithMaxFeatures(2), db.WithNumJobs(3))
+	rf.Fit(features, t)
+	values, expected = rf.SHAPValues(unordered)
+	interactions, _ = rf.SHAPInteractionValues(unordered)
+	checkSHAP(test, "forest", rf.Predict(unordered), values, interactions, expected)
+}
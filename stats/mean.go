@@ -56,3 +56,59 @@ func (a *MeanAccumulator) Reset() {
 	a.sum = 0.0
 	a.count = 0
 }
+
+// WeightedMeanAccumulator is the weighted analog of MeanAccumulator.
+type WeightedMeanAccumulator struct {
+	count  int
+	weight float64
+	sum    float64
+}
+
+func NewWeightedMeanAccumulator() *WeightedMeanAccumulator {
+	return &WeightedMeanAccumulator{}
+}
+
+func (a *WeightedMeanAccumulator) Add(x, w float64) float64 {
+	a.sum += w * x
+	a.weight += w
+	a.count += 1
+
+	return a.sum
+}
+
+func (a *WeightedMeanAccumulator) Mean() float64 {
+	return a.sum / a.weight
+}
+
+func (a *WeightedMeanAccumulator) Value() float64 {
+	return a.sum / a.weight
+}
+
+// Count returns the number of values added (regardless of weight).
+func (a *WeightedMeanAccumulator) Count() int {
+	return a.count
+}
+
+func (a *WeightedMeanAccumulator) Weight() float64 {
+	return a.weight
+}
+
+func (a *WeightedMeanAccumulator) Subtract(x, w float64) float64 {
+	if a.count == 0 {
+		panic("Subtract() called more than Add()")
+	} else if a.count > 1 {
+		a.count -= 1
+		a.weight -= w
+		a.sum -= w * x
+	} else {
+		a.Reset()
+	}
+
+	return a.sum
+}
+
+func (a *WeightedMeanAccumulator) Reset() {
+	a.sum = 0.0
+	a.weight = 0.0
+	a.count = 0
+}
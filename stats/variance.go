@@ -84,3 +84,94 @@ func Variance(sequence []float64) float64 {
 
 	return accumulator.Variance()
 }
+
+// WeightedVarianceAccumulator is the weighted analog of
+// VarianceAccumulator.  Each value carries a non-negative weight and
+// the squared error is the weighted sum of squared deviations from
+// the weighted mean.  The remarks about the numerical properties of
+// Subtract() for VarianceAccumulator apply here as well.
+type WeightedVarianceAccumulator struct {
+	sum             float64
+	sumSquaredError float64
+	weight          float64
+	count           int
+}
+
+func NewWeightedVarianceAccumulator() *WeightedVarianceAccumulator {
+	return &WeightedVarianceAccumulator{}
+}
+
+func (a *WeightedVarianceAccumulator) Add(x, w float64) (sse, mean float64) {
+	if a.weight > 0 {
+		e := x - a.sum/a.weight
+		a.sumSquaredError += e * e * w * a.weight / (a.weight + w)
+	}
+	a.sum += w * x
+	a.weight += w
+	a.count += 1
+
+	return a.sumSquaredError, a.sum / a.weight
+}
+
+func (a *WeightedVarianceAccumulator) Mean() float64 {
+	return a.sum / a.weight
+}
+
+func (a *WeightedVarianceAccumulator) Variance() float64 {
+	if a.weight > 0 {
+		return a.sumSquaredError / a.weight
+	} else {
+		return 0.0
+	}
+}
+
+func (a *WeightedVarianceAccumulator) Value() float64 {
+	return a.sumSquaredError
+}
+
+// Count returns the number of values added (regardless of weight).
+func (a *WeightedVarianceAccumulator) Count() int {
+	return a.count
+}
+
+func (a *WeightedVarianceAccumulator) Weight() float64 {
+	return a.weight
+}
+
+func (a *WeightedVarianceAccumulator) Subtract(x, w float64) (sse, mean float64) {
+	if a.count == 0 {
+		panic("Subtract() called more than Add()")
+	} else if a.count > 1 {
+		a.count -= 1
+		a.weight -= w
+		a.sum -= w * x
+
+		if a.weight > 0 {
+			e := x - a.sum/a.weight
+			a.sumSquaredError -= e * e * w * a.weight / (a.weight + w)
+		} else {
+			a.sumSquaredError = 0.0
+		}
+	} else {
+		a.Reset()
+	}
+
+	return a.sumSquaredError, a.sum / a.weight
+}
+
+func (a *WeightedVarianceAccumulator) Reset() {
+	a.sum = 0.0
+	a.sumSquaredError = 0.0
+	a.weight = 0.0
+	a.count = 0
+}
+
+// WeightedVariance returns the weighted variance of sequence.
+func WeightedVariance(sequence, weights []float64) float64 {
+	accumulator := NewWeightedVarianceAccumulator()
+	for i, x := range sequence {
+		accumulator.Add(x, weights[i])
+	}
+
+	return accumulator.Variance()
+}
@@ -67,3 +67,47 @@ func TestVariance(test *testing.T) {
 		test.Errorf("Expected variance of %g; got %g\n", expected, variance)
 	}
 }
+
+func TestWeightedVarianceAccumulator(test *testing.T) {
+	// Weighting 5.0 by 2 is equivalent to the sequence 1, 2, 0, 5, 5
+	x := []float64{1.0, 2.0, 0.0, 5.0}
+	w := []float64{1.0, 1.0, 1.0, 2.0}
+
+	a := stats.NewWeightedVarianceAccumulator()
+	b := stats.NewVarianceAccumulator()
+	for i, x := range x {
+		a.Add(x, w[i])
+		for j := 0; j < int(w[i]); j++ {
+			b.Add(x)
+		}
+	}
+
+	if a.Weight() != 5.0 || a.Count() != 4 {
+		test.Errorf("Weight() returned %v and Count() returned %d; expected 5 and 4", a.Weight(), a.Count())
+	}
+	if a.Mean() != b.Mean() || a.Value() != b.Value() {
+		test.Errorf("Weighted mean and sse are %v and %v; expected %v and %v", a.Mean(), a.Value(), b.Mean(), b.Value())
+	}
+
+	sse, mean := a.Subtract(5.0, 2.0)
+	if sse != 2.0 || mean != 1.0 {
+		test.Errorf("After Subtract(), sse and mean are %v and %v; expected 2 and 1", sse, mean)
+	}
+
+	if variance := stats.WeightedVariance(x, w); variance != b.Variance() {
+		test.Errorf("Expected weighted variance of %g; got %g\n", b.Variance(), variance)
+	}
+}
+
+func TestWeightedMeanAccumulator(test *testing.T) {
+	a := stats.NewWeightedMeanAccumulator()
+	a.Add(1.0, 3.0)
+	a.Add(5.0, 1.0)
+	if a.Mean() != 2.0 || a.Weight() != 4.0 || a.Count() != 2 {
+		test.Errorf("Mean(), Weight(), and Count() returned %v, %v, %d; expected 2, 4, 2", a.Mean(), a.Weight(), a.Count())
+	}
+	a.Subtract(5.0, 1.0)
+	if a.Mean() != 1.0 {
+		test.Errorf("After Subtract(), Mean() returned %v; expected 1", a.Mean())
+	}
+}